@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/99designs/basicauth-go"
+	"github.com/Strum355/log"
 	"github.com/spf13/viper"
 
 	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
@@ -12,6 +13,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
 	"github.com/go-chi/render"
 
 	"github.com/go-chi/chi"
@@ -45,7 +47,63 @@ func (api *API) Init() {
 		viper.GetString("http.basicauth.user"): {viper.GetString("http.basicauth.pass")},
 	})(promhttp.Handler()))
 
+	hostService := services.NewContainerHostService()
+	if err := hostService.RegisterProjects(); err != nil {
+		log.WithError(err).Error("failed to register one or more associated projects")
+	}
+
+	imageService := services.NewImageService(hostService)
+	if err := imageService.StartRefresh(); err != nil {
+		log.WithError(err).Error("failed to schedule base image refresh")
+	}
+
+	snapshotService := services.NewSnapshotService(hostService)
+	if err := snapshotService.StartSchedules(); err != nil {
+		log.WithError(err).Error("failed to schedule snapshot policies")
+	}
+
+	reconcileService := services.NewReconcileService(hostService)
+	if err := reconcileService.StartSchedule(); err != nil {
+		log.WithError(err).Error("failed to schedule reconciler")
+	}
+
+	statsService := services.NewStatsService(hostService)
+	if err := statsService.StartSchedule(); err != nil {
+		log.WithError(err).Error("failed to schedule stats export")
+	}
+
+	eventService := services.NewEventService(hostService)
+	eventService.Start()
+
+	webhookService := services.NewWebhookService(hostService, eventService)
+	if err := webhookService.Start(); err != nil {
+		log.WithError(err).Error("failed to resume webhook deliveries")
+	}
+
+	ingressService := services.NewIngressService(hostService, services.NewACMEService(hostService), eventService)
+	if err := ingressService.ClaimExisting(); err != nil {
+		log.WithError(err).Error("failed to claim hostnames of existing ingress rules")
+	}
+	if err := ingressService.StartRenewal(); err != nil {
+		log.WithError(err).Error("failed to schedule ingress certificate renewal")
+	}
+
 	api.routes.Route("/v1", func(r chi.Router) {
-		v1.NewProjectEndpoints(r)
+		v1.NewProjectEndpoints(r, hostService, webhookService, ingressService)
+		v1.NewRemoteEndpoints(r, hostService)
+		v1.NewImageEndpoints(r, imageService)
+		v1.NewSnapshotEndpoints(r, snapshotService)
+		v1.NewBackupEndpoints(r, services.NewBackupService(hostService))
+		v1.NewMigrationEndpoints(r, services.NewMigrationService(hostService, snapshotService))
+		v1.NewReconcileEndpoints(r, reconcileService)
+		v1.NewRegistryEndpoints(r, services.NewRegistryService())
+		v1.NewVolumeEndpoints(r, services.NewVolumeService(hostService))
+		v1.NewRolloutEndpoints(r, services.NewRolloutService(hostService, ingressService))
+		v1.NewStatsEndpoints(r, statsService)
+		v1.NewEventEndpoints(r, eventService)
+		v1.NewWebhookEndpoints(r, webhookService)
+		v1.NewFileEndpoints(r, services.NewFileService(hostService))
+		v1.NewIngressEndpoints(r, ingressService)
+		v1.NewConsoleEndpoints(r, services.NewConsoleService(hostService, services.NewAuditService()))
 	})
 }
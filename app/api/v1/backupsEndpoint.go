@@ -0,0 +1,124 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/backup"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type BackupEndpoint struct {
+	backupService *services.BackupService
+}
+
+func NewBackupEndpoints(r chi.Router, backupService *services.BackupService) {
+	backupEndpoint := BackupEndpoint{
+		backupService: backupService,
+	}
+
+	timeout := viper.GetDuration("backup.timeout")
+
+	r.Route("/projects/{namespace}/{name}/exports", func(r chi.Router) {
+		r.Get("/", middleware.WithContext(backupEndpoint.listProjectExports, time.Second*10))
+		r.Post("/", middleware.WithContext(backupEndpoint.exportProject, timeout))
+	})
+
+	r.Get("/exports", middleware.WithContext(backupEndpoint.listExports, time.Second*10))
+	r.Post("/imports", middleware.WithContext(backupEndpoint.importProject, timeout))
+}
+
+func (e *BackupEndpoint) listExports(w http.ResponseWriter, r *http.Request) {
+	keys, err := e.backupService.ListExports(r.Context(), "")
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: keys,
+	})
+}
+
+func (e *BackupEndpoint) listProjectExports(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := e.backupService.ListExports(r.Context(), proj.HostName())
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: keys,
+	})
+}
+
+func (e *BackupEndpoint) exportProject(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := e.backupService.Export(r.Context(), proj.HostName())
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error exporting project")
+		if errors.Is(err, services.ErrProjectNotRegistered) {
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusNotFound,
+				Content: err.Error(),
+			})
+			return
+		}
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusCreated,
+		Content: result,
+	})
+}
+
+func (e *BackupEndpoint) importProject(w http.ResponseWriter, r *http.Request) {
+	var req backup.ImportRequest
+	if err := render.Bind(r, &req); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	meta, err := e.backupService.Import(r.Context(), req.Key, req.Placement)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"key": req.Key}).Error("error importing project")
+		if errors.Is(err, services.ErrInvalidArchive) {
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusBadRequest,
+				Content: err.Error(),
+			})
+			return
+		}
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusCreated,
+		Content: meta,
+	})
+}
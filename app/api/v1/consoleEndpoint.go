@@ -0,0 +1,174 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/99designs/basicauth-go"
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+var consoleUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+type ConsoleEndpoint struct {
+	consoleService *services.ConsoleService
+}
+
+// NewConsoleEndpoints adds the admin console behind the `http.admin` basic auth credentials. The
+// console is left out if they arent set
+func NewConsoleEndpoints(r chi.Router, consoleService *services.ConsoleService) {
+	user, pass := viper.GetString("http.admin.user"), viper.GetString("http.admin.pass")
+	if user == "" || pass == "" {
+		log.Warn("http.admin.user or http.admin.pass not set, admin console disabled")
+		return
+	}
+
+	consoleEndpoint := ConsoleEndpoint{
+		consoleService: consoleService,
+	}
+
+	r.With(basicauth.New("windlass-admin", map[string][]string{user: {pass}})).
+		Get("/projects/{namespace}/{name}/console", middleware.WithContext(consoleEndpoint.checkHost(consoleEndpoint.openConsole), time.Second*10))
+}
+
+// checkHost renders an error instead of upgrading to a WebSocket if the project's container
+// host cant take a console
+func (e *ConsoleEndpoint) checkHost(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		proj, ok := projectFromURL(w, r)
+		if !ok {
+			return
+		}
+
+		if err := e.consoleService.CheckHost(r.Context(), proj.HostName()); err != nil {
+			renderError(w, r, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// openConsole upgrades to a WebSocket attached to a shell in the project's container host.
+// Binary messages carry the terminal's input and output, and text messages from the client
+// resize it with `{"width": 80, "height": 24}`. The socket is closed with the shell's exit status
+// once it exits
+func (e *ConsoleEndpoint) openConsole(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	user, _, _ := r.BasicAuth()
+	session := services.ConsoleSession{
+		Host:   proj.HostName(),
+		User:   user,
+		Remote: r.RemoteAddr,
+		Size:   host.TerminalSize{Width: 80, Height: 24},
+	}
+	if width, err := strconv.Atoi(r.URL.Query().Get("width")); err == nil && width > 0 {
+		session.Size.Width = width
+	}
+	if height, err := strconv.Atoi(r.URL.Query().Get("height")); err == nil && height > 0 {
+		session.Size.Height = height
+	}
+
+	conn, err := consoleUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already responded
+		return
+	}
+	defer conn.Close()
+
+	// the request context is only for the upgrade, the session lasts until either end hangs up
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stdin, stdinW := io.Pipe()
+	resize := make(chan host.TerminalSize)
+	go func() {
+		defer cancel()
+		defer stdinW.Close()
+		defer close(resize)
+
+		for {
+			msgType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			switch msgType {
+			case websocket.BinaryMessage:
+				if _, err := stdinW.Write(data); err != nil {
+					return
+				}
+			case websocket.TextMessage:
+				var size host.TerminalSize
+				if err := json.Unmarshal(data, &size); err != nil || size.Width <= 0 || size.Height <= 0 {
+					continue
+				}
+				select {
+				case resize <- size:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	out := &consoleWriter{conn: conn}
+	code, err := e.consoleService.Open(ctx, session, stdin, out, resize)
+	stdin.Close()
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, fmt.Sprintf("exit status %d", code))
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error running console")
+		reason := err.Error()
+		// close frame payloads are limited to 125 bytes, two of which are the code
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+		closeMsg = websocket.FormatCloseMessage(websocket.CloseInternalServerErr, reason)
+	}
+	out.close(closeMsg)
+}
+
+// consoleWriter sends terminal output as binary WebSocket messages
+type consoleWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (c *consoleWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *consoleWriter) Close() error {
+	return nil
+}
+
+func (c *consoleWriter) close(msg []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
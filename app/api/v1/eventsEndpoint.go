@@ -0,0 +1,89 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/event"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+)
+
+type EventEndpoint struct {
+	eventService *services.EventService
+}
+
+func NewEventEndpoints(r chi.Router, eventService *services.EventService) {
+	eventEndpoint := EventEndpoint{
+		eventService: eventService,
+	}
+
+	r.Get("/events", eventEndpoint.listEvents)
+	r.Get("/projects/{namespace}/{name}/events", eventEndpoint.listProjectEvents)
+}
+
+// listEvents returns the buffered events of every project, filtered by the `host`, `type` and
+// `after` query params
+func (e *EventEndpoint) listEvents(w http.ResponseWriter, r *http.Request) {
+	filter, ok := eventFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Host = r.URL.Query().Get("host")
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: e.eventService.Events(filter),
+	})
+}
+
+func (e *EventEndpoint) listProjectEvents(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	filter, ok := eventFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Host = proj.HostName()
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: e.eventService.Events(filter),
+	})
+}
+
+// eventFilter reads the `type` and `after` query params. If either is invalid a 400 is rendered
+// and ok is false
+func eventFilter(w http.ResponseWriter, r *http.Request) (filter services.EventFilter, ok bool) {
+	query := r.URL.Query()
+
+	if param := query.Get("type"); param != "" {
+		var err error
+		if filter.Type, err = event.ParseType(param); err != nil {
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusBadRequest,
+				Content: err.Error(),
+			})
+			return filter, false
+		}
+	}
+
+	if param := query.Get("after"); param != "" {
+		var err error
+		if filter.After, err = strconv.ParseUint(param, 10, 64); err != nil {
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusBadRequest,
+				Content: "after must be an event ID",
+			})
+			return filter, false
+		}
+	}
+
+	return filter, true
+}
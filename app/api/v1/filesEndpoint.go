@@ -0,0 +1,174 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+const tarContentType = "application/x-tar"
+
+type FileEndpoint struct {
+	fileService *services.FileService
+}
+
+func NewFileEndpoints(r chi.Router, fileService *services.FileService) {
+	fileEndpoint := FileEndpoint{
+		fileService: fileService,
+	}
+
+	timeout := viper.GetDuration("files.timeout")
+
+	r.Route("/projects/{namespace}/{name}/files", func(r chi.Router) {
+		r.Get("/", middleware.WithContext(fileEndpoint.pullFiles, timeout))
+		r.Put("/", middleware.WithContext(fileEndpoint.pushFiles, timeout))
+	})
+}
+
+// pullFiles responds with a tar archive of the file or directory at the `path` query param, in
+// the container host or in the Docker container named by the `container` query param
+func (e *FileEndpoint) pullFiles(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	opts := host.FilePullOptions{
+		ContainerName: host.ContainerName{Name: proj.HostName()},
+		Container:     r.URL.Query().Get("container"),
+		Path:          r.URL.Query().Get("path"),
+	}
+
+	archive := &archiveWriter{
+		w:        w,
+		filename: path.Base(opts.Path) + ".tar",
+	}
+	if err := e.fileService.Pull(r.Context(), opts, archive); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error pulling files")
+		// the archive is cut short, which the client sees as a truncated tar
+		if archive.written {
+			return
+		}
+		renderError(w, r, err)
+	}
+}
+
+// pushFiles extracts a tar archive request body into the directory at the `path` query param.
+// Any other body is written to the file at `path`. The `uid`, `gid` and octal `mode` query params
+// override the owner and permissions of the pushed files
+func (e *FileEndpoint) pushFiles(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	opts, err := filePushOptions(r)
+	if err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+	opts.Name = proj.HostName()
+
+	maxSize := viper.GetInt64("files.maxUploadSize")
+	if r.ContentLength > maxSize {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusRequestEntityTooLarge,
+			Content: fmt.Sprintf("uploads are limited to %d bytes", maxSize),
+		})
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxSize)
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == tarContentType {
+		opts.Archive = body
+		err = e.fileService.Push(r.Context(), opts)
+	} else if r.ContentLength < 0 {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusLengthRequired,
+			Content: "Content-Length is required to push a single file",
+		})
+		return
+	} else {
+		err = e.fileService.PushFile(r.Context(), opts, body, r.ContentLength)
+	}
+
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error pushing files")
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
+
+func filePushOptions(r *http.Request) (host.FilePushOptions, error) {
+	query := r.URL.Query()
+	opts := host.FilePushOptions{
+		Container: query.Get("container"),
+		Path:      query.Get("path"),
+	}
+
+	if uid := query.Get("uid"); uid != "" {
+		id, err := strconv.ParseInt(uid, 10, 32)
+		if err != nil || id < 0 {
+			return opts, errors.New("uid must be a non-negative integer")
+		}
+		opts.UID = &id
+	}
+
+	if gid := query.Get("gid"); gid != "" {
+		id, err := strconv.ParseInt(gid, 10, 32)
+		if err != nil || id < 0 {
+			return opts, errors.New("gid must be a non-negative integer")
+		}
+		opts.GID = &id
+	}
+
+	if mode := query.Get("mode"); mode != "" {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || perm > 0777 {
+			return opts, errors.New("mode must be octal permissions such as 0644")
+		}
+		fileMode := os.FileMode(perm)
+		opts.Mode = &fileMode
+	}
+
+	return opts, nil
+}
+
+// archiveWriter sets the tar response headers on the first write, so that an error before
+// anything is written can still be rendered as JSON
+type archiveWriter struct {
+	w        http.ResponseWriter
+	filename string
+	written  bool
+}
+
+func (a *archiveWriter) Write(p []byte) (int, error) {
+	if !a.written {
+		a.w.Header().Set("Content-Type", tarContentType)
+		a.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.filename}))
+		a.w.WriteHeader(http.StatusOK)
+		a.written = true
+	}
+	return a.w.Write(p)
+}
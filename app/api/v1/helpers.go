@@ -0,0 +1,59 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+)
+
+// projectFromURL returns the project identified by the `namespace` and `name` URL params.
+// If they dont form a valid project a 400 is rendered and ok is false
+func projectFromURL(w http.ResponseWriter, r *http.Request) (proj project.Project, ok bool) {
+	proj = project.Project{
+		Namespace: chi.URLParam(r, "namespace"),
+		Name:      chi.URLParam(r, "name"),
+	}
+
+	if err := proj.ValidateName(); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return proj, false
+	}
+	return proj, true
+}
+
+// renderError renders err with the status code of a host.Error, or a 500 for any other error.
+// Container creation failures are rendered as an error message per container
+func renderError(w http.ResponseWriter, r *http.Request, err error) {
+	var ctrErrs services.ContainerErrors
+	if errors.As(err, &ctrErrs) {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusInternalServerError,
+			Content: ctrErrs,
+		})
+		return
+	}
+
+	status := http.StatusInternalServerError
+	var hostErr host.Error
+	if errors.As(err, &hostErr) {
+		status = hostErr.StatusCode
+	}
+	if errors.Is(err, services.ErrHostnameClaimed) {
+		status = http.StatusConflict
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  status,
+		Content: err.Error(),
+	})
+}
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type ImageEndpoint struct {
+	imageService *services.ImageService
+}
+
+func NewImageEndpoints(r chi.Router, imageService *services.ImageService) {
+	imageEndpoint := ImageEndpoint{
+		imageService: imageService,
+	}
+
+	r.Route("/images", func(r chi.Router) {
+		r.Get("/", middleware.WithContext(imageEndpoint.listImages, time.Second*10))
+		r.Get("/hosts", middleware.WithContext(imageEndpoint.listHostImages, time.Second*10))
+		r.Post("/refresh", middleware.WithContext(imageEndpoint.refresh, viper.GetDuration("lxd.image.timeout")))
+	})
+}
+
+// listImages returns every version of the base image that is kept around
+func (e *ImageEndpoint) listImages(w http.ResponseWriter, r *http.Request) {
+	images, err := e.imageService.ListBaseImages(r.Context())
+	if err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusInternalServerError,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: images,
+	})
+}
+
+// listHostImages returns the base image each container host was built from
+func (e *ImageEndpoint) listHostImages(w http.ResponseWriter, r *http.Request) {
+	hosts, err := e.imageService.ListHostImages(r.Context())
+	if err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusInternalServerError,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: hosts,
+	})
+}
+
+func (e *ImageEndpoint) refresh(w http.ResponseWriter, r *http.Request) {
+	if err := e.imageService.Refresh(r.Context()); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusInternalServerError,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
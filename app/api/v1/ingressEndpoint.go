@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/ingress"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type IngressEndpoint struct {
+	ingressService *services.IngressService
+}
+
+func NewIngressEndpoints(r chi.Router, ingressService *services.IngressService) {
+	ingressEndpoint := IngressEndpoint{
+		ingressService: ingressService,
+	}
+
+	r.Route("/projects/{namespace}/{name}/ingress", func(r chi.Router) {
+		r.Get("/", middleware.WithContext(ingressEndpoint.getRules, time.Second*10))
+		r.Put("/", middleware.WithContext(ingressEndpoint.setRules, time.Minute))
+	})
+}
+
+func (e *IngressEndpoint) getRules(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := e.ingressService.Rules(r.Context(), proj.HostName())
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: rules,
+	})
+}
+
+// setRules replaces a project's ingress rules with the JSON array of rules in the request body.
+// If nginx rejects the generated config a 422 with its output is returned and the previous
+// rules stay in place
+func (e *IngressEndpoint) setRules(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var rules ingress.Rules
+	if err := render.Bind(r, &rules); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	if err := e.ingressService.SetRules(r.Context(), proj.HostName(), rules); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error setting ingress rules")
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: rules,
+	})
+}
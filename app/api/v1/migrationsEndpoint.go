@@ -0,0 +1,97 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/migration"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type MigrationEndpoint struct {
+	migrationService *services.MigrationService
+}
+
+func NewMigrationEndpoints(r chi.Router, migrationService *services.MigrationService) {
+	migrationEndpoint := MigrationEndpoint{
+		migrationService: migrationService,
+	}
+
+	timeout := viper.GetDuration("lxd.migration.timeout")
+
+	r.Post("/projects/{namespace}/{name}/migrate", middleware.WithContext(migrationEndpoint.migrateProject, timeout))
+
+	// called by the source worker of a migration
+	r.With(middleware.CheckSharedSecret).Post("/migrations", middleware.WithContext(migrationEndpoint.receiveProject, timeout))
+}
+
+func (e *MigrationEndpoint) migrateProject(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req migration.Request
+	if err := render.Bind(r, &req); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	meta, err := e.migrationService.Migrate(r.Context(), proj.HostName(), req)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName(), "worker": req.Worker}).Error("error migrating project")
+		switch {
+		case errors.Is(err, services.ErrProjectNotRegistered):
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusNotFound,
+				Content: err.Error(),
+			})
+		case errors.Is(err, services.ErrSameWorker):
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusBadRequest,
+				Content: err.Error(),
+			})
+		default:
+			renderError(w, r, err)
+		}
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: meta,
+	})
+}
+
+func (e *MigrationEndpoint) receiveProject(w http.ResponseWriter, r *http.Request) {
+	var incoming migration.Incoming
+	if err := render.Bind(r, &incoming); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	meta, err := e.migrationService.Receive(r.Context(), incoming)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": incoming.Host}).Error("error receiving migrated project")
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusCreated,
+		Content: meta,
+	})
+}
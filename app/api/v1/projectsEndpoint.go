@@ -1,17 +1,17 @@
 package v1
 
 import (
+	"io/ioutil"
 	"net/http"
 	"time"
 
 	"github.com/Strum355/log"
 
-	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
-
 	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
 
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
 
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/compose"
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
 	"github.com/go-chi/render"
 
@@ -20,16 +20,22 @@ import (
 )
 
 type ProjectEndpoint struct {
-	hostService *services.ContainerHostService
+	hostService    *services.ContainerHostService
+	webhookService *services.WebhookService
+	ingressService *services.IngressService
 }
 
-func NewProjectEndpoints(r chi.Router) {
+func NewProjectEndpoints(r chi.Router, hostService *services.ContainerHostService, webhookService *services.WebhookService, ingressService *services.IngressService) {
 	projectEndpoint := ProjectEndpoint{
-		hostService: services.NewContainerHostService(),
+		hostService:    hostService,
+		webhookService: webhookService,
+		ingressService: ingressService,
 	}
 
 	r.Route("/projects", func(r chi.Router) {
 		r.Post("/", middleware.WithContext(projectEndpoint.createProject, time.Second*40))
+		r.Delete("/{namespace}/{name}", middleware.WithContext(projectEndpoint.deleteProject, time.Minute*2))
+		r.Put("/{namespace}/{name}/compose", middleware.WithContext(projectEndpoint.deployCompose, time.Minute*10))
 	})
 }
 
@@ -43,28 +49,116 @@ func (p *ProjectEndpoint) createProject(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := p.hostService.CreateHost(r.Context(), newProject.HostName()); err != nil {
+	// checked up front as the host would be left without its ingress if SetRules refused them
+	if err := p.ingressService.CheckHostnames(newProject.HostName(), newProject.Ingress); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	if err := p.hostService.CreateHost(r.Context(), newProject); err != nil {
 		// TODO: curl wasnt showing body. why not?
 		log.WithError(err).WithFields(log.Fields{"containerHost": newProject.HostName()}).Error("error creating host")
-		if err, ok := err.(host.Error); ok {
-			render.Render(w, r, models.APIResponse{
-				Status:  err.StatusCode,
-				Content: err.Error(),
-			})
-			return
-		}
+		p.webhookService.ProjectCreated(newProject, err)
+		renderError(w, r, err)
+		return
+	}
+
+	err := p.hostService.CreateServices(r.Context(), newProject.HostName(), newProject)
+	p.webhookService.ProjectCreated(newProject, err)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": newProject.HostName()}).Error("error creating services")
+		renderError(w, r, err)
+		return
+	}
+
+	if err := p.ingressService.SetRules(r.Context(), newProject.HostName(), newProject.Ingress); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": newProject.HostName()}).Error("error applying ingress rules")
+		renderError(w, r, err)
+	}
+}
+
+func (p *ProjectEndpoint) deleteProject(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := p.hostService.DeleteProject(r.Context(), proj.HostName()); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error deleting project")
+		renderError(w, r, err)
+		return
+	}
+	p.webhookService.ProjectDeleted(proj)
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
+
+// compose files larger than this are rejected
+const maxComposeSize = 1 << 20
+
+// deployCompose creates or updates a project from a Docker Compose file in the request body.
+// The remote and target query params place a new project's container host.
+func (p *ProjectEndpoint) deployCompose(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxComposeSize))
+	if err != nil {
 		render.Render(w, r, models.APIResponse{
-			Status:  http.StatusInternalServerError,
+			Status:  http.StatusBadRequest,
 			Content: err.Error(),
 		})
 		return
 	}
 
-	if err := p.hostService.CreateServices(r.Context(), newProject.HostName(), newProject); err != nil {
-		log.WithError(err).WithFields(log.Fields{"containerHost": newProject.HostName()}).Error("error creating services")
+	file, err := compose.Parse(data)
+	if err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	proj, err = file.Project(proj.Namespace, proj.Name, project.Placement{
+		Remote: r.URL.Query().Get("remote"),
+		Target: r.URL.Query().Get("target"),
+	})
+	if err != nil {
 		render.Render(w, r, models.APIResponse{
-			Status:  http.StatusInternalServerError,
+			Status:  http.StatusBadRequest,
 			Content: err.Error(),
 		})
+		return
+	}
+
+	created, err := p.hostService.DeployProject(r.Context(), proj)
+	if created {
+		p.webhookService.ProjectCreated(proj, err)
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error deploying compose project")
+		renderError(w, r, err)
+		return
 	}
+
+	// compose files dont carry ingress rules, the saved ones are pointed at the new containers
+	if err := p.ingressService.Apply(r.Context(), proj.HostName()); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error applying ingress rules")
+		renderError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	render.Render(w, r, models.APIResponse{
+		Status:  status,
+		Content: proj,
+	})
 }
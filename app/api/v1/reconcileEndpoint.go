@@ -0,0 +1,72 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type ReconcileEndpoint struct {
+	reconcileService *services.ReconcileService
+}
+
+func NewReconcileEndpoints(r chi.Router, reconcileService *services.ReconcileService) {
+	reconcileEndpoint := ReconcileEndpoint{
+		reconcileService: reconcileService,
+	}
+
+	r.Route("/drift", func(r chi.Router) {
+		r.Get("/", reconcileEndpoint.lastReport)
+		r.Post("/", middleware.WithContext(reconcileEndpoint.reconcile, viper.GetDuration("reconcile.timeout")))
+	})
+}
+
+// lastReport returns the drift found by the last reconcile
+func (e *ReconcileEndpoint) lastReport(w http.ResponseWriter, r *http.Request) {
+	report := e.reconcileService.LastReport()
+	if report == nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusNotFound,
+			Content: "no reconcile has run yet",
+		})
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: report,
+	})
+}
+
+// reconcile checks for drift now, fixing it if the `fix` query param is true
+func (e *ReconcileEndpoint) reconcile(w http.ResponseWriter, r *http.Request) {
+	fix := false
+	if param := r.URL.Query().Get("fix"); param != "" {
+		var err error
+		if fix, err = strconv.ParseBool(param); err != nil {
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusBadRequest,
+				Content: "fix must be true or false",
+			})
+			return
+		}
+	}
+
+	report, err := e.reconcileService.Reconcile(r.Context(), fix)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: report,
+	})
+}
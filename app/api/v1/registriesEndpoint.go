@@ -0,0 +1,112 @@
+package v1
+
+import (
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/registry"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+var (
+	namespaceFormat = regexp.MustCompile(`^[A-Za-z]([A-Za-z0-9\-])*$`)
+	registryFormat  = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.\-])*(:[0-9]+)?$`)
+)
+
+type RegistryEndpoint struct {
+	registryService *services.RegistryService
+}
+
+func NewRegistryEndpoints(r chi.Router, registryService *services.RegistryService) {
+	registryEndpoint := RegistryEndpoint{
+		registryService: registryService,
+	}
+
+	r.Route("/namespaces/{namespace}/registries", func(r chi.Router) {
+		r.Get("/", middleware.WithContext(registryEndpoint.listRegistries, time.Second*10))
+		r.Put("/{registry}", middleware.WithContext(registryEndpoint.setCredential, time.Second*10))
+		r.Delete("/{registry}", middleware.WithContext(registryEndpoint.deleteCredential, time.Second*10))
+	})
+}
+
+// registryFromURL returns the `namespace` and `registry` URL params. If either is malformed
+// a 400 is rendered and ok is false
+func registryFromURL(w http.ResponseWriter, r *http.Request) (namespace, registryHost string, ok bool) {
+	namespace, registryHost = chi.URLParam(r, "namespace"), chi.URLParam(r, "registry")
+
+	if !namespaceFormat.MatchString(namespace) || (registryHost != "" && !registryFormat.MatchString(registryHost)) {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: "namespace or registry bad format",
+		})
+		return namespace, registryHost, false
+	}
+	return namespace, registryHost, true
+}
+
+// listRegistries returns the registries a namespace has credentials for, but not the credentials
+func (e *RegistryEndpoint) listRegistries(w http.ResponseWriter, r *http.Request) {
+	namespace, _, ok := registryFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	registries, err := e.registryService.ListRegistries(r.Context(), namespace)
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: registries,
+	})
+}
+
+func (e *RegistryEndpoint) setCredential(w http.ResponseWriter, r *http.Request) {
+	namespace, registryHost, ok := registryFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var cred registry.Credential
+	if err := render.Bind(r, &cred); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+	cred.Registry = registryHost
+
+	if err := e.registryService.SetCredential(r.Context(), namespace, cred); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
+
+func (e *RegistryEndpoint) deleteCredential(w http.ResponseWriter, r *http.Request) {
+	namespace, registryHost, ok := registryFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := e.registryService.DeleteCredential(r.Context(), namespace, registryHost); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
@@ -0,0 +1,44 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type RemoteEndpoint struct {
+	hostService *services.ContainerHostService
+}
+
+func NewRemoteEndpoints(r chi.Router, hostService *services.ContainerHostService) {
+	remoteEndpoint := RemoteEndpoint{
+		hostService: hostService,
+	}
+
+	r.Route("/remotes", func(r chi.Router) {
+		r.Get("/", middleware.WithContext(remoteEndpoint.listRemotes, time.Second*10))
+	})
+}
+
+// listRemotes returns the LXD remotes and cluster members that projects can be placed on
+func (e *RemoteEndpoint) listRemotes(w http.ResponseWriter, r *http.Request) {
+	remotes, err := e.hostService.ListRemotes(r.Context())
+	if err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusInternalServerError,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: remotes,
+	})
+}
@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type RolloutEndpoint struct {
+	rolloutService *services.RolloutService
+}
+
+func NewRolloutEndpoints(r chi.Router, rolloutService *services.RolloutService) {
+	rolloutEndpoint := RolloutEndpoint{
+		rolloutService: rolloutService,
+	}
+
+	r.Post("/projects/{namespace}/{name}/containers/{container}/rollout", middleware.WithContext(rolloutEndpoint.rollout, time.Minute*15))
+}
+
+func (e *RolloutEndpoint) rollout(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req container.RolloutRequest
+	if err := render.Bind(r, &req); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	ctrName := chi.URLParam(r, "container")
+	if err := e.rolloutService.Rollout(r.Context(), proj, ctrName, req); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"containerHost": proj.HostName(),
+			"container":     ctrName,
+		}).Error("error rolling out container")
+
+		if errors.Is(err, services.ErrRolloutFailed) {
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusFailedDependency,
+				Content: err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, services.ErrRolloutInProgress) {
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusConflict,
+				Content: err.Error(),
+			})
+			return
+		}
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
@@ -0,0 +1,196 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/snapshot"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type SnapshotEndpoint struct {
+	snapshotService *services.SnapshotService
+}
+
+func NewSnapshotEndpoints(r chi.Router, snapshotService *services.SnapshotService) {
+	snapshotEndpoint := SnapshotEndpoint{
+		snapshotService: snapshotService,
+	}
+
+	timeout := viper.GetDuration("lxd.snapshot.timeout")
+
+	r.Route("/projects/{namespace}/{name}/snapshots", func(r chi.Router) {
+		r.Get("/", middleware.WithContext(snapshotEndpoint.listSnapshots, time.Second*10))
+		r.Post("/", middleware.WithContext(snapshotEndpoint.createSnapshot, timeout))
+
+		r.Get("/policy", snapshotEndpoint.getPolicy)
+		r.Put("/policy", snapshotEndpoint.setPolicy)
+		r.Delete("/policy", snapshotEndpoint.deletePolicy)
+
+		r.Delete("/{snapshot}", middleware.WithContext(snapshotEndpoint.deleteSnapshot, timeout))
+		r.Post("/{snapshot}/restore", middleware.WithContext(snapshotEndpoint.restoreSnapshot, timeout))
+	})
+}
+
+func (e *SnapshotEndpoint) listSnapshots(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	snapshots, err := e.snapshotService.ListSnapshots(r.Context(), proj.HostName())
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: snapshots,
+	})
+}
+
+func (e *SnapshotEndpoint) createSnapshot(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req snapshot.CreateRequest
+	if err := render.Bind(r, &req); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	if err := e.snapshotService.CreateSnapshot(r.Context(), proj.HostName(), req); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error creating snapshot")
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusCreated,
+	})
+}
+
+func (e *SnapshotEndpoint) deleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := e.snapshotService.DeleteSnapshot(r.Context(), proj.HostName(), chi.URLParam(r, "snapshot")); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
+
+func (e *SnapshotEndpoint) restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var req snapshot.RestoreRequest
+	if r.ContentLength > 0 {
+		if err := render.Bind(r, &req); err != nil {
+			render.Render(w, r, models.APIResponse{
+				Status:  http.StatusBadRequest,
+				Content: err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := e.snapshotService.RestoreSnapshot(r.Context(), proj.HostName(), chi.URLParam(r, "snapshot"), req); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error restoring snapshot")
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
+
+func (e *SnapshotEndpoint) getPolicy(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	policy, err := e.snapshotService.GetPolicy(proj.HostName())
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	if policy == nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusNotFound,
+			Content: "project has no snapshot policy",
+		})
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: policy,
+	})
+}
+
+func (e *SnapshotEndpoint) setPolicy(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	var policy snapshot.Policy
+	if err := render.Bind(r, &policy); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	if err := e.snapshotService.SetPolicy(proj.HostName(), policy); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: policy,
+	})
+}
+
+func (e *SnapshotEndpoint) deletePolicy(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := e.snapshotService.DeletePolicy(proj.HostName()); err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
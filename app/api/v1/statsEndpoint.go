@@ -0,0 +1,43 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type StatsEndpoint struct {
+	statsService *services.StatsService
+}
+
+func NewStatsEndpoints(r chi.Router, statsService *services.StatsService) {
+	statsEndpoint := StatsEndpoint{
+		statsService: statsService,
+	}
+
+	r.Get("/projects/{namespace}/{name}/stats", middleware.WithContext(statsEndpoint.getStats, time.Second*15))
+}
+
+func (e *StatsEndpoint) getStats(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := e.statsService.ProjectStats(r.Context(), proj.HostName())
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: stats,
+	})
+}
@@ -0,0 +1,64 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type VolumeEndpoint struct {
+	volumeService *services.VolumeService
+}
+
+func NewVolumeEndpoints(r chi.Router, volumeService *services.VolumeService) {
+	volumeEndpoint := VolumeEndpoint{
+		volumeService: volumeService,
+	}
+
+	r.Route("/projects/{namespace}/{name}/volumes", func(r chi.Router) {
+		r.Get("/", middleware.WithContext(volumeEndpoint.listVolumes, time.Second*10))
+		r.Delete("/{volume}", middleware.WithContext(volumeEndpoint.deleteVolume, time.Second*30))
+	})
+}
+
+func (e *VolumeEndpoint) listVolumes(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	volumes, err := e.volumeService.ListVolumes(r.Context(), proj.HostName())
+	if err != nil {
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: volumes,
+	})
+}
+
+func (e *VolumeEndpoint) deleteVolume(w http.ResponseWriter, r *http.Request) {
+	proj, ok := projectFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if err := e.volumeService.DeleteVolume(r.Context(), proj.HostName(), chi.URLParam(r, "volume")); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": proj.HostName()}).Error("error deleting volume")
+		renderError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
@@ -0,0 +1,137 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/api/models"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/webhook"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/services"
+	"github.com/UCCNetworkingSociety/Windlass-worker/middleware"
+)
+
+type WebhookEndpoint struct {
+	webhookService *services.WebhookService
+}
+
+func NewWebhookEndpoints(r chi.Router, webhookService *services.WebhookService) {
+	webhookEndpoint := WebhookEndpoint{
+		webhookService: webhookService,
+	}
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Post("/", middleware.WithContext(webhookEndpoint.createWebhook, time.Second*10))
+		r.Get("/", middleware.WithContext(webhookEndpoint.listWebhooks, time.Second*10))
+		r.Delete("/{id}", middleware.WithContext(webhookEndpoint.deleteWebhook, time.Second*10))
+		r.Get("/{id}/deliveries", middleware.WithContext(webhookEndpoint.listDeliveries, time.Second*10))
+		r.Post("/{id}/deliveries/{delivery}/redeliver", middleware.WithContext(webhookEndpoint.redeliver, time.Second*10))
+	})
+}
+
+// createWebhook registers a webhook. The response is the only time its secret is returned
+func (e *WebhookEndpoint) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook webhook.Webhook
+	if err := render.Bind(r, &hook); err != nil {
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: err.Error(),
+		})
+		return
+	}
+
+	created, err := e.webhookService.CreateWebhook(r.Context(), hook)
+	if err != nil {
+		log.WithError(err).Error("error creating webhook")
+		renderWebhookError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusCreated,
+		Content: created,
+	})
+}
+
+// listWebhooks lists the webhooks of the `namespace` query param, or every webhook
+func (e *WebhookEndpoint) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := e.webhookService.ListWebhooks(r.URL.Query().Get("namespace"))
+	if err != nil {
+		renderWebhookError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: hooks,
+	})
+}
+
+func (e *WebhookEndpoint) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := e.webhookService.DeleteWebhook(r.Context(), chi.URLParam(r, "id")); err != nil {
+		renderWebhookError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusOK,
+	})
+}
+
+// listDeliveries returns a webhook's delivery history, newest first. `?status=failed` lists its
+// dead letters
+func (e *WebhookEndpoint) listDeliveries(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", webhook.StatusPending, webhook.StatusDelivered, webhook.StatusFailed:
+	default:
+		render.Render(w, r, models.APIResponse{
+			Status:  http.StatusBadRequest,
+			Content: "status must be pending, delivered or failed",
+		})
+		return
+	}
+
+	deliveries, err := e.webhookService.ListDeliveries(chi.URLParam(r, "id"), status)
+	if err != nil {
+		renderWebhookError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  http.StatusOK,
+		Content: deliveries,
+	})
+}
+
+func (e *WebhookEndpoint) redeliver(w http.ResponseWriter, r *http.Request) {
+	if err := e.webhookService.Redeliver(chi.URLParam(r, "id"), chi.URLParam(r, "delivery")); err != nil {
+		renderWebhookError(w, r, err)
+		return
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status: http.StatusAccepted,
+	})
+}
+
+func renderWebhookError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound), errors.Is(err, services.ErrDeliveryNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrNotDeadLetter):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrWebhookTarget), errors.Is(err, webhook.ErrInvalidURL):
+		status = http.StatusBadRequest
+	}
+
+	render.Render(w, r, models.APIResponse{
+		Status:  status,
+		Content: err.Error(),
+	})
+}
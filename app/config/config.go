@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"strings"
 
 	"github.com/Strum355/log"
@@ -12,27 +13,41 @@ import (
 
 func Load() error {
 	InitDefaults()
-	initFlags()
+	configFile := initFlags()
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
+	// Settings that dont map well to env vars, such as lists of LXD remotes, need a config file
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("failed to read config file %s: %v", configFile, err)
+		}
+	}
+
 	return nil
 }
 
-func initFlags() {
+func initFlags() (configFile string) {
 	var port string
 	flag.StringVar(&port, "port", "9786", "sets the port the worker listens on")
+	flag.StringVar(&configFile, "config", "", "optional path to a config file")
 	flag.Parse()
 
 	if port != "" {
 		viper.Set("http.port", port)
 	}
+
+	return configFile
 }
 
 func PrintSettings() {
 	// Print settings with secrets redacted
 	settings := viper.AllSettings()
 	settings["windlass"].(map[string]interface{})["secret"] = "[redacted]"
+	settings["http"].(map[string]interface{})["admin"].(map[string]interface{})["pass"] = "[redacted]"
+	settings["backup"].(map[string]interface{})["encryptionkey"] = "[redacted]"
+	settings["backup"].(map[string]interface{})["s3"].(map[string]interface{})["secretkey"] = "[redacted]"
 
 	out, _ := json.MarshalIndent(settings, "", "\t")
 	log.Debug("config:\n" + string(out))
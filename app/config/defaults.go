@@ -4,6 +4,7 @@ import (
 	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -14,10 +15,47 @@ func InitDefaults() {
 	viper.SetDefault("http.address", getOutboundIP().String())
 	viper.SetDefault("http.basicauth.user", "")
 	viper.SetDefault("http.basicauth.pass", "")
+	// Credentials for admin only endpoints such as the console, which are disabled until both are set
+	viper.SetDefault("http.admin.user", "")
+	viper.SetDefault("http.admin.pass", "")
 
 	viper.SetDefault("containerHost.type", "lxd")
 
-	viper.SetDefault("lxd.baseImage", "057aa4f7dc09") // sample image
+	// Base image settings. The image is imported from lxd.image.file (a unified tarball)
+	// or from the lxd.image.remoteAlias alias on the lxd.image.server simplestreams mirror
+	viper.SetDefault("lxd.image.alias", "windlass-base")
+	viper.SetDefault("lxd.image.file", "")
+	viper.SetDefault("lxd.image.server", "")
+	viper.SetDefault("lxd.image.remoteAlias", "windlass-base")
+	viper.SetDefault("lxd.image.refreshSchedule", "@daily") // cron spec, empty to disable
+	viper.SetDefault("lxd.image.keep", 2)                   // older versions kept after a refresh
+	viper.SetDefault("lxd.image.verify", true)
+	viper.SetDefault("lxd.image.timeout", time.Minute*10)
+
+	viper.SetDefault("lxd.snapshot.timeout", time.Minute*5)
+	viper.SetDefault("lxd.migration.timeout", time.Minute*30)
+
+	// Storage pool the custom volumes backing project volumes are created in
+	viper.SetDefault("lxd.volumes.pool", "default")
+
+	// LXD remotes, see lxdRemoteConfig. Without any remotes the local socket at lxd.socket is used
+	viper.SetDefault("lxd.socket", "")
+	viper.SetDefault("lxd.defaultRemote", "local")
+
+	// LXD network settings
+	viper.SetDefault("lxd.network.name", "windlassbr0")
+	viper.SetDefault("lxd.network.ipv4", "10.69.1.1/24")
+	viper.SetDefault("lxd.network.isolation", "none") // none, bridge or acl
+	viper.SetDefault("lxd.network.namespaceIPv4", "auto")
+
+	// Docker clients for container hosts are rebuilt after this many failed health checks in a row
+	viper.SetDefault("docker.pool.maxFailures", 3)
+	// How long to wait for a container to be running or healthy before starting its dependents
+	viper.SetDefault("docker.dependencyTimeout", time.Minute*5)
+	// How many of a project's containers are pulled and created at once
+	viper.SetDefault("docker.createConcurrency", 4)
+	// How long a rollout waits for a replacement container to be running or healthy before rolling back
+	viper.SetDefault("docker.rolloutTimeout", time.Minute*5)
 
 	// Consul settings
 	viper.SetDefault("consul.url", "127.0.0.1:8500")
@@ -29,6 +67,67 @@ func InitDefaults() {
 	viper.SetDefault("vault.url", "http://localhost:8200") // vault client demands its a URL and not an IP
 	viper.SetDefault("vault.token", "netsoc")
 	viper.SetDefault("vault.path", "windlass/")
+	viper.SetDefault("vault.registryPath", "windlass_registries/") // private registry credentials, per namespace
+	viper.SetDefault("vault.acmePath", "windlass_acme/")           // ACME account key and ingress certificates
+	viper.SetDefault("vault.webhookPath", "windlass_webhooks/")    // secrets webhook payloads are signed with
+
+	// Export archive settings
+	viper.SetDefault("backup.storage", "local") // local or s3
+	viper.SetDefault("backup.local.path", "/var/lib/windlass/backups")
+	viper.SetDefault("backup.s3.endpoint", "127.0.0.1:9000")
+	viper.SetDefault("backup.s3.accessKey", "")
+	viper.SetDefault("backup.s3.secretKey", "")
+	viper.SetDefault("backup.s3.bucket", "windlass-backups")
+	viper.SetDefault("backup.s3.region", "")
+	viper.SetDefault("backup.s3.useSSL", false)
+	viper.SetDefault("backup.encryptionKey", "") // passphrase the TLS material in archives is encrypted with
+	viper.SetDefault("backup.tmpDir", "")        // defaults to the system temp dir
+	viper.SetDefault("backup.timeout", time.Minute*30)
+
+	// Drift between LXD, Consul and Vault is checked on reconcile.schedule and
+	// only fixed automatically if reconcile.autoFix is set
+	viper.SetDefault("reconcile.schedule", "@every 5m") // cron spec, empty to disable
+	viper.SetDefault("reconcile.autoFix", false)
+	viper.SetDefault("reconcile.timeout", time.Minute*5)
+
+	// Resource usage of every project is exported to Prometheus on stats.schedule
+	viper.SetDefault("stats.schedule", "@every 1m") // cron spec, empty to disable
+	viper.SetDefault("stats.concurrency", 8)        // projects sampled at once
+	viper.SetDefault("stats.timeout", time.Second*50)
+
+	// LXD and Docker events are watched for every project, and the last events.bufferSize kept
+	viper.SetDefault("events.bufferSize", 1000)
+	viper.SetDefault("events.resyncInterval", time.Second*30) // how often watchers are started for new projects
+	viper.SetDefault("events.retryInterval", time.Second*10)  // wait before reconnecting to LXD
+
+	// Webhook deliveries are retried with exponential backoff from webhooks.backoff up to
+	// webhooks.maxBackoff, and dead lettered after webhooks.maxAttempts
+	viper.SetDefault("webhooks.timeout", time.Second*10)
+	viper.SetDefault("webhooks.maxAttempts", 6)
+	viper.SetDefault("webhooks.backoff", time.Second*10)
+	viper.SetDefault("webhooks.maxBackoff", time.Minute*10)
+	viper.SetDefault("webhooks.history", 100) // delivered deliveries kept per webhook
+
+	// File pushes and pulls stream tar archives, uploads larger than files.maxUploadSize are rejected
+	viper.SetDefault("files.maxUploadSize", 512<<20)
+	viper.SetDefault("files.timeout", time.Minute*10)
+
+	// nginx config generated from project ingress rules, in a directory the host's nginx includes
+	viper.SetDefault("nginx.configPath", "/etc/nginx/conf.d/windlass-ingress.conf")
+	viper.SetDefault("nginx.challengeDir", "/var/lib/windlass/acme-challenge")
+	viper.SetDefault("nginx.certDir", "/etc/nginx/windlass-certs")
+
+	// Ingress hostnames with tls set get certificates from acme.directoryURL, checked on
+	// acme.schedule and renewed acme.renewBefore they expire
+	viper.SetDefault("acme.directoryURL", "https://acme-v02.api.letsencrypt.org/directory")
+	viper.SetDefault("acme.email", "")
+	viper.SetDefault("acme.caFile", "")             // extra CAs to trust for the ACME server, e.g. Pebble's
+	viper.SetDefault("acme.schedule", "@every 12h") // cron spec, empty to disable
+	viper.SetDefault("acme.renewBefore", time.Hour*24*30)
+	viper.SetDefault("acme.timeout", time.Minute*5)
+
+	// Admin console sessions are recorded to the audit log, one JSON entry per line
+	viper.SetDefault("audit.path", "audit.log")
 
 	viper.SetDefault("windlass.secret", "")
 }
@@ -1,8 +1,13 @@
 package connections
 
 import (
+	"context"
+	"time"
+
 	"github.com/Strum355/log"
+	"github.com/spf13/viper"
 
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
 )
 
@@ -17,6 +22,10 @@ func TestConnections() error {
 		return err
 	}
 
+	if err = testLXD(); err != nil {
+		return err
+	}
+
 	log.Debug("connections tested successfully")
 	return nil
 }
@@ -26,6 +35,27 @@ func testVault() error {
 	return err
 }
 
+// testLXD connects to LXD and makes sure the networks and base image container hosts
+// are created from exist
+func testLXD() error {
+	repo := host.NewContainerHostRepository()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	if err := repo.EnsureNetworks(ctx); err != nil {
+		return NewConnectionError(err, "LXD")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), viper.GetDuration("lxd.image.timeout"))
+	defer cancel()
+
+	if err := repo.EnsureBaseImage(ctx); err != nil {
+		return NewConnectionError(err, "LXD")
+	}
+	return nil
+}
+
 func testConsul() error {
 	p, err := providers.NewConsulProvider()
 	if err != nil {
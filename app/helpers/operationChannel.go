@@ -2,23 +2,148 @@ package helpers
 
 import (
 	"context"
+	"errors"
+	"time"
 
-	lxd "github.com/lxc/lxd/client"
+	"github.com/Strum355/log"
+	"github.com/lxc/lxd/shared/api"
 )
 
-func OperationChannel(op lxd.Operation) <-chan error {
-	channel := make(chan error)
+// how long the cleanup of an abandoned operation may take
+const cleanupTimeout = time.Minute * 5
+
+var errNotCancellable = errors.New("operation cannot be cancelled")
+
+// Waiter is satisfied by both local and remote LXD operations
+type Waiter interface {
+	Wait() error
+}
+
+// Cleanup undoes the effects of an operation that finished after it was abandoned
+type Cleanup func(ctx context.Context) error
+
+// Settle leaves whatever an abandoned operation acted on in a defined state once the operation
+// has finished, given the error it finished with
+type Settle func(ctx context.Context, opErr error) error
+
+// satisfied by local LXD operations
+type cancellable interface {
+	Get() api.Operation
+	Cancel() error
+}
+
+// satisfied by remote LXD operations, such as image copies
+type remoteCancellable interface {
+	GetTarget() (*api.Operation, error)
+	CancelTarget() error
+}
+
+func OperationChannel(op Waiter) <-chan error {
+	// buffered so the goroutine can exit even if nobody is left to receive
+	channel := make(chan error, 1)
 	go func() {
 		channel <- op.Wait()
 	}()
 	return channel
 }
 
-func OperationTimeout(ctx context.Context, op lxd.Operation) error {
+// OperationTimeout waits for op to finish or ctx to expire, see OperationTimeoutCleanup
+func OperationTimeout(ctx context.Context, op Waiter) error {
+	return OperationTimeoutCleanup(ctx, op, nil)
+}
+
+// OperationTimeoutCleanup waits for op to finish or ctx to expire. If ctx expires first the
+// operation is cancelled where LXD allows it. Either way the operation is tracked until it
+// finishes, and if it still succeeds cleanup is run to undo whatever it did.
+func OperationTimeoutCleanup(ctx context.Context, op Waiter, cleanup Cleanup) error {
+	var settle Settle
+	if cleanup != nil {
+		settle = func(ctx context.Context, opErr error) error {
+			if opErr != nil {
+				return nil
+			}
+			return cleanup(ctx)
+		}
+	}
+	return OperationTimeoutSettle(ctx, op, settle)
+}
+
+// OperationTimeoutSettle is OperationTimeoutCleanup for operations whose abandonment needs
+// handling whether or not they go on to succeed. settle is run once the abandoned operation
+// finishes, however it finishes.
+func OperationTimeoutSettle(ctx context.Context, op Waiter, settle Settle) error {
+	done := OperationChannel(op)
+
 	select {
-	case err := <-OperationChannel(op):
+	case err := <-done:
 		return err
 	case <-ctx.Done():
-		return ctx.Err()
 	}
+
+	fields := log.Fields{
+		"operation": operationID(op),
+	}
+
+	if err := cancelOperation(op); err != nil {
+		log.WithError(err).WithFields(fields).Warn("couldnt cancel LXD operation after context expired, it will be cleaned up once it finishes")
+	} else {
+		log.WithFields(fields).Info("cancelled LXD operation after context expired")
+	}
+
+	go func() {
+		opErr := <-done
+		if opErr != nil {
+			log.WithError(opErr).WithFields(fields).Debug("abandoned LXD operation failed")
+		}
+
+		if settle == nil {
+			if opErr == nil {
+				log.WithFields(fields).Info("abandoned LXD operation finished")
+			}
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+
+		if err := settle(ctx, opErr); err != nil {
+			log.WithError(err).WithFields(fields).Error("failed to clean up after abandoned LXD operation")
+			return
+		}
+		log.WithFields(fields).Info("cleaned up after abandoned LXD operation")
+	}()
+
+	return ctx.Err()
+}
+
+func cancelOperation(op Waiter) error {
+	switch op := op.(type) {
+	case cancellable:
+		if !op.Get().MayCancel {
+			return errNotCancellable
+		}
+		return op.Cancel()
+	case remoteCancellable:
+		target, err := op.GetTarget()
+		if err != nil {
+			return err
+		}
+		if !target.MayCancel {
+			return errNotCancellable
+		}
+		return op.CancelTarget()
+	}
+	return errNotCancellable
+}
+
+func operationID(op Waiter) string {
+	switch op := op.(type) {
+	case cancellable:
+		return op.Get().ID
+	case remoteCancellable:
+		if target, err := op.GetTarget(); err == nil {
+			return target.ID
+		}
+	}
+	return ""
 }
@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"context"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/hashicorp/go-multierror"
+)
+
+// how long undoing all stages of a rollback may take
+const rollbackTimeout = time.Minute * 5
+
+// Rollback collects an undo action for each completed stage of a multi stage operation,
+// such as provisioning a project, so that a failure in a later stage can leave no trace.
+type Rollback struct {
+	fields log.Fields
+	stages []rollbackStage
+}
+
+type rollbackStage struct {
+	name string
+	undo func(ctx context.Context) error
+}
+
+// NewRollback returns an empty Rollback. fields are added to every log line it writes
+func NewRollback(fields log.Fields) *Rollback {
+	return &Rollback{fields: fields}
+}
+
+// Add registers the undo action for a stage that has just completed
+func (r *Rollback) Add(stage string, undo func(ctx context.Context) error) {
+	r.stages = append(r.stages, rollbackStage{name: stage, undo: undo})
+}
+
+// Run undoes every registered stage in reverse order. A failed undo is logged and the
+// remaining stages are still undone. Run uses its own context as the context of the
+// failed operation has often expired.
+func (r *Rollback) Run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	var errs *multierror.Error
+	for i := len(r.stages) - 1; i >= 0; i-- {
+		stage := r.stages[i]
+
+		if err := stage.undo(ctx); err != nil {
+			log.WithError(err).WithFields(r.fields).WithFields(log.Fields{
+				"stage": stage.name,
+			}).Error("failed to roll back stage")
+			errs = multierror.Append(errs, err)
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"stage": stage.name,
+		}).WithFields(r.fields).Info("rolled back stage")
+	}
+
+	r.stages = nil
+	return errs.ErrorOrNil()
+}
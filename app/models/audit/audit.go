@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"time"
+)
+
+// Type is the kind of an audit log entry
+type Type string
+
+// Types of entries recorded for a console session
+const (
+	// A console session was opened
+	SessionStarted Type = "session_started"
+	// Bytes typed into the console
+	Input Type = "input"
+	// Bytes written to the console by the shell
+	Output Type = "output"
+	// The console's terminal was resized
+	Resize Type = "resize"
+	// The shell exited or the session was closed
+	SessionEnded Type = "session_ended"
+)
+
+// Entry is a line of the audit log. Every entry of a session carries its ID, who opened it
+// and on which container host, so that sessions can be picked back out of the log
+type Entry struct {
+	Time    time.Time `json:"time"`
+	Type    Type      `json:"type"`
+	Session string    `json:"session"`
+	User    string    `json:"user"`
+	Remote  string    `json:"remote"`
+	Host    string    `json:"host"`
+	// Input or output bytes
+	Data string `json:"data,omitempty"`
+	// Terminal size on start and resize
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Exit code of the shell, nil if the session ended before it exited
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
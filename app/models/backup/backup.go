@@ -0,0 +1,28 @@
+package backup
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+)
+
+var (
+	ErrNoKey = errors.New("export archive key missing")
+)
+
+// Request to import a project host from an export archive
+type ImportRequest struct {
+	// Key of the archive in backup storage, as returned by an export
+	Key string `json:"key"`
+
+	// Where to create the imported host, only the remote is used
+	Placement project.Placement `json:"placement"`
+}
+
+func (i *ImportRequest) Bind(r *http.Request) error {
+	if i.Key == "" {
+		return ErrNoKey
+	}
+	return nil
+}
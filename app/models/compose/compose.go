@@ -0,0 +1,340 @@
+// Package compose translates the subset of the Docker Compose file format (v2 and v3) that
+// Windlass supports into a project.
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v2"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/volume"
+)
+
+var (
+	ErrNoServices         = errors.New("compose file has no services")
+	ErrUnsupportedVersion = errors.New("only version 2 and 3 compose files are supported")
+)
+
+// File is a parsed compose file
+type File struct {
+	Version  string
+	Services []Service
+	Volumes  []volume.Volume
+}
+
+// Service is a compose service translated into a container
+type Service struct {
+	Name      string
+	Container container.Container
+}
+
+// serviceKeys are the service options that can be translated, anything else is rejected
+var serviceKeys = map[string]func(ctr *container.Container, value interface{}) error{
+	"image":       parseImage,
+	"command":     parseCommand,
+	"entrypoint":  parseEntrypoint,
+	"environment": parseEnvironment,
+	"labels":      parseLabels,
+	"ports":       parsePorts,
+	"volumes":     parseVolumes,
+	"depends_on":  parseDependsOn,
+	"restart":     parseRestart,
+	"healthcheck": parseHealthcheck,
+	"working_dir": parseWorkingDir,
+	"user":        parseUser,
+	"hostname":    parseHostname,
+	"extra_hosts": parseExtraHosts,
+	"cpus":        parseCPUs,
+	"mem_limit":   parseMemLimit,
+}
+
+// Parse parses a compose file. Every unsupported option is reported, not just the first.
+func Parse(data []byte) (*File, error) {
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+
+	var errs *multierror.Error
+	file := new(File)
+
+	for _, item := range doc {
+		key := fmt.Sprint(item.Key)
+		switch {
+		case key == "version":
+			file.Version = fmt.Sprint(item.Value)
+			if !strings.HasPrefix(file.Version, "2") && !strings.HasPrefix(file.Version, "3") {
+				errs = multierror.Append(errs, ErrUnsupportedVersion)
+			}
+		case key == "services":
+			services, err := asMap(item.Value)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("services: %w", err))
+				continue
+			}
+			for _, service := range services {
+				svc, err := parseService(fmt.Sprint(service.Key), service.Value)
+				if err != nil {
+					errs = multierror.Append(errs, err)
+					continue
+				}
+				file.Services = append(file.Services, svc)
+			}
+		case key == "volumes":
+			volumes, err := asMap(item.Value)
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("volumes: %w", err))
+				continue
+			}
+			for _, vol := range volumes {
+				if options, err := asMap(vol.Value); vol.Value != nil && (err != nil || len(options) > 0) {
+					errs = multierror.Append(errs, fmt.Errorf("volume %v: volume options are not supported", vol.Key))
+					continue
+				}
+				file.Volumes = append(file.Volumes, volume.Volume{Name: fmt.Sprint(vol.Key)})
+			}
+		case strings.HasPrefix(key, "x-"):
+			// extension fields are only used for YAML anchors
+		default:
+			errs = multierror.Append(errs, fmt.Errorf("top level %s is not supported", key))
+		}
+	}
+
+	if len(file.Services) == 0 && errs.ErrorOrNil() == nil {
+		return nil, ErrNoServices
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Project returns the project the compose file describes, validated as a project from the
+// projects endpoint would be
+func (f *File) Project(namespace, name string, placement project.Placement) (project.Project, error) {
+	proj := project.Project{
+		Namespace:  namespace,
+		Name:       name,
+		Placement:  placement,
+		Containers: make(container.Containers, 0, len(f.Services)),
+		Volumes:    f.Volumes,
+	}
+
+	for _, svc := range f.Services {
+		proj.Containers = append(proj.Containers, svc.Container)
+	}
+
+	if err := proj.ValidateName(); err != nil {
+		return proj, err
+	}
+	return proj, proj.Validate()
+}
+
+func parseService(name string, value interface{}) (Service, error) {
+	svc := Service{
+		Name: name,
+		Container: container.Container{
+			Name: name,
+		},
+	}
+
+	options, err := asMap(value)
+	if err != nil {
+		return svc, fmt.Errorf("service %s: %w", name, err)
+	}
+
+	var errs *multierror.Error
+	for _, option := range options {
+		key := fmt.Sprint(option.Key)
+
+		parse, ok := serviceKeys[key]
+		if !ok {
+			errs = multierror.Append(errs, fmt.Errorf("service %s: %s is not supported", name, key))
+			continue
+		}
+
+		if err := parse(&svc.Container, option.Value); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("service %s: %s: %w", name, key, err))
+		}
+	}
+
+	if svc.Container.Image == "" {
+		errs = multierror.Append(errs, fmt.Errorf("service %s: image is required", name))
+	}
+
+	return svc, errs.ErrorOrNil()
+}
+
+func parseImage(ctr *container.Container, value interface{}) (err error) {
+	ctr.Image, err = asString(value)
+	return err
+}
+
+func parseCommand(ctr *container.Container, value interface{}) (err error) {
+	ctr.Args, err = asCommand(value)
+	return err
+}
+
+func parseEntrypoint(ctr *container.Container, value interface{}) (err error) {
+	ctr.Entrypoint, err = asCommand(value)
+	return err
+}
+
+func parseEnvironment(ctr *container.Container, value interface{}) (err error) {
+	ctr.Env, err = asMapping(value)
+	return err
+}
+
+func parseLabels(ctr *container.Container, value interface{}) (err error) {
+	ctr.Labels, err = asMapping(value)
+	return err
+}
+
+func parseWorkingDir(ctr *container.Container, value interface{}) (err error) {
+	ctr.WorkingDir, err = asString(value)
+	return err
+}
+
+func parseUser(ctr *container.Container, value interface{}) (err error) {
+	ctr.User, err = asString(value)
+	return err
+}
+
+func parseHostname(ctr *container.Container, value interface{}) (err error) {
+	ctr.Hostname, err = asString(value)
+	return err
+}
+
+func parseExtraHosts(ctr *container.Container, value interface{}) error {
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			host, err := asString(item)
+			if err != nil {
+				return err
+			}
+			ctr.ExtraHosts = append(ctr.ExtraHosts, host)
+		}
+		return nil
+	}
+
+	hosts, err := asMap(value)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		ctr.ExtraHosts = append(ctr.ExtraHosts, fmt.Sprintf("%v:%v", host.Key, host.Value))
+	}
+	return nil
+}
+
+func parseDependsOn(ctr *container.Container, value interface{}) error {
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			dep, err := asString(item)
+			if err != nil {
+				return err
+			}
+			ctr.DependsOn = append(ctr.DependsOn, dep)
+		}
+		return nil
+	}
+
+	deps, err := asMap(value)
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range deps {
+		options, err := asMap(dep.Value)
+		if err != nil {
+			return err
+		}
+
+		for _, option := range options {
+			if fmt.Sprint(option.Key) != "condition" {
+				return fmt.Errorf("%s is not supported", option.Key)
+			}
+			// dependencies are waited on until healthy if they have a healthcheck, or running if not
+			switch condition := fmt.Sprint(option.Value); condition {
+			case "service_started", "service_healthy":
+			default:
+				return fmt.Errorf("condition %s is not supported", condition)
+			}
+		}
+		ctr.DependsOn = append(ctr.DependsOn, fmt.Sprint(dep.Key))
+	}
+	return nil
+}
+
+func parseRestart(ctr *container.Container, value interface{}) error {
+	// an unquoted `no` is a YAML boolean
+	if value == false {
+		value = "no"
+	}
+
+	restart, err := asString(value)
+	if err != nil {
+		return err
+	}
+
+	name, retries := restart, ""
+	if i := strings.Index(restart, ":"); i >= 0 {
+		name, retries = restart[:i], restart[i+1:]
+	}
+
+	ctr.RestartPolicy.Name = name
+	if retries != "" {
+		if ctr.RestartPolicy.MaximumRetryCount, err = strconv.Atoi(retries); err != nil {
+			return fmt.Errorf("invalid retry count %s", retries)
+		}
+	}
+	return nil
+}
+
+func parseCPUs(ctr *container.Container, value interface{}) error {
+	cpus, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+	if err != nil {
+		return fmt.Errorf("invalid number of CPUs %v", value)
+	}
+	ctr.Resources.CPUs = cpus
+	return nil
+}
+
+func parseMemLimit(ctr *container.Container, value interface{}) (err error) {
+	ctr.Resources.Memory, err = parseBytes(fmt.Sprint(value))
+	return err
+}
+
+// parseBytes parses a byte value such as `512m` or `1gb`
+func parseBytes(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"b", 1},
+	}
+
+	lower := strings.ToLower(s)
+	size := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower, size = strings.TrimSuffix(lower, unit.suffix), unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid byte value %s", s)
+	}
+	return n * size, nil
+}
@@ -0,0 +1,252 @@
+package compose
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/volume"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want *File
+		// substrings the error must contain, every unsupported option is reported
+		wantErr []string
+	}{
+		{
+			name: "minimal",
+			data: `
+version: "3"
+services:
+  web:
+    image: nginx
+`,
+			want: &File{
+				Version: "3",
+				Services: []Service{
+					{Name: "web", Container: container.Container{Name: "web", Image: "nginx"}},
+				},
+			},
+		},
+		{
+			name: "options",
+			data: `
+version: "2.4"
+services:
+  db:
+    image: postgres:12
+    environment:
+      POSTGRES_PASSWORD: secret
+    volumes:
+      - data:/var/lib/postgresql/data
+  web:
+    image: app
+    command: serve --port "80 80"
+    ports:
+      - "127.0.0.1:8080:80/udp"
+    volumes:
+      - /srv/static:/static:ro
+    depends_on:
+      db:
+        condition: service_healthy
+    restart: "on-failure:3"
+    cpus: 0.5
+    mem_limit: 512m
+volumes:
+  data:
+`,
+			want: &File{
+				Version: "2.4",
+				Services: []Service{
+					{Name: "db", Container: container.Container{
+						Name:  "db",
+						Image: "postgres:12",
+						Env:   map[string]string{"POSTGRES_PASSWORD": "secret"},
+						Mounts: []container.MountMapping{
+							{Volume: "data", Destination: "/var/lib/postgresql/data", RW: true},
+						},
+					}},
+					{Name: "web", Container: container.Container{
+						Name:  "web",
+						Image: "app",
+						Args:  []string{"serve", "--port", "80 80"},
+						Ports: []container.PortMapping{
+							{ContainerPort: 80, HostPort: 8080, Protocol: "udp", HostIP: "127.0.0.1"},
+						},
+						Mounts: []container.MountMapping{
+							{Source: "/srv/static", Destination: "/static"},
+						},
+						DependsOn:     []string{"db"},
+						RestartPolicy: container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3},
+						Resources:     container.Resources{CPUs: 0.5, Memory: 512 << 20},
+					}},
+				},
+				Volumes: []volume.Volume{{Name: "data"}},
+			},
+		},
+		{
+			name: "unquoted restart no",
+			data: `
+services:
+  web:
+    image: nginx
+    restart: no
+`,
+			want: &File{
+				Services: []Service{
+					{Name: "web", Container: container.Container{
+						Name:          "web",
+						Image:         "nginx",
+						RestartPolicy: container.RestartPolicy{Name: "no"},
+					}},
+				},
+			},
+		},
+		{
+			name:    "no services",
+			data:    `version: "3"`,
+			wantErr: []string{ErrNoServices.Error()},
+		},
+		{
+			name: "unsupported version",
+			data: `
+version: "1"
+services:
+  web:
+    image: nginx
+`,
+			wantErr: []string{ErrUnsupportedVersion.Error()},
+		},
+		{
+			name: "every unsupported option",
+			data: `
+version: "3"
+services:
+  web:
+    image: nginx
+    build: .
+    privileged: true
+  worker:
+    command: run
+networks:
+  default:
+`,
+			wantErr: []string{
+				"service web: build is not supported",
+				"service web: privileged is not supported",
+				"service worker: image is required",
+				"top level networks is not supported",
+			},
+		},
+		{
+			name: "port range",
+			data: `
+services:
+  web:
+    image: nginx
+    ports:
+      - "8000-8010:80"
+`,
+			wantErr: []string{errPortRange.Error()},
+		},
+		{
+			name: "relative bind mount",
+			data: `
+services:
+  web:
+    image: nginx
+    volumes:
+      - ./site:/usr/share/nginx/html
+`,
+			wantErr: []string{"relative paths are not supported"},
+		},
+		{
+			name: "depends_on condition",
+			data: `
+services:
+  web:
+    image: nginx
+    depends_on:
+      db:
+        condition: service_completed_successfully
+  db:
+    image: postgres
+`,
+			wantErr: []string{"condition service_completed_successfully is not supported"},
+		},
+		{
+			name:    "not yaml",
+			data:    "services: [",
+			wantErr: []string{"invalid compose file"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.data))
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("Parse() error = nil, want %q", tt.wantErr)
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("Parse() error = %q, want it to contain %q", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{s: "1024", want: 1024},
+		{s: "10b", want: 10},
+		{s: "512k", want: 512 << 10},
+		{s: "512kb", want: 512 << 10},
+		{s: "512m", want: 512 << 20},
+		{s: "512MB", want: 512 << 20},
+		{s: "2g", want: 2 << 30},
+		{s: "2Gb", want: 2 << 30},
+		{s: "0", want: 0},
+		{s: "", wantErr: true},
+		{s: "m", wantErr: true},
+		{s: "-1m", wantErr: true},
+		{s: "1.5g", wantErr: true},
+		{s: "1t", wantErr: true},
+		{s: "1 g", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseBytes(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseBytes(%q) = %d, want an error", tt.s, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseBytes(%q) error = %v", tt.s, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseBytes(%q) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+)
+
+var (
+	errNotString  = errors.New("expected a string")
+	errNotList    = errors.New("expected a list")
+	errNotMap     = errors.New("expected a mapping")
+	errNoValue    = errors.New("values cant be taken from the worker's environment")
+	errPortRange  = errors.New("port ranges are not supported")
+	errPortFormat = errors.New("port bad format")
+)
+
+func parsePorts(ctr *container.Container, value interface{}) error {
+	list, ok := value.([]interface{})
+	if !ok {
+		return errNotList
+	}
+
+	for i, item := range list {
+		port, err := parsePort(item)
+		if err != nil {
+			return fmt.Errorf("ports[%d]: %w", i, err)
+		}
+		ctr.Ports = append(ctr.Ports, port)
+	}
+	return nil
+}
+
+// parsePort parses the short `[[ip:]hostPort:]containerPort[/protocol]` and the long syntax
+func parsePort(value interface{}) (container.PortMapping, error) {
+	var port container.PortMapping
+
+	if options, err := asMap(value); err == nil {
+		for _, option := range options {
+			var err error
+			switch key := fmt.Sprint(option.Key); key {
+			case "target":
+				port.ContainerPort, err = parsePortNumber(fmt.Sprint(option.Value))
+			case "published":
+				port.HostPort, err = parsePortNumber(fmt.Sprint(option.Value))
+			case "protocol":
+				port.Protocol = fmt.Sprint(option.Value)
+			case "host_ip":
+				port.HostIP = fmt.Sprint(option.Value)
+			case "mode":
+				if option.Value != "host" {
+					err = fmt.Errorf("mode %v is not supported", option.Value)
+				}
+			default:
+				err = fmt.Errorf("%s is not supported", key)
+			}
+			if err != nil {
+				return port, err
+			}
+		}
+		return port, nil
+	}
+
+	spec := fmt.Sprint(value)
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		spec, port.Protocol = spec[:i], spec[i+1:]
+	}
+
+	parts := strings.Split(spec, ":")
+	if len(parts) > 3 {
+		return port, errPortFormat
+	}
+
+	var err error
+	if port.ContainerPort, err = parsePortNumber(parts[len(parts)-1]); err != nil {
+		return port, err
+	}
+	if len(parts) > 1 && parts[len(parts)-2] != "" {
+		if port.HostPort, err = parsePortNumber(parts[len(parts)-2]); err != nil {
+			return port, err
+		}
+	}
+	if len(parts) == 3 {
+		port.HostIP = parts[0]
+	}
+
+	return port, nil
+}
+
+func parsePortNumber(s string) (uint16, error) {
+	if strings.Contains(s, "-") {
+		return 0, errPortRange
+	}
+
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, errPortFormat
+	}
+	return uint16(n), nil
+}
+
+func parseVolumes(ctr *container.Container, value interface{}) error {
+	list, ok := value.([]interface{})
+	if !ok {
+		return errNotList
+	}
+
+	for i, item := range list {
+		mount, err := parseVolume(item)
+		if err != nil {
+			return fmt.Errorf("volumes[%d]: %w", i, err)
+		}
+		ctr.Mounts = append(ctr.Mounts, mount)
+	}
+	return nil
+}
+
+// parseVolume parses the short `source:target[:mode]` and the long syntax. The source is either a
+// named volume declared at the top level or an absolute path on the container host
+func parseVolume(value interface{}) (container.MountMapping, error) {
+	mount := container.MountMapping{RW: true}
+
+	if options, err := asMap(value); err == nil {
+		for _, option := range options {
+			switch key := fmt.Sprint(option.Key); key {
+			case "type":
+				if option.Value != "bind" && option.Value != "volume" {
+					return mount, fmt.Errorf("%v volumes are not supported", option.Value)
+				}
+			case "source":
+				mount.Source = fmt.Sprint(option.Value)
+			case "target":
+				mount.Destination = fmt.Sprint(option.Value)
+			case "read_only":
+				mount.RW = option.Value != true
+			default:
+				return mount, fmt.Errorf("%s is not supported", key)
+			}
+		}
+	} else {
+		parts := strings.Split(fmt.Sprint(value), ":")
+		switch len(parts) {
+		case 1:
+			return mount, errors.New("anonymous volumes are not supported")
+		case 3:
+			switch parts[2] {
+			case "ro":
+				mount.RW = false
+			case "rw":
+			default:
+				return mount, fmt.Errorf("volume mode %s is not supported", parts[2])
+			}
+		case 2:
+		default:
+			return mount, errors.New("volume bad format")
+		}
+		mount.Source, mount.Destination = parts[0], parts[1]
+	}
+
+	switch {
+	case strings.HasPrefix(mount.Source, "."), strings.HasPrefix(mount.Source, "~"):
+		return mount, errors.New("relative paths are not supported, there is no project directory on the container host")
+	case !strings.HasPrefix(mount.Destination, "/"):
+		return mount, errors.New("volume target must be an absolute path")
+	}
+
+	if !strings.HasPrefix(mount.Source, "/") {
+		mount.Volume, mount.Source = mount.Source, ""
+	}
+
+	return mount, nil
+}
+
+func parseHealthcheck(ctr *container.Container, value interface{}) error {
+	options, err := asMap(value)
+	if err != nil {
+		return err
+	}
+
+	healthcheck := new(container.Healthcheck)
+	for _, option := range options {
+		var err error
+		switch key := fmt.Sprint(option.Key); key {
+		case "test":
+			if test, ok := option.Value.(string); ok {
+				healthcheck.Test = []string{"CMD-SHELL", test}
+				continue
+			}
+			healthcheck.Test, err = asStringList(option.Value)
+		case "interval":
+			healthcheck.Interval, err = asDuration(option.Value)
+		case "timeout":
+			healthcheck.Timeout, err = asDuration(option.Value)
+		case "start_period":
+			healthcheck.StartPeriod, err = asDuration(option.Value)
+		case "retries":
+			healthcheck.Retries, err = strconv.Atoi(fmt.Sprint(option.Value))
+		case "disable":
+			if option.Value == true {
+				healthcheck.Test = []string{"NONE"}
+			}
+		default:
+			err = fmt.Errorf("%s is not supported", key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	ctr.Healthcheck = healthcheck
+	return nil
+}
+
+// asMap returns the items of a YAML mapping in the order they appear
+func asMap(value interface{}) (yaml.MapSlice, error) {
+	switch m := value.(type) {
+	case yaml.MapSlice:
+		return m, nil
+	case map[interface{}]interface{}:
+		items := make(yaml.MapSlice, 0, len(m))
+		for k, v := range m {
+			items = append(items, yaml.MapItem{Key: k, Value: v})
+		}
+		return items, nil
+	}
+	return nil, errNotMap
+}
+
+func asString(value interface{}) (string, error) {
+	switch value.(type) {
+	case string, int, float64, bool:
+		return fmt.Sprint(value), nil
+	}
+	return "", errNotString
+}
+
+func asStringList(value interface{}) ([]string, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, errNotList
+	}
+
+	strs := make([]string, 0, len(list))
+	for _, item := range list {
+		s, err := asString(item)
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+// asCommand accepts a command as a list, or as a string that is split the way a shell would
+func asCommand(value interface{}) ([]string, error) {
+	if s, ok := value.(string); ok {
+		return container.SplitCommand(s)
+	}
+	return asStringList(value)
+}
+
+// asMapping accepts either a mapping or a list of `KEY=value`, as for environment and labels
+func asMapping(value interface{}) (map[string]string, error) {
+	mapping := make(map[string]string)
+
+	if list, ok := value.([]interface{}); ok {
+		for _, item := range list {
+			s, err := asString(item)
+			if err != nil {
+				return nil, err
+			}
+
+			i := strings.Index(s, "=")
+			if i < 0 {
+				return nil, fmt.Errorf("%s: %w", s, errNoValue)
+			}
+			mapping[s[:i]] = s[i+1:]
+		}
+		return mapping, nil
+	}
+
+	items, err := asMap(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item.Value == nil {
+			return nil, fmt.Errorf("%v: %w", item.Key, errNoValue)
+		}
+		s, err := asString(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		mapping[fmt.Sprint(item.Key)] = s
+	}
+	return mapping, nil
+}
+
+func asDuration(value interface{}) (container.Duration, error) {
+	d, err := time.ParseDuration(fmt.Sprint(value))
+	return container.Duration(d), err
+}
@@ -1,5 +1,28 @@
 package container
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRestartPolicy = errors.New("restart policy must be one of no, always, unless-stopped or on-failure")
+	ErrInvalidRetryCount    = errors.New("maximum retry count is only valid for the on-failure restart policy")
+	ErrInvalidProtocol      = errors.New("port protocol must be tcp or udp")
+	ErrInvalidHostIP        = errors.New("port host IP bad format")
+	ErrInvalidExtraHost     = errors.New("extra hosts must be in the form host:ip")
+	ErrInvalidHealthcheck   = errors.New("healthcheck test must start with NONE, CMD or CMD-SHELL")
+	ErrInvalidLimits        = errors.New("cpu and memory limits cant be negative")
+	ErrCommandAndArgs       = errors.New("only one of command and args may be set")
+	ErrCommandQuotes        = errors.New("command has an unterminated quote or trailing backslash")
+	ErrMountSource          = errors.New("mounts need exactly one of a source path or a volume")
+	ErrMountPath            = errors.New("mount paths must be absolute")
+)
+
 type Containers []Container
 
 type Container struct {
@@ -9,9 +32,16 @@ type Container struct {
 	// The name of the image eg `ubuntu:18.04`
 	Image string `json:"image"`
 
-	// Command, if any, to start the container with
+	// Command, if any, to start the container with. It is split into arguments the way a
+	// shell would, so arguments containing spaces can be quoted
 	Command string `json:"command,omitempty"`
 
+	// Overrides the image's entrypoint
+	Entrypoint []string `json:"entrypoint,omitempty"`
+
+	// Arguments to start the container with, overriding the image's CMD
+	Args []string `json:"args,omitempty"`
+
 	// The mapping between ports within the container and ports on the host
 	// Only mapped ports will be accessible outside the container host
 	Ports []PortMapping `json:"ports"`
@@ -25,8 +55,149 @@ type Container struct {
 	// Environment variables to set for the container
 	Env map[string]string `json:"env"`
 
-	// Is the container started on creation
-	Started bool `json:"started"`
+	// Is the container started on creation, true if not set
+	Started *bool `json:"started,omitempty"`
+
+	// Names of containers in the same project that must be running, or healthy if they
+	// have a healthcheck, before this container is started
+	DependsOn []string `json:"dependsOn,omitempty"`
+
+	// What Docker does when the container exits, not restarted if empty
+	RestartPolicy RestartPolicy `json:"restartPolicy"`
+
+	// Docker healthcheck, the image's healthcheck is used if nil
+	Healthcheck *Healthcheck `json:"healthcheck,omitempty"`
+
+	// CPU and memory limits, unlimited if zero
+	Resources Resources `json:"resources"`
+
+	WorkingDir string `json:"workingDir,omitempty"`
+	User       string `json:"user,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+
+	// Additional /etc/hosts entries in the form `host:ip`
+	ExtraHosts []string `json:"extraHosts,omitempty"`
+}
+
+// StartOnCreate reports whether the container is started once created
+func (c Container) StartOnCreate() bool {
+	return c.Started == nil || *c.Started
+}
+
+// Cmd returns the arguments to start the container with, nil to use the image's CMD
+func (c Container) Cmd() []string {
+	if len(c.Args) > 0 {
+		return c.Args
+	}
+	if c.Command != "" {
+		// Validate has already rejected commands that dont split
+		args, _ := SplitCommand(c.Command)
+		return args
+	}
+	return nil
+}
+
+// SplitCommand splits a command into words the way a shell would, honouring single and double
+// quotes and backslashes
+func SplitCommand(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 || escaped {
+		return nil, ErrCommandQuotes
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Validate checks the container spec before anything is created from it
+func (c Container) Validate() error {
+	if err := c.validate(); err != nil {
+		return fmt.Errorf("container %s: %w", c.Name, err)
+	}
+	return nil
+}
+
+func (c Container) validate() error {
+	if _, err := ParseImageReference(c.Image); err != nil {
+		return err
+	}
+
+	if c.Command != "" && len(c.Args) > 0 {
+		return ErrCommandAndArgs
+	}
+	if _, err := SplitCommand(c.Command); err != nil {
+		return err
+	}
+
+	for _, port := range c.Ports {
+		if err := port.validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, mount := range c.Mounts {
+		if err := mount.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.RestartPolicy.validate(); err != nil {
+		return err
+	}
+
+	if c.Healthcheck != nil {
+		if err := c.Healthcheck.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Resources.CPUs < 0 || c.Resources.Memory < 0 {
+		return ErrInvalidLimits
+	}
+
+	for _, extraHost := range c.ExtraHosts {
+		i := strings.Index(extraHost, ":")
+		if i <= 0 || net.ParseIP(extraHost[i+1:]) == nil {
+			return ErrInvalidExtraHost
+		}
+	}
+
+	return nil
 }
 
 type PortMapping struct {
@@ -35,11 +206,38 @@ type PortMapping struct {
 
 	// The host port to map to the container port
 	HostPort uint16 `json:"hostPort"`
+
+	// tcp or udp, tcp if empty
+	Protocol string `json:"protocol,omitempty"`
+
+	// Host address to bind to, all addresses if empty
+	HostIP string `json:"hostIP,omitempty"`
+}
+
+// Proto returns the protocol of the mapping, defaulting to tcp
+func (p PortMapping) Proto() string {
+	if p.Protocol == "" {
+		return "tcp"
+	}
+	return p.Protocol
+}
+
+func (p PortMapping) validate() error {
+	if p.Proto() != "tcp" && p.Proto() != "udp" {
+		return ErrInvalidProtocol
+	}
+	if p.HostIP != "" && net.ParseIP(p.HostIP) == nil {
+		return ErrInvalidHostIP
+	}
+	return nil
 }
 
 type MountMapping struct {
 	// Host mount point
-	Source string `json:"source"`
+	Source string `json:"source,omitempty"`
+
+	// Named volume of the project to mount instead of a host path
+	Volume string `json:"volume,omitempty"`
 
 	// Container mount point
 	Destination string `json:"destination"`
@@ -47,3 +245,88 @@ type MountMapping struct {
 	// If false, is equal to `/host:/container:ro`
 	RW bool `json:"rw"`
 }
+
+func (m MountMapping) validate() error {
+	if (m.Source == "") == (m.Volume == "") {
+		return ErrMountSource
+	}
+	if !strings.HasPrefix(m.Destination, "/") || (m.Source != "" && !strings.HasPrefix(m.Source, "/")) {
+		return ErrMountPath
+	}
+	return nil
+}
+
+type RestartPolicy struct {
+	// no, always, unless-stopped or on-failure
+	Name string `json:"name"`
+
+	// Only for on-failure, unlimited if zero
+	MaximumRetryCount int `json:"maximumRetryCount,omitempty"`
+}
+
+func (r RestartPolicy) validate() error {
+	switch r.Name {
+	case "", "no", "always", "unless-stopped":
+		if r.MaximumRetryCount != 0 {
+			return ErrInvalidRetryCount
+		}
+	case "on-failure":
+	default:
+		return ErrInvalidRestartPolicy
+	}
+	return nil
+}
+
+type Healthcheck struct {
+	// Command to run, eg `["CMD-SHELL", "curl -f http://localhost"]` or `["NONE"]` to
+	// disable the image's healthcheck
+	Test []string `json:"test"`
+
+	Interval    Duration `json:"interval,omitempty"`
+	Timeout     Duration `json:"timeout,omitempty"`
+	StartPeriod Duration `json:"startPeriod,omitempty"`
+
+	// Consecutive failures needed to consider the container unhealthy
+	Retries int `json:"retries,omitempty"`
+}
+
+func (h Healthcheck) validate() error {
+	if len(h.Test) == 0 {
+		return ErrInvalidHealthcheck
+	}
+
+	switch h.Test[0] {
+	case "NONE", "CMD", "CMD-SHELL":
+		return nil
+	}
+	return ErrInvalidHealthcheck
+}
+
+type Resources struct {
+	// Number of CPUs the container may use, eg 0.5
+	CPUs float64 `json:"cpus,omitempty"`
+
+	// Memory limit in bytes
+	Memory int64 `json:"memory,omitempty"`
+}
+
+// Duration is a time.Duration written in JSON as a string such as `30s`
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
@@ -0,0 +1,93 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrDuplicateName     = errors.New("container names must be unique within a project")
+	ErrUnknownDependency = errors.New("depends on a container not in the project")
+	ErrDependencyCycle   = errors.New("container dependencies form a cycle")
+	ErrStoppedDependency = errors.New("depends on a container that is not started on creation")
+)
+
+// Validate checks each container and that their dependencies can be satisfied
+func (c Containers) Validate() error {
+	byName := make(map[string]Container, len(c))
+	for _, ctr := range c {
+		if err := ctr.Validate(); err != nil {
+			return err
+		}
+		if _, ok := byName[ctr.Name]; ok {
+			return fmt.Errorf("container %s: %w", ctr.Name, ErrDuplicateName)
+		}
+		byName[ctr.Name] = ctr
+	}
+
+	for _, ctr := range c {
+		for _, dep := range ctr.DependsOn {
+			depCtr, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("container %s: %w: %s", ctr.Name, ErrUnknownDependency, dep)
+			}
+			if ctr.StartOnCreate() && !depCtr.StartOnCreate() {
+				return fmt.Errorf("container %s: %w: %s", ctr.Name, ErrStoppedDependency, dep)
+			}
+		}
+	}
+
+	_, err := c.StartOrder()
+	return err
+}
+
+// StartOrder returns the containers ordered so that each comes after everything it depends on.
+// Containers without dependencies between them keep their order in the project.
+func (c Containers) StartOrder() (Containers, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	byName := make(map[string]Container, len(c))
+	for _, ctr := range c {
+		byName[ctr.Name] = ctr
+	}
+
+	state := make(map[string]int, len(c))
+	ordered := make(Containers, 0, len(c))
+
+	var visit func(ctr Container) error
+	visit = func(ctr Container) error {
+		switch state[ctr.Name] {
+		case visiting:
+			return fmt.Errorf("container %s: %w", ctr.Name, ErrDependencyCycle)
+		case visited:
+			return nil
+		}
+
+		state[ctr.Name] = visiting
+		for _, dep := range ctr.DependsOn {
+			depCtr, ok := byName[dep]
+			if !ok {
+				return fmt.Errorf("container %s: %w: %s", ctr.Name, ErrUnknownDependency, dep)
+			}
+			if err := visit(depCtr); err != nil {
+				return err
+			}
+		}
+		state[ctr.Name] = visited
+
+		ordered = append(ordered, ctr)
+		return nil
+	}
+
+	for _, ctr := range c {
+		if err := visit(ctr); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
@@ -0,0 +1,84 @@
+package container
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStartOrder(t *testing.T) {
+	ctr := func(name string, deps ...string) Container {
+		return Container{Name: name, DependsOn: deps}
+	}
+
+	tests := []struct {
+		name       string
+		containers Containers
+		want       []string
+		wantErr    error
+	}{
+		{
+			name:       "no dependencies keeps order",
+			containers: Containers{ctr("b"), ctr("a"), ctr("c")},
+			want:       []string{"b", "a", "c"},
+		},
+		{
+			name:       "dependency first",
+			containers: Containers{ctr("web", "db"), ctr("db")},
+			want:       []string{"db", "web"},
+		},
+		{
+			name:       "chain",
+			containers: Containers{ctr("a", "b"), ctr("b", "c"), ctr("c")},
+			want:       []string{"c", "b", "a"},
+		},
+		{
+			name:       "shared dependency",
+			containers: Containers{ctr("web", "cache", "db"), ctr("worker", "db"), ctr("cache"), ctr("db")},
+			want:       []string{"cache", "db", "web", "worker"},
+		},
+		{
+			name:       "self dependency",
+			containers: Containers{ctr("a", "a")},
+			wantErr:    ErrDependencyCycle,
+		},
+		{
+			name:       "cycle",
+			containers: Containers{ctr("a", "b"), ctr("b", "c"), ctr("c", "a")},
+			wantErr:    ErrDependencyCycle,
+		},
+		{
+			name:       "cycle behind a dependency",
+			containers: Containers{ctr("web", "a"), ctr("a", "b"), ctr("b", "a")},
+			wantErr:    ErrDependencyCycle,
+		},
+		{
+			name:       "unknown dependency",
+			containers: Containers{ctr("web", "db")},
+			wantErr:    ErrUnknownDependency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered, err := tt.containers.StartOrder()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("StartOrder() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StartOrder() error = %v", err)
+			}
+
+			got := make([]string, 0, len(ordered))
+			for _, ctr := range ordered {
+				got = append(got, ctr.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StartOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
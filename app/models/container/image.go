@@ -0,0 +1,114 @@
+package container
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// DefaultRegistry is the registry images without a registry host are pulled from
+const DefaultRegistry = "docker.io"
+
+var (
+	ErrInvalidImage = errors.New("image reference bad format")
+)
+
+var (
+	repositoryComponent = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*$`)
+	tagFormat           = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestFormat        = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+// ImageReference is a parsed image reference such as `registry.example.com:5000/team/app:1.2`
+// or `ubuntu@sha256:...`
+type ImageReference struct {
+	// Registry host, including the port if any
+	Registry string
+	// Repository within the registry, eg `library/ubuntu`
+	Repository string
+	// Tag, `latest` if the reference has neither a tag nor a digest
+	Tag string
+	// Digest, if the reference is pinned to one
+	Digest string
+}
+
+// ParseImageReference parses an image reference the way the Docker CLI does. The first path
+// component is only taken as the registry host if it has a `.` or `:` or is `localhost`.
+func ParseImageReference(ref string) (ImageReference, error) {
+	var image ImageReference
+
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, image.Digest = name[:i], name[i+1:]
+		if !digestFormat.MatchString(image.Digest) {
+			return image, ErrInvalidImage
+		}
+	}
+
+	// a tag follows the last colon, unless that colon is part of the registry host
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i+1:], "/") {
+		name, image.Tag = name[:i], name[i+1:]
+		if !tagFormat.MatchString(image.Tag) {
+			return image, ErrInvalidImage
+		}
+	}
+
+	if image.Tag == "" && image.Digest == "" {
+		image.Tag = "latest"
+	}
+
+	image.Registry = DefaultRegistry
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			image.Registry, name = NormalizeRegistry(first), name[i+1:]
+		}
+	}
+
+	if name == "" {
+		return image, ErrInvalidImage
+	}
+	for _, component := range strings.Split(name, "/") {
+		if !repositoryComponent.MatchString(component) {
+			return image, ErrInvalidImage
+		}
+	}
+
+	// official images on Docker Hub live under library/
+	if image.Registry == DefaultRegistry && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	image.Repository = name
+
+	return image, nil
+}
+
+// NormalizeRegistry maps the aliases of Docker Hub to DefaultRegistry
+func NormalizeRegistry(registry string) string {
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return DefaultRegistry
+	}
+	return strings.ToLower(registry)
+}
+
+// Name returns the registry qualified repository, eg `docker.io/library/ubuntu`
+func (i ImageReference) Name() string {
+	return i.Registry + "/" + i.Repository
+}
+
+// PullTag returns what to pass as the tag when pulling, the digest if the reference has one
+func (i ImageReference) PullTag() string {
+	if i.Digest != "" {
+		return i.Digest
+	}
+	return i.Tag
+}
+
+// String returns the fully qualified reference. A digest takes precedence over a tag
+func (i ImageReference) String() string {
+	if i.Digest != "" {
+		return i.Name() + "@" + i.Digest
+	}
+	return i.Name() + ":" + i.Tag
+}
@@ -0,0 +1,48 @@
+package container
+
+import "testing"
+
+func TestParseImageReference(t *testing.T) {
+	const digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	tests := []struct {
+		ref     string
+		want    ImageReference
+		wantErr bool
+	}{
+		{ref: "ubuntu", want: ImageReference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "latest"}},
+		{ref: "ubuntu:18.04", want: ImageReference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "18.04"}},
+		{ref: "netsoc/app:v1", want: ImageReference{Registry: "docker.io", Repository: "netsoc/app", Tag: "v1"}},
+		{ref: "index.docker.io/netsoc/app", want: ImageReference{Registry: "docker.io", Repository: "netsoc/app", Tag: "latest"}},
+		{ref: "registry.example.com:5000/team/app:1.2", want: ImageReference{Registry: "registry.example.com:5000", Repository: "team/app", Tag: "1.2"}},
+		{ref: "registry.example.com:5000/team/app", want: ImageReference{Registry: "registry.example.com:5000", Repository: "team/app", Tag: "latest"}},
+		{ref: "localhost/app", want: ImageReference{Registry: "localhost", Repository: "app", Tag: "latest"}},
+		{ref: "ubuntu@" + digest, want: ImageReference{Registry: "docker.io", Repository: "library/ubuntu", Digest: digest}},
+		{ref: "ubuntu:18.04@" + digest, want: ImageReference{Registry: "docker.io", Repository: "library/ubuntu", Tag: "18.04", Digest: digest}},
+		{ref: "", wantErr: true},
+		{ref: "Ubuntu", wantErr: true},
+		{ref: "ubuntu:", wantErr: true},
+		{ref: "ubuntu:bad tag", wantErr: true},
+		{ref: "ubuntu@sha256:abc", wantErr: true},
+		{ref: "registry.example.com/", wantErr: true},
+		{ref: "team//app", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := ParseImageReference(tt.ref)
+			if tt.wantErr {
+				if err != ErrInvalidImage {
+					t.Fatalf("ParseImageReference(%q) error = %v, want %v", tt.ref, err, ErrInvalidImage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseImageReference(%q) error = %v", tt.ref, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseImageReference(%q) = %+v, want %+v", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package container
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrNoRolloutImage = errors.New("exactly one of image and tag must be set")
+	ErrInvalidTag     = errors.New("image tag bad format")
+)
+
+// RolloutRequest moves a running container to a new image
+type RolloutRequest struct {
+	// Image to move to
+	Image string `json:"image,omitempty"`
+
+	// Tag of the container's current image to move to, instead of Image
+	Tag string `json:"tag,omitempty"`
+}
+
+func (req *RolloutRequest) Bind(r *http.Request) error {
+	if (req.Image == "") == (req.Tag == "") {
+		return ErrNoRolloutImage
+	}
+
+	if req.Image != "" {
+		_, err := ParseImageReference(req.Image)
+		return err
+	}
+
+	if !tagFormat.MatchString(req.Tag) {
+		return ErrInvalidTag
+	}
+	return nil
+}
+
+// Resolve returns the image to move a container currently running current to
+func (req RolloutRequest) Resolve(current string) (string, error) {
+	if req.Image != "" {
+		return req.Image, nil
+	}
+
+	ref, err := ParseImageReference(current)
+	if err != nil {
+		return "", err
+	}
+	ref.Tag, ref.Digest = req.Tag, ""
+	return ref.String(), nil
+}
@@ -0,0 +1,70 @@
+package event
+
+import (
+	"errors"
+	"time"
+)
+
+// Type is the kind of an event
+type Type string
+
+// Types of events raised from the LXD and Docker event streams
+const (
+	// A Docker container exited, on its own or when stopped
+	ContainerDied Type = "container_died"
+	// The kernel OOM killer killed a process in a Docker container
+	ContainerOOMKilled Type = "container_oom_killed"
+	// A Docker container's healthcheck started failing
+	ContainerUnhealthy Type = "container_unhealthy"
+	// A Docker container's healthcheck started passing
+	ContainerHealthy Type = "container_healthy"
+	// A Docker container started, getting a new address on the project network
+	ContainerStarted Type = "container_started"
+	// A container host started
+	HostStarted Type = "host_started"
+	// A container host stopped or shut down
+	HostStopped Type = "host_stopped"
+)
+
+var types = []Type{ContainerDied, ContainerOOMKilled, ContainerUnhealthy, ContainerHealthy, ContainerStarted, HostStarted, HostStopped}
+
+var ErrInvalidType = errors.New("unknown event type")
+
+// Event is something that happened to a container host or one of its containers
+type Event struct {
+	// Sequence number, increasing in the order events were received
+	ID   uint64    `json:"id"`
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	// Container host the event is about or happened in
+	Host string `json:"host"`
+	// Namespace and name of the host's project, empty if the host couldnt be looked up
+	Namespace string `json:"namespace,omitempty"`
+	Project   string `json:"project,omitempty"`
+	// Name of the Docker container, empty for host events
+	Container string `json:"container,omitempty"`
+	// Exit code of a container that died
+	ExitCode *int   `json:"exitCode,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ParseType returns the type with the given name
+func ParseType(s string) (Type, error) {
+	for _, t := range types {
+		if string(t) == s {
+			return t, nil
+		}
+	}
+	return "", ErrInvalidType
+}
+
+// Abnormal reports whether the event is a sign something went wrong, rather than routine
+func (e Event) Abnormal() bool {
+	switch e.Type {
+	case ContainerDied:
+		return e.ExitCode == nil || *e.ExitCode != 0
+	case ContainerOOMKilled, ContainerUnhealthy, HostStopped:
+		return true
+	}
+	return false
+}
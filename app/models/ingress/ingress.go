@@ -0,0 +1,242 @@
+package ingress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+var (
+	ErrInvalidHostname = errors.New("ingress hostname bad format")
+	ErrInvalidPath     = errors.New("ingress path must start with / and cant contain whitespace, quotes, ; { or }")
+	ErrInvalidPort     = errors.New("ingress port must be between 1 and 65535")
+	ErrNoContainer     = errors.New("ingress rule needs a container")
+	ErrDuplicateRule   = errors.New("ingress rules must have a unique hostname and path")
+	ErrWildcardTLS     = errors.New("wildcard hostnames cant get ACME certificates over HTTP-01")
+)
+
+var (
+	hostname = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	// anything nginx would read as more than a single location prefix is rejected
+	locationPath = regexp.MustCompile(`^/[^\s"';{}\\]*$`)
+)
+
+// Rule routes HTTP requests for a hostname and path prefix to a port of one of the project's
+// containers
+type Rule struct {
+	Hostname string `json:"hostname"`
+
+	// Path prefix, / if empty
+	Path string `json:"path,omitempty"`
+
+	// Name of the container requests are proxied to
+	Container string `json:"container"`
+	Port      uint16 `json:"port"`
+
+	// Serve the hostname over HTTPS with an ACME certificate, redirecting HTTP to it. Applies to
+	// every rule with the same hostname
+	TLS bool `json:"tls,omitempty"`
+}
+
+// PathOrDefault returns the rule's path prefix, defaulting to /
+func (r Rule) PathOrDefault() string {
+	if r.Path == "" {
+		return "/"
+	}
+	return r.Path
+}
+
+func (r Rule) Validate() error {
+	if err := r.validate(); err != nil {
+		return fmt.Errorf("ingress rule %s%s: %w", r.Hostname, r.PathOrDefault(), err)
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	if !hostname.MatchString(r.Hostname) {
+		return ErrInvalidHostname
+	}
+
+	if !locationPath.MatchString(r.PathOrDefault()) {
+		return ErrInvalidPath
+	}
+
+	if r.Container == "" {
+		return ErrNoContainer
+	}
+
+	if r.Port == 0 {
+		return ErrInvalidPort
+	}
+
+	if r.TLS && strings.HasPrefix(r.Hostname, "*.") {
+		return ErrWildcardTLS
+	}
+	return nil
+}
+
+// Rules are the ingress rules of a project
+type Rules []Rule
+
+// Bind validates the rules of a request replacing a project's ingress rules
+func (rules *Rules) Bind(r *http.Request) error {
+	return rules.Validate()
+}
+
+func (rules Rules) Validate() error {
+	seen := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return err
+		}
+
+		key := rule.Hostname + rule.PathOrDefault()
+		if seen[key] {
+			return fmt.Errorf("%w: %s", ErrDuplicateRule, key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Hostnames returns every hostname the rules route, in order
+func (rules Rules) Hostnames() []string {
+	seen := make(map[string]bool)
+	hostnames := []string{}
+	for _, rule := range rules {
+		if !seen[rule.Hostname] {
+			seen[rule.Hostname] = true
+			hostnames = append(hostnames, rule.Hostname)
+		}
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+// TLSHostnames returns the hostnames served over HTTPS, in order
+func (rules Rules) TLSHostnames() []string {
+	seen := make(map[string]bool)
+	hostnames := []string{}
+	for _, rule := range rules {
+		if rule.TLS && !seen[rule.Hostname] {
+			seen[rule.Hostname] = true
+			hostnames = append(hostnames, rule.Hostname)
+		}
+	}
+	sort.Strings(hostnames)
+	return hostnames
+}
+
+// HostPaths are the locations in the container host of the files the config refers to
+type HostPaths struct {
+	// Directory ACME HTTP-01 challenge responses are served from, named by their token
+	ChallengeDir string
+	// Directory certificates are pushed to, as <hostname>.crt and <hostname>.key
+	CertDir string
+}
+
+var configTemplate = template.Must(template.New("ingress").Parse(`# Generated by windlass from the project's ingress rules, changes are overwritten
+{{- range .Servers}}
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name {{.Hostname}};
+
+    location ^~ /.well-known/acme-challenge/ {
+        alias {{$.Paths.ChallengeDir}}/;
+        default_type text/plain;
+    }
+{{- if .TLS}}
+
+    location / {
+        return 301 https://$host$request_uri;
+    }
+}
+
+server {
+    listen 443 ssl;
+    listen [::]:443 ssl;
+    server_name {{.Hostname}};
+
+    ssl_certificate {{$.Paths.CertDir}}/{{.Hostname}}.crt;
+    ssl_certificate_key {{$.Paths.CertDir}}/{{.Hostname}}.key;
+{{- end}}
+{{- range .Locations}}
+
+    location {{.Path}} {
+        proxy_pass http://{{.Upstream}};
+        proxy_http_version 1.1;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+{{- end}}
+}
+{{- end}}
+`))
+
+type server struct {
+	Hostname string
+	// Whether the server has a certificate to serve HTTPS with
+	TLS       bool
+	Locations []location
+}
+
+type location struct {
+	Path     string
+	Upstream string
+}
+
+// Config renders the rules as nginx server blocks, one per hostname. addrs maps the name of each
+// container the rules refer to to its address. TLS hostnames are only served over HTTPS once
+// certs has their certificate, until then they're served over HTTP so that one can be issued
+func (rules Rules) Config(addrs map[string]string, certs map[string]bool, paths HostPaths) ([]byte, error) {
+	byHost := make(map[string]*server)
+	for _, rule := range rules {
+		addr, ok := addrs[rule.Container]
+		if !ok {
+			return nil, fmt.Errorf("no address for container %s", rule.Container)
+		}
+
+		srv, ok := byHost[rule.Hostname]
+		if !ok {
+			srv = &server{Hostname: rule.Hostname}
+			byHost[rule.Hostname] = srv
+		}
+		srv.TLS = srv.TLS || (rule.TLS && certs[rule.Hostname])
+		srv.Locations = append(srv.Locations, location{
+			Path:     rule.PathOrDefault(),
+			Upstream: fmt.Sprintf("%s:%d", addr, rule.Port),
+		})
+	}
+
+	// sorted so that the same rules always render the same config
+	servers := make([]*server, 0, len(byHost))
+	for _, srv := range byHost {
+		sort.Slice(srv.Locations, func(i, j int) bool {
+			return srv.Locations[i].Path < srv.Locations[j].Path
+		})
+		servers = append(servers, srv)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].Hostname < servers[j].Hostname
+	})
+
+	var buf bytes.Buffer
+	err := configTemplate.Execute(&buf, struct {
+		Servers []*server
+		Paths   HostPaths
+	}{servers, paths})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,180 @@
+package ingress
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	paths := HostPaths{ChallengeDir: "/var/www/acme", CertDir: "/etc/nginx/certs"}
+
+	const challenge = `
+    location ^~ /.well-known/acme-challenge/ {
+        alias /var/www/acme/;
+        default_type text/plain;
+    }`
+
+	proxy := func(path, upstream string) string {
+		return `
+    location ` + path + ` {
+        proxy_pass http://` + upstream + `;
+        proxy_http_version 1.1;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }`
+	}
+
+	header := "# Generated by windlass from the project's ingress rules, changes are overwritten"
+
+	tests := []struct {
+		name    string
+		rules   Rules
+		addrs   map[string]string
+		certs   map[string]bool
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "no rules",
+			rules: Rules{},
+			want:  header + "\n",
+		},
+		{
+			name: "paths sorted within a hostname",
+			rules: Rules{
+				{Hostname: "example.com", Path: "/api/", Container: "api", Port: 8080},
+				{Hostname: "example.com", Container: "web", Port: 80},
+			},
+			addrs: map[string]string{"api": "172.18.0.3", "web": "172.18.0.2"},
+			want: header + `
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name example.com;
+` + challenge + `
+` + proxy("/", "172.18.0.2:80") + `
+` + proxy("/api/", "172.18.0.3:8080") + `
+}
+`,
+		},
+		{
+			name: "hostnames sorted",
+			rules: Rules{
+				{Hostname: "b.example.com", Container: "web", Port: 80},
+				{Hostname: "a.example.com", Container: "web", Port: 80},
+			},
+			addrs: map[string]string{"web": "172.18.0.2"},
+			want: header + `
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name a.example.com;
+` + challenge + `
+` + proxy("/", "172.18.0.2:80") + `
+}
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name b.example.com;
+` + challenge + `
+` + proxy("/", "172.18.0.2:80") + `
+}
+`,
+		},
+		{
+			name: "tls without a certificate yet is served over http",
+			rules: Rules{
+				{Hostname: "example.com", Container: "web", Port: 80, TLS: true},
+			},
+			addrs: map[string]string{"web": "172.18.0.2"},
+			want: header + `
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name example.com;
+` + challenge + `
+` + proxy("/", "172.18.0.2:80") + `
+}
+`,
+		},
+		{
+			name: "tls redirects to https",
+			rules: Rules{
+				{Hostname: "example.com", Container: "web", Port: 80, TLS: true},
+			},
+			addrs: map[string]string{"web": "172.18.0.2"},
+			certs: map[string]bool{"example.com": true},
+			want: header + `
+
+server {
+    listen 80;
+    listen [::]:80;
+    server_name example.com;
+` + challenge + `
+
+    location / {
+        return 301 https://$host$request_uri;
+    }
+}
+
+server {
+    listen 443 ssl;
+    listen [::]:443 ssl;
+    server_name example.com;
+
+    ssl_certificate /etc/nginx/certs/example.com.crt;
+    ssl_certificate_key /etc/nginx/certs/example.com.key;
+` + proxy("/", "172.18.0.2:80") + `
+}
+`,
+		},
+		{
+			name: "missing address",
+			rules: Rules{
+				{Hostname: "example.com", Container: "web", Port: 80},
+			},
+			addrs:   map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rules.Config(tt.addrs, tt.certs, paths)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Config() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Config() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Config() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostnames(t *testing.T) {
+	rules := Rules{
+		{Hostname: "b.example.com", Path: "/api/", TLS: true},
+		{Hostname: "b.example.com"},
+		{Hostname: "a.example.com"},
+		{Hostname: "c.example.com", TLS: true},
+	}
+
+	if got, want := strings.Join(rules.Hostnames(), ","), "a.example.com,b.example.com,c.example.com"; got != want {
+		t.Errorf("Hostnames() = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(rules.TLSHostnames(), ","), "b.example.com,c.example.com"; got != want {
+		t.Errorf("TLSHostnames() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package migration
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+)
+
+var (
+	ErrNoWorker    = errors.New("target worker missing")
+	ErrNoHost      = errors.New("container host name missing")
+	ErrNoOperation = errors.New("migration source operation missing")
+)
+
+// Request to move a project's container host to another worker
+type Request struct {
+	// Hostname of the worker to move the project to, as registered with Consul
+	Worker string `json:"worker"`
+
+	// Migrate the host while it is running. Requires CRIU on both LXD servers,
+	// otherwise the host is stopped for the duration of the move
+	Live bool `json:"live"`
+
+	// Where the target worker should create the host
+	Placement project.Placement `json:"placement"`
+}
+
+func (m *Request) Bind(r *http.Request) error {
+	if m.Worker == "" {
+		return ErrNoWorker
+	}
+	return nil
+}
+
+// Source describes a container host that is waiting to be pulled by another LXD server
+type Source struct {
+	// https addresses the source LXD server listens on
+	Addresses []string `json:"addresses"`
+	// ID of the migration operation on the source LXD server
+	Operation string `json:"operation"`
+	// PEM encoded certificate of the source LXD server
+	Certificate string            `json:"certificate"`
+	Secrets     map[string]string `json:"secrets"`
+	Live        bool              `json:"live"`
+
+	// Container config to create the host with on the target
+	BaseImage    string                       `json:"baseImage"`
+	Architecture string                       `json:"architecture"`
+	Config       map[string]string            `json:"config"`
+	Devices      map[string]map[string]string `json:"devices"`
+	Profiles     []string                     `json:"profiles"`
+}
+
+// Incoming is sent by the source worker to the target worker of a migration
+type Incoming struct {
+	// Name of the container host being moved
+	Host string `json:"host"`
+
+	Placement project.Placement `json:"placement"`
+	Source    Source            `json:"source"`
+}
+
+func (m *Incoming) Bind(r *http.Request) error {
+	if m.Host == "" {
+		return ErrNoHost
+	}
+	if m.Source.Operation == "" {
+		return ErrNoOperation
+	}
+	return nil
+}
@@ -2,16 +2,21 @@ package project
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"regexp"
 	"time"
 
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/ingress"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/volume"
 )
 
 var (
 	ErrInvalidFormat = errors.New("project name bad format")
 	ErrNameTooLong   = errors.New("project name too long")
+	ErrUnknownVolume = errors.New("mounts a volume not declared by the project")
+	ErrUnknownTarget = errors.New("routes to a container not declared by the project")
 )
 
 var (
@@ -22,15 +27,77 @@ type Project struct {
 	Name         string               `json:"name"`
 	Namespace    string               `json:"namespace"`
 	Containers   container.Containers `json:"containers"`
+	Volumes      []volume.Volume      `json:"volumes,omitempty"`
+	Ingress      ingress.Rules        `json:"ingress,omitempty"`
+	Placement    Placement            `json:"placement"`
 	CreationDate time.Time            `json:"createdAt"`
 	UpdatedDate  time.Time            `json:"updatedAt"`
 }
 
+// Placement selects where the project's container host is created
+type Placement struct {
+	// Name of the LXD remote, the worker's default remote if empty
+	Remote string `json:"remote,omitempty"`
+
+	// Cluster member of the remote, left for LXD to choose if empty
+	Target string `json:"target,omitempty"`
+}
+
 func (p Project) HostName() string {
 	return p.Namespace + "-" + p.Name
 }
 
 func (p *Project) Bind(r *http.Request) error {
+	if err := p.ValidateName(); err != nil {
+		return err
+	}
+
+	return p.Validate()
+}
+
+// Validate checks the project's containers, volumes and ingress rules
+func (p Project) Validate() error {
+	if err := p.Containers.Validate(); err != nil {
+		return err
+	}
+
+	volumes := make(map[string]bool, len(p.Volumes))
+	for _, vol := range p.Volumes {
+		if err := vol.Validate(); err != nil {
+			return err
+		}
+		if volumes[vol.Name] {
+			return fmt.Errorf("volume %s: %w", vol.Name, volume.ErrDuplicateName)
+		}
+		volumes[vol.Name] = true
+	}
+
+	for _, ctr := range p.Containers {
+		for _, mount := range ctr.Mounts {
+			if mount.Volume != "" && !volumes[mount.Volume] {
+				return fmt.Errorf("container %s: %w: %s", ctr.Name, ErrUnknownVolume, mount.Volume)
+			}
+		}
+	}
+
+	if err := p.Ingress.Validate(); err != nil {
+		return err
+	}
+
+	containers := make(map[string]bool, len(p.Containers))
+	for _, ctr := range p.Containers {
+		containers[ctr.Name] = true
+	}
+	for _, rule := range p.Ingress {
+		if !containers[rule.Container] {
+			return fmt.Errorf("ingress rule %s%s: %w: %s", rule.Hostname, rule.PathOrDefault(), ErrUnknownTarget, rule.Container)
+		}
+	}
+	return nil
+}
+
+// ValidateName checks that the namespace and name make a valid container host name
+func (p Project) ValidateName() error {
 	if !projectName.MatchString(p.HostName()) {
 		return ErrInvalidFormat
 	}
@@ -0,0 +1,29 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrNoCredentials = errors.New("registry username and password or identity token missing")
+)
+
+// Credential authenticates image pulls from a private registry for every project in a namespace
+type Credential struct {
+	// Registry host, including the port if any. Set from the URL
+	Registry string `json:"registry"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	// Token issued by the registry, used instead of a username and password
+	IdentityToken string `json:"identityToken,omitempty"`
+}
+
+func (c *Credential) Bind(r *http.Request) error {
+	if c.IdentityToken == "" && (c.Username == "" || c.Password == "") {
+		return ErrNoCredentials
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package snapshot
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	cron "gopkg.in/robfig/cron.v2"
+)
+
+// ScheduledPrefix is prepended to the names of snapshots taken by a Policy.
+// Only snapshots with this prefix are pruned by the policy's retention count
+const ScheduledPrefix = "auto-"
+
+var (
+	ErrInvalidName   = errors.New("snapshot name bad format")
+	ErrReservedName  = errors.New("snapshot names starting with " + ScheduledPrefix + " are reserved for scheduled snapshots")
+	ErrNoSchedule    = errors.New("snapshot policy schedule missing")
+	ErrInvalidRetain = errors.New("snapshot policy must retain at least one snapshot")
+)
+
+var (
+	snapshotName = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9\-_.])*$`)
+)
+
+type Snapshot struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Whether the snapshot includes the host's running state
+	Stateful bool `json:"stateful"`
+
+	// Whether the snapshot was taken by the project's snapshot policy
+	Scheduled bool `json:"scheduled"`
+}
+
+// Request to create a snapshot of a project's container host
+type CreateRequest struct {
+	Name     string `json:"name"`
+	Stateful bool   `json:"stateful"`
+}
+
+func (c *CreateRequest) Bind(r *http.Request) error {
+	if !snapshotName.MatchString(c.Name) {
+		return ErrInvalidName
+	}
+
+	if strings.HasPrefix(c.Name, ScheduledPrefix) {
+		return ErrReservedName
+	}
+
+	return nil
+}
+
+// Request to restore a project's container host to a snapshot
+type RestoreRequest struct {
+	// Restore the running state too, the snapshot must be stateful
+	Stateful bool `json:"stateful"`
+}
+
+func (rr *RestoreRequest) Bind(r *http.Request) error {
+	return nil
+}
+
+// Policy describes when a project's container host is snapshotted and how many
+// scheduled snapshots are kept
+type Policy struct {
+	// Cron spec, eg `@daily` or `0 30 3 * * *`
+	Schedule string `json:"schedule"`
+
+	// Number of scheduled snapshots to keep, the oldest are deleted first
+	Retain int `json:"retain"`
+
+	// Whether scheduled snapshots include the host's running state
+	Stateful bool `json:"stateful"`
+}
+
+func (p *Policy) Bind(r *http.Request) error {
+	if p.Schedule == "" {
+		return ErrNoSchedule
+	}
+
+	if _, err := cron.Parse(p.Schedule); err != nil {
+		return err
+	}
+
+	if p.Retain < 1 {
+		return ErrInvalidRetain
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package volume
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Backends a volume can be stored on
+const (
+	// An LXD custom storage volume attached to the container host, the default
+	BackendLXD = "lxd"
+	// A Docker volume inside the container host. Docker volumes cant have a size quota
+	BackendDocker = "docker"
+)
+
+var (
+	ErrInvalidName    = errors.New("volume name bad format")
+	ErrInvalidBackend = errors.New("volume backend must be lxd or docker")
+	ErrInvalidSize    = errors.New("volume size bad format, eg 10GB")
+	ErrDockerQuota    = errors.New("docker volumes cant have a size quota")
+	ErrDuplicateName  = errors.New("volume names must be unique within a project")
+)
+
+var (
+	volumeName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+	volumeSize = regexp.MustCompile(`^[0-9]+(B|kB|MB|GB|TB|KiB|MiB|GiB|TiB)?$`)
+)
+
+// Volume is a named volume declared by a project. Volumes outlive the containers that mount them
+type Volume struct {
+	Name string `json:"name"`
+
+	// lxd or docker, lxd if empty
+	Backend string `json:"backend,omitempty"`
+
+	// Size quota eg `10GB`, unlimited if empty
+	Size string `json:"size,omitempty"`
+}
+
+// BackendOrDefault returns the volume's backend, defaulting to lxd
+func (v Volume) BackendOrDefault() string {
+	if v.Backend == "" {
+		return BackendLXD
+	}
+	return v.Backend
+}
+
+func (v Volume) Validate() error {
+	if err := v.validate(); err != nil {
+		return fmt.Errorf("volume %s: %w", v.Name, err)
+	}
+	return nil
+}
+
+func (v Volume) validate() error {
+	if !volumeName.MatchString(v.Name) {
+		return ErrInvalidName
+	}
+
+	switch v.BackendOrDefault() {
+	case BackendLXD:
+	case BackendDocker:
+		if v.Size != "" {
+			return ErrDockerQuota
+		}
+	default:
+		return ErrInvalidBackend
+	}
+
+	if v.Size != "" && !volumeSize.MatchString(v.Size) {
+		return ErrInvalidSize
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// EventType is the kind of event a webhook is sent
+type EventType string
+
+// Events webhooks can subscribe to
+const (
+	ProjectCreated         EventType = "project.created"
+	ProjectCreationFailed  EventType = "project.creation_failed"
+	ProjectDeleted         EventType = "project.deleted"
+	ContainerCrashed       EventType = "container.crashed"
+	ContainerHealthChanged EventType = "container.health_changed"
+)
+
+var EventTypes = []EventType{ProjectCreated, ProjectCreationFailed, ProjectDeleted, ContainerCrashed, ContainerHealthChanged}
+
+// Statuses of a delivery
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	// Every attempt failed. The delivery is kept as a dead letter until it is redelivered
+	StatusFailed = "failed"
+)
+
+var (
+	ErrInvalidURL       = errors.New("webhook url must be an absolute http or https URL")
+	ErrInvalidEvent     = errors.New("unknown webhook event")
+	ErrInvalidNamespace = errors.New("namespace bad format")
+	ErrSecretTooShort   = errors.New("webhook secret must be at least 16 characters")
+)
+
+var namespaceFormat = regexp.MustCompile(`^[A-Za-z]([A-Za-z0-9\-])*$`)
+
+// minimum length of a secret given when registering a webhook
+const minSecretLength = 16
+
+// Webhook is a URL that is sent events as they happen
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Only events of this namespace's projects are sent, or of every namespace if empty
+	Namespace string `json:"namespace,omitempty"`
+	// Events the webhook is sent, all of them if empty
+	Events []EventType `json:"events,omitempty"`
+	// Key payloads are signed with, generated if not given. Only returned when registering
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (hook *Webhook) Bind(r *http.Request) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+
+	if hook.Namespace != "" && !namespaceFormat.MatchString(hook.Namespace) {
+		return ErrInvalidNamespace
+	}
+
+	for _, ev := range hook.Events {
+		if !validEvent(ev) {
+			return ErrInvalidEvent
+		}
+	}
+
+	if hook.Secret != "" && len(hook.Secret) < minSecretLength {
+		return ErrSecretTooShort
+	}
+	return nil
+}
+
+func validEvent(ev EventType) bool {
+	for _, t := range EventTypes {
+		if t == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// Wants reports whether the webhook is sent a payload
+func (hook Webhook) Wants(payload Payload) bool {
+	if hook.Namespace != "" && hook.Namespace != payload.Namespace {
+		return false
+	}
+
+	if len(hook.Events) == 0 {
+		return true
+	}
+	for _, ev := range hook.Events {
+		if ev == payload.Event {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON body sent to webhooks
+type Payload struct {
+	Event     EventType `json:"event"`
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Project   string    `json:"project"`
+	Container string    `json:"container,omitempty"`
+	// Details depending on the event, such as the error a creation failed with
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Delivery is a payload being or having been sent to a webhook
+type Delivery struct {
+	ID      string `json:"id"`
+	Webhook string `json:"webhook"`
+	// Worker sending the delivery, which resumes it if restarted while it is pending
+	Worker    string    `json:"worker"`
+	Payload   Payload   `json:"payload"`
+	Status    string    `json:"status"`
+	Attempts  []Attempt `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Attempt is a single try at sending a delivery
+type Attempt struct {
+	Time time.Time `json:"time"`
+	// Response status, 0 if there was no response
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,32 @@
+package backupstorage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+)
+
+// BackupStorageRepo stores project host export archives
+type BackupStorageRepo interface {
+	Put(ctx context.Context, key string, archive io.Reader, size int64) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns the keys of all stored archives with the given prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+func NewBackupStorageRepo() BackupStorageRepo {
+	switch storage := viper.GetString("backup.storage"); storage {
+	case "local":
+		return NewLocalBackupStorageRepo(viper.GetString("backup.local.path"))
+	case "s3":
+		repo, err := NewS3BackupStorageRepo()
+		if err != nil {
+			panic(fmt.Errorf("failed to get backup storage repo: %w", err))
+		}
+		return repo
+	default:
+		panic(fmt.Sprintf("invalid backup storage %s", storage))
+	}
+}
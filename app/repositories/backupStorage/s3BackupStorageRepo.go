@@ -0,0 +1,80 @@
+package backupstorage
+
+import (
+	"context"
+	"io"
+
+	minio "github.com/minio/minio-go"
+	"github.com/spf13/viper"
+)
+
+// s3BackupStorageRepo stores archives in any S3 compatible object store, eg MinIO
+type s3BackupStorageRepo struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3BackupStorageRepo() (BackupStorageRepo, error) {
+	client, err := minio.New(
+		viper.GetString("backup.s3.endpoint"),
+		viper.GetString("backup.s3.accessKey"),
+		viper.GetString("backup.s3.secretKey"),
+		viper.GetBool("backup.s3.useSSL"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := viper.GetString("backup.s3.bucket")
+
+	exists, err := client.BucketExists(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		if err := client.MakeBucket(bucket, viper.GetString("backup.s3.region")); err != nil {
+			return nil, err
+		}
+	}
+
+	return &s3BackupStorageRepo{
+		client: client,
+		bucket: bucket,
+	}, nil
+}
+
+func (s *s3BackupStorageRepo) Put(ctx context.Context, key string, archive io.Reader, size int64) error {
+	_, err := s.client.PutObjectWithContext(ctx, s.bucket, key, archive, size, minio.PutObjectOptions{
+		ContentType: "application/x-tar",
+	})
+	return err
+}
+
+func (s *s3BackupStorageRepo) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObjectWithContext(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject is lazy, stat it so a missing key is an error here rather than on first read
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *s3BackupStorageRepo) List(ctx context.Context, prefix string) ([]string, error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	keys := []string{}
+	for object := range s.client.ListObjectsV2(s.bucket, prefix, true, done) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		keys = append(keys, object.Key)
+	}
+	return keys, nil
+}
@@ -3,23 +3,74 @@ package host
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/event"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/migration"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/registry"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/snapshot"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/volume"
 
 	"github.com/spf13/viper"
 )
 
 type ContainerHostRepository interface {
-	Ping(ctx context.Context) error
-	UseCerts(clientKeyPEM, clientCertPEM, caPEM []byte)
+	Ping(ctx context.Context, name string) error
+	EnsureNetworks(ctx context.Context) error
+	ListRemotes(ctx context.Context) ([]Remote, error)
+	EnsureBaseImage(ctx context.Context) error
+	RefreshBaseImage(ctx context.Context) error
+	ListBaseImages(ctx context.Context) ([]BaseImage, error)
+	ListHostImages(ctx context.Context) ([]HostImage, error)
+	CreateSnapshot(ctx context.Context, opts SnapshotCreateOptions) error
+	ListSnapshots(ctx context.Context, name string) ([]snapshot.Snapshot, error)
+	DeleteSnapshot(ctx context.Context, opts SnapshotOptions) error
+	RestoreSnapshot(ctx context.Context, opts SnapshotRestoreOptions) error
+	HostExists(ctx context.Context, name string) (bool, error)
+	ListContainerHosts(ctx context.Context) ([]string, error)
+	ExportContainerHost(ctx context.Context, name string, w io.WriteSeeker) error
+	ImportContainerHost(ctx context.Context, opts ContainerHostImportOptions) error
+	MigrateContainerHost(ctx context.Context, opts ContainerHostMigrateOptions, transfer func(migration.Source) error) error
+	ReceiveContainerHost(ctx context.Context, opts ContainerHostReceiveOptions) error
+	UseCertSource(certs CertSource)
 	GetContainerHostIP(ctx context.Context, name string) (string, error)
 	CreateContainerHost(ctx context.Context, opts ContainerHostCreateOptions) error
 	DeleteContainerHost(ctx context.Context, opts ContainerHostDeleteOptions) error
+	ReleaseNamespaceNetwork(ctx context.Context, opts NamespaceNetworkOptions) error
 	StartContainerHost(ctx context.Context, opts ContainerHostStartOptions) error
 	StopContainerHost(ctx context.Context, opts ContainerHostStopOptions) error
+	IsContainerHostRunning(ctx context.Context, name string) (bool, error)
 	PushAuthCerts(ctx context.Context, opts ContainerPushCertsOptions, caPEM, serverKeyPEM, serverCertPEM []byte) error
 	RestartNGINX(ctx context.Context, name string) error
-	CreateContainer(ctx context.Context, ctr container.Container) error
+	EnsureProjectNetwork(ctx context.Context, name string) error
+	PullImage(ctx context.Context, opts ImagePullOptions) error
+	CreateContainer(ctx context.Context, opts ContainerCreateOptions) error
+	WaitForContainer(ctx context.Context, opts ContainerWaitOptions) error
+	ListContainers(ctx context.Context, name string) ([]Container, error)
+	GetContainerHostStats(ctx context.Context, name string) (*HostStats, error)
+	GetContainerStats(ctx context.Context, name string) ([]ContainerStats, error)
+	WatchContainerHostEvents(ctx context.Context, handle func(event.Event)) error
+	WatchContainerEvents(ctx context.Context, name string, handle func(event.Event)) error
+	RemoveContainer(ctx context.Context, opts ContainerRemoveOptions) error
+	InspectContainer(ctx context.Context, opts ContainerInspectOptions) (*Container, error)
+	CloneContainer(ctx context.Context, opts ContainerCloneOptions) error
+	RenameContainer(ctx context.Context, opts ContainerRenameOptions) error
+	StartContainer(ctx context.Context, opts ContainerStartOptions) error
+	StopContainer(ctx context.Context, opts ContainerStopOptions) error
+	SetContainerAlias(ctx context.Context, opts ContainerAliasOptions) error
+	EnsureVolume(ctx context.Context, opts VolumeOptions) error
+	ListVolumes(ctx context.Context, name string) ([]volume.Volume, error)
+	DeleteVolume(ctx context.Context, opts VolumeDeleteOptions) error
+	PushFiles(ctx context.Context, opts FilePushOptions) error
+	PullFiles(ctx context.Context, opts FilePullOptions, w io.Writer) error
+	OpenConsole(ctx context.Context, opts ConsoleOptions) (int, error)
+	ApplyNginxConfig(ctx context.Context, opts NginxConfigOptions) error
+	PushIngressCert(ctx context.Context, opts IngressCertOptions) error
+	PutACMEChallenge(ctx context.Context, opts ACMEChallengeOptions) error
+	DeleteACMEChallenge(ctx context.Context, opts ACMEChallengeOptions) error
 }
 
 func NewContainerHostRepository() ContainerHostRepository {
@@ -31,16 +82,141 @@ func NewContainerHostRepository() ContainerHostRepository {
 	panic(fmt.Sprintf("invalid container host %s", hostProvider))
 }
 
+// Remote is an LXD endpoint the worker can create container hosts on
+type Remote struct {
+	Name      string         `json:"name"`
+	Default   bool           `json:"default"`
+	Clustered bool           `json:"clustered"`
+	Members   []RemoteMember `json:"members,omitempty"`
+}
+
+// RemoteMember is a single member of a clustered remote, usable as a create target
+type RemoteMember struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Status string `json:"status"`
+}
+
+// BaseImage is a version of the base image container hosts are created from
+type BaseImage struct {
+	Remote      string    `json:"remote"`
+	Fingerprint string    `json:"fingerprint"`
+	Current     bool      `json:"current"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+}
+
+// HostImage records which base image a container host was created from
+type HostImage struct {
+	Host        string `json:"host"`
+	Remote      string `json:"remote"`
+	Alias       string `json:"alias"`
+	Fingerprint string `json:"fingerprint"`
+	// Current is false if the alias has since moved to a newer image
+	Current bool `json:"current"`
+}
+
+// HostStats is the resource usage of a container host as reported by LXD
+type HostStats struct {
+	Namespace string `json:"namespace"`
+	Project   string `json:"project"`
+	Status    string `json:"status"`
+	// CPU time used since the host started
+	CPUSeconds  float64                    `json:"cpuSeconds"`
+	MemoryBytes int64                      `json:"memoryBytes"`
+	SwapBytes   int64                      `json:"swapBytes"`
+	Processes   int64                      `json:"processes"`
+	DiskBytes   map[string]int64           `json:"diskBytes"`
+	Network     map[string]NetworkCounters `json:"network"`
+}
+
+// NetworkCounters are the traffic counters of a network interface
+type NetworkCounters struct {
+	RxBytes   int64 `json:"rxBytes"`
+	TxBytes   int64 `json:"txBytes"`
+	RxPackets int64 `json:"rxPackets"`
+	TxPackets int64 `json:"txPackets"`
+}
+
+// ContainerStats is the resource usage of a Docker container as reported by Docker
+type ContainerStats struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	// CPU usage since the previous sample, 100 per fully used core
+	CPUPercent float64 `json:"cpuPercent"`
+	// CPU time used since the container started
+	CPUSeconds       float64         `json:"cpuSeconds"`
+	MemoryBytes      int64           `json:"memoryBytes"`
+	MemoryLimitBytes int64           `json:"memoryLimitBytes"`
+	BlockReadBytes   int64           `json:"blockReadBytes"`
+	BlockWriteBytes  int64           `json:"blockWriteBytes"`
+	PIDs             int64           `json:"pids"`
+	Network          NetworkCounters `json:"network"`
+}
+
+// Container is a Docker container on a container host
+type Container struct {
+	ID     string                  `json:"id"`
+	Name   string                  `json:"name"`
+	Image  string                  `json:"image"`
+	State  string                  `json:"state"`
+	Labels map[string]string       `json:"labels"`
+	Ports  []container.PortMapping `json:"ports"`
+	// Whether the container has a Docker healthcheck, only set by InspectContainer
+	Healthcheck bool `json:"-"`
+	// Address on the project network while running, only set by InspectContainer
+	IPAddress string `json:"-"`
+}
+
 type ContainerName struct {
 	Name string
 }
 
 type ContainerHostCreateOptions struct {
 	ContainerName
+	// Namespace the host belongs to, used for network isolation
+	Namespace string
+	// Project name within the namespace
+	Project string
+	// LXD remote to create the host on, the default remote if empty
+	Remote string
+	// Cluster member of Remote to create the host on, left to LXD if empty
+	Target string
+}
+
+type ContainerHostImportOptions struct {
+	ContainerName
+	// LXD remote to import the host on, the default remote if empty
+	Remote string
+	// LXD backup tarball as written by ExportContainerHost
+	Backup io.Reader
+}
+
+type ContainerHostMigrateOptions struct {
+	ContainerName
+	// Migrate the host while it is running, rather than stopping it first
+	Live bool
+}
+
+type ContainerHostReceiveOptions struct {
+	ContainerName
+	// LXD remote to create the host on, the default remote if empty
+	Remote string
+	// Cluster member of Remote to create the host on, left to LXD if empty
+	Target string
+	// Migration source as passed to the transfer func of MigrateContainerHost
+	Source migration.Source
 }
 
 type ContainerHostDeleteOptions struct {
 	ContainerName
+	// Also delete the LXD custom volumes backing the project's volumes
+	DeleteVolumes bool
+}
+
+type NamespaceNetworkOptions struct {
+	Namespace string
+	// LXD remote the namespace's network is on, the default remote if empty
+	Remote string
 }
 
 type ContainerHostStopOptions struct {
@@ -54,3 +230,186 @@ type ContainerHostStartOptions struct {
 type ContainerPushCertsOptions struct {
 	ContainerName
 }
+
+type ImagePullOptions struct {
+	// Container host to pull the image on
+	ContainerName
+	Image string
+	// Credentials for the registry the image is pulled from, nil for public images
+	RegistryAuth *registry.Credential
+}
+
+type ContainerCreateOptions struct {
+	// Container host to create the container on
+	ContainerName
+	Container container.Container
+	// The project's volumes, which the container's mounts may refer to by name
+	Volumes []volume.Volume
+}
+
+type ContainerWaitOptions struct {
+	// Container host the container is on
+	ContainerName
+	// Name or ID of the container
+	Container string
+	// TCP port within the container that must accept connections, if it has no healthcheck
+	ProbePort uint16
+}
+
+type ContainerInspectOptions struct {
+	// Container host the container is on
+	ContainerName
+	// Name or ID of the container
+	Container string
+}
+
+type ContainerCloneOptions struct {
+	// Container host the container is on
+	ContainerName
+	// Name or ID of the container to clone
+	Container string
+	// Name of the clone
+	As string
+	// Image of the clone, the same as the container's if empty
+	Image string
+	// Leave the clone's ports unbound on the host, so that it can run next to the container
+	Unpublished bool
+	// Network alias of the clone on the project network, none if empty
+	Alias string
+	// Only create the clone, leaving it to be started with StartContainer
+	CreateOnly bool
+}
+
+type ContainerRenameOptions struct {
+	// Container host the container is on
+	ContainerName
+	// Name or ID of the container
+	Container string
+	NewName   string
+}
+
+type ContainerStartOptions struct {
+	// Container host the container is on
+	ContainerName
+	// Name or ID of the container
+	Container string
+}
+
+type ContainerStopOptions struct {
+	// Container host the container is on
+	ContainerName
+	// Name or ID of the container
+	Container string
+}
+
+type ContainerAliasOptions struct {
+	// Container host the container is on
+	ContainerName
+	// Name or ID of the container
+	Container string
+	// Network alias of the container on the project network
+	Alias string
+}
+
+type ContainerRemoveOptions struct {
+	// Container host the container is on
+	ContainerName
+	// Name or ID of the container
+	Container string
+	// Keep the container's anonymous volumes rather than removing them with it
+	KeepVolumes bool
+}
+
+type VolumeOptions struct {
+	// Container host the volume belongs to
+	ContainerName
+	Volume volume.Volume
+}
+
+type VolumeDeleteOptions struct {
+	// Container host the volume belongs to
+	ContainerName
+	// Name of the volume
+	Volume string
+}
+
+type FilePushOptions struct {
+	// Container host the files are pushed to
+	ContainerName
+	// Name or ID of the Docker container to push into, the container host itself if empty
+	Container string
+	// Absolute path of the existing directory the archive is extracted into
+	Path string
+	// Tar stream of the files, directories and symlinks to push
+	Archive io.Reader
+	// Owner of every pushed entry, as in the archive if nil
+	UID, GID *int64
+	// Permissions of every pushed file, as in the archive if nil. Directories keep theirs
+	Mode *os.FileMode
+}
+
+type FilePullOptions struct {
+	// Container host the files are pulled from
+	ContainerName
+	// Name or ID of the Docker container to pull from, the container host itself if empty
+	Container string
+	// Absolute path of the file or directory to pull
+	Path string
+}
+
+// TerminalSize is the size of a console's terminal in characters
+type TerminalSize struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type ConsoleOptions struct {
+	// Container host to open the shell in
+	ContainerName
+	// Initial size of the terminal
+	Size TerminalSize
+	// Terminal input, the shell is hung up once it is closed
+	Stdin io.ReadCloser
+	// Terminal output, stdout and stderr combined as in a TTY
+	Stdout io.WriteCloser
+	// New sizes of the terminal for the life of the session
+	Resize <-chan TerminalSize
+}
+
+type NginxConfigOptions struct {
+	// Container host whose nginx is configured
+	ContainerName
+	// Contents of the managed config file, replacing the previous contents
+	Config []byte
+}
+
+type IngressCertOptions struct {
+	// Container host whose nginx serves the certificate
+	ContainerName
+	Hostname string
+	// PEM encoded certificate chain and private key
+	CertPEM, KeyPEM []byte
+}
+
+type ACMEChallengeOptions struct {
+	// Container host whose nginx answers the challenge
+	ContainerName
+	Token string
+	// Response to the challenge, unused when deleting it
+	KeyAuth string
+}
+
+type SnapshotOptions struct {
+	ContainerName
+	Snapshot string
+}
+
+type SnapshotCreateOptions struct {
+	SnapshotOptions
+	Stateful bool
+}
+
+type SnapshotRestoreOptions struct {
+	SnapshotOptions
+	Stateful bool
+}
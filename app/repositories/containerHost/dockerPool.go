@@ -0,0 +1,127 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Strum355/log"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/spf13/viper"
+)
+
+var errNoCertSource = errors.New("no cert source set for Docker clients")
+
+// CertSource returns the client cert, key and CA for talking to a container host's Docker daemon
+type CertSource func(ctx context.Context, name string) (clientKeyPEM, clientCertPEM, caPEM []byte, err error)
+
+// dockerPool holds a Docker client per container host. Clients are built on first use from
+// the host's certs and IP, and evicted once the host fails `docker.pool.maxFailures` health
+// checks in a row or its certs change, so that the next use rebuilds them.
+type dockerPool struct {
+	certs  CertSource
+	hostIP func(ctx context.Context, name string) (string, error)
+
+	mu      *sync.Mutex
+	clients map[string]*pooledClient
+}
+
+type pooledClient struct {
+	client   *docker.Client
+	failures int
+}
+
+func newDockerPool(hostIP func(ctx context.Context, name string) (string, error)) *dockerPool {
+	return &dockerPool{
+		hostIP:  hostIP,
+		mu:      new(sync.Mutex),
+		clients: make(map[string]*pooledClient),
+	}
+}
+
+func (p *dockerPool) useCertSource(certs CertSource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.certs = certs
+	p.clients = make(map[string]*pooledClient)
+}
+
+// get returns the Docker client for a container host, building it if there isnt one
+func (p *dockerPool) get(ctx context.Context, name string) (*docker.Client, error) {
+	p.mu.Lock()
+	pooled, ok := p.clients[name]
+	certs := p.certs
+	p.mu.Unlock()
+
+	if ok {
+		return pooled.client, nil
+	}
+
+	if certs == nil {
+		return nil, errNoCertSource
+	}
+
+	// built without holding the lock as it talks to cert storage and LXD
+	clientKeyPEM, clientCertPEM, caPEM, err := certs(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ip, err := p.hostIP(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := docker.NewTLSClientFromBytes("https://"+ip, clientCertPEM, clientKeyPEM, caPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// another caller may have built one in the meantime
+	if pooled, ok := p.clients[name]; ok {
+		return pooled.client, nil
+	}
+	p.clients[name] = &pooledClient{client: client}
+
+	log.WithFields(log.Fields{
+		"containerHost": name,
+		"ip":            ip,
+	}).Debug("created Docker client")
+
+	return client, nil
+}
+
+// observe records the result of a health check against a container host's Docker daemon
+func (p *dockerPool) observe(name string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pooled, ok := p.clients[name]
+	if !ok {
+		return
+	}
+
+	if err == nil {
+		pooled.failures = 0
+		return
+	}
+
+	pooled.failures++
+	if pooled.failures >= viper.GetInt("docker.pool.maxFailures") {
+		log.WithError(err).WithFields(log.Fields{
+			"containerHost": name,
+			"failures":      pooled.failures,
+		}).Warn("evicting unhealthy Docker client")
+		delete(p.clients, name)
+	}
+}
+
+// evict drops the client for a container host, such as when its certs or IP change
+func (p *dockerPool) evict(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.clients, name)
+}
@@ -18,5 +18,28 @@ func (e Error) Error() string {
 }
 
 var (
-	ErrHostExists error = newError("container host aleady exists", http.StatusConflict)
+	ErrHostExists        error = newError("container host aleady exists", http.StatusConflict)
+	ErrHostNotFound      error = newError("container host not found", http.StatusNotFound)
+	ErrUnknownRemote     error = newError("unknown LXD remote", http.StatusBadRequest)
+	ErrNotClustered      error = newError("LXD remote is not clustered, cannot target a member", http.StatusBadRequest)
+	ErrRemoteUnreachable error = newError("container hosts on this LXD remote or member are unreachable from the worker, set routed on the remote", http.StatusBadRequest)
+	ErrHostNotRunning    error = newError("container host is not running", http.StatusConflict)
+	ErrSnapshotNotFound  error = newError("snapshot not found", http.StatusNotFound)
+	ErrSnapshotExists    error = newError("snapshot already exists", http.StatusConflict)
+
+	ErrVolumeNotFound error = newError("volume not found", http.StatusNotFound)
+	ErrVolumeInUse    error = newError("volume is mounted by a container", http.StatusConflict)
+	ErrHostHasVolumes error = newError("container hosts with LXD volumes cant be exported or migrated, their volumes would be left behind", http.StatusConflict)
+
+	ErrContainerNotFound  error = newError("container not found", http.StatusNotFound)
+	ErrContainerExited    error = newError("container exited before it was ready", http.StatusFailedDependency)
+	ErrContainerUnhealthy error = newError("container became unhealthy", http.StatusFailedDependency)
+	ErrContainerStopped   error = newError("container is not running", http.StatusConflict)
+
+	ErrInvalidNginxConfig error = newError("nginx rejected the config, the previous config was kept", http.StatusUnprocessableEntity)
+
+	ErrFileNotFound    error = newError("file not found", http.StatusNotFound)
+	ErrInvalidPath     error = newError("path must be absolute", http.StatusBadRequest)
+	ErrInvalidArchive  error = newError("invalid tar archive", http.StatusBadRequest)
+	ErrUnsupportedFile error = newError("archive entry is not a file, directory or symlink", http.StatusBadRequest)
 )
@@ -0,0 +1,178 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Strum355/log"
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+)
+
+func (lxd *lxdHost) HostExists(ctx context.Context, name string) (bool, error) {
+	_, err := lxd.remotes.forHost(name)
+	if err == ErrHostNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ExportContainerHost writes an LXD backup tarball of the host, including its snapshots, to w.
+// Hosts with LXD volumes are refused, as the backup wouldnt include them
+func (lxd *lxdHost) ExportContainerHost(ctx context.Context, name string, w io.WriteSeeker) error {
+	conn, err := lxd.remotes.forHost(name)
+	if err != nil {
+		return err
+	}
+
+	ctr, _, err := conn.GetContainer(name)
+	if err != nil {
+		return err
+	}
+	if hasLXDVolumes(ctr.Devices) {
+		return ErrHostHasVolumes
+	}
+
+	backupName := fmt.Sprintf("windlass-export-%d", time.Now().Unix())
+
+	op, err := conn.CreateContainerBackup(name, api.ContainerBackupsPost{
+		Name:       backupName,
+		ExpiryDate: time.Now().Add(time.Hour * 24),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating backup: %w", err)
+	}
+
+	if err := helpers.OperationTimeoutCleanup(ctx, op, func(ctx context.Context) error {
+		op, err := conn.DeleteContainerBackup(name, backupName)
+		if err != nil {
+			return err
+		}
+		return helpers.OperationTimeout(ctx, op)
+	}); err != nil {
+		return fmt.Errorf("error creating backup: %w", err)
+	}
+
+	// the backup only needs to live on the LXD server for as long as it takes to download it. The
+	// download may have timed out, so deleting it gets its own deadline
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		op, err := conn.DeleteContainerBackup(name, backupName)
+		if err == nil {
+			err = helpers.OperationTimeout(ctx, op)
+		}
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"containerHost": name,
+				"backup":        backupName,
+			}).Error("failed to delete LXD backup after export")
+		}
+	}()
+
+	if _, err := conn.GetContainerBackupFile(name, backupName, &lxdclient.BackupFileRequest{
+		BackupFile: w,
+	}); err != nil {
+		return fmt.Errorf("error downloading backup: %w", err)
+	}
+
+	return nil
+}
+
+// ImportContainerHost creates a container host from an LXD backup tarball. The host keeps
+// the name it was exported with. Its NIC is rebuilt for this worker's networks, as the backup's
+// names the bridge, address and ACL it had on the worker it was exported from.
+func (lxd *lxdHost) ImportContainerHost(ctx context.Context, opts ContainerHostImportOptions) error {
+	conn, err := lxd.remotes.get(opts.Remote)
+	if err != nil {
+		return err
+	}
+
+	member, err := lxd.remotes.placement(opts.Remote, "")
+	if err != nil {
+		return err
+	}
+	target := conn
+	if member != "" {
+		target = conn.UseTarget(member)
+	}
+
+	op, err := target.CreateContainerFromBackup(lxdclient.ContainerBackupArgs{
+		BackupFile: opts.Backup,
+	})
+	if err != nil {
+		return lxd.parseError(err)
+	}
+
+	if err := helpers.OperationTimeoutCleanup(ctx, op, removeContainer(target, opts.Name)); err != nil {
+		return lxd.parseError(err)
+	}
+
+	if namespace, err := lxd.rebuildNIC(ctx, conn, target, opts.Name); err != nil {
+		fields := log.Fields{
+			"containerHost": opts.Name,
+			"namespace":     namespace,
+		}
+
+		// the request may have timed out, which is likely why rebuilding failed
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := removeContainer(target, opts.Name)(ctx); err != nil {
+			log.WithError(err).WithFields(fields).Error("failed to remove imported container host")
+		} else if namespace != "" {
+			if err := lxd.releaseNamespaceNetwork(ctx, conn, namespace); err != nil {
+				log.WithError(err).WithFields(fields).Error("failed to release namespace network")
+			}
+		}
+		return fmt.Errorf("error rebuilding NIC: %w", err)
+	}
+
+	lxd.remotes.setLocation(opts.Name, opts.Remote)
+	return nil
+}
+
+// rebuildNIC replaces the eth0 of an imported host with the one a new host in its namespace
+// would get, ensuring the namespace network first. The host's namespace is returned even if
+// rebuilding fails, so that its network can be released along with the host
+func (lxd *lxdHost) rebuildNIC(ctx context.Context, conn, target lxdclient.ContainerServer, name string) (string, error) {
+	ctr, etag, err := target.GetContainer(name)
+	if err != nil {
+		return "", err
+	}
+
+	namespace, ok := ctr.Config[namespaceConfigKey]
+	if !ok {
+		return "", nil
+	}
+
+	lxd.netMu.Lock()
+	defer lxd.netMu.Unlock()
+
+	nic, err := lxd.hostNIC(ctx, conn, namespace)
+	if err != nil {
+		return namespace, err
+	}
+
+	put := ctr.Writable()
+	put.Devices["eth0"] = nic
+
+	op, err := target.UpdateContainer(name, put, etag)
+	if err != nil {
+		return namespace, err
+	}
+	if err := helpers.OperationTimeout(ctx, op); err != nil {
+		return namespace, err
+	}
+
+	// the ACL still allows the address the host was exported with
+	if isolationMode() == IsolationACL {
+		return namespace, syncNamespaceACL(ctx, conn, namespace)
+	}
+	return namespace, nil
+}
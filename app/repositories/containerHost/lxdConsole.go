@@ -0,0 +1,130 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+)
+
+// how long a hung up console shell has to exit before it is killed
+const consoleHangupTimeout = time.Second * 10
+
+var consoleCommand = []string{"/bin/bash", "--login"}
+
+// OpenConsole runs an interactive login shell as root in the container host with a TTY, and
+// returns its exit code once it exits. The shell is hung up when ctx is done
+func (lxd *lxdHost) OpenConsole(ctx context.Context, opts ConsoleOptions) (int, error) {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return -1, err
+	}
+
+	controls := make(chan *websocket.Conn, 1)
+	dataDone := make(chan bool)
+	op, err := conn.ExecContainer(opts.Name, api.ContainerExecPost{
+		Command:     consoleCommand,
+		WaitForWS:   true,
+		Interactive: true,
+		Environment: map[string]string{"TERM": "xterm-256color"},
+		Width:       opts.Size.Width,
+		Height:      opts.Size.Height,
+	}, &lxdclient.ContainerExecArgs{
+		Stdin:    opts.Stdin,
+		Stdout:   opts.Stdout,
+		Control:  func(conn *websocket.Conn) { controls <- conn },
+		DataDone: dataDone,
+	})
+	if err != nil {
+		return -1, fmt.Errorf("error opening console: %w", err)
+	}
+
+	var (
+		done    = helpers.OperationChannel(op)
+		ctxDone = ctx.Done()
+		resize  = opts.Resize
+		control *websocket.Conn
+		// a resize from before the control socket connected
+		pending *TerminalSize
+		hangup  <-chan time.Time
+	)
+	defer func() {
+		if control != nil {
+			control.Close()
+		}
+	}()
+
+	for {
+		select {
+		case control = <-controls:
+			if pending != nil {
+				sendResize(control, *pending)
+			}
+			// ctx ended before the shell could be hung up
+			if ctxDone == nil {
+				sendSignal(control, syscall.SIGHUP)
+			}
+		case size, ok := <-resize:
+			if !ok {
+				resize = nil
+				continue
+			}
+			if control == nil {
+				pending = &size
+				continue
+			}
+			sendResize(control, size)
+		case <-ctxDone:
+			ctxDone = nil
+			hangup = time.After(consoleHangupTimeout)
+			// without the control socket the shell cant be signalled, but the exec hasnt got going
+			// either and can still be cancelled
+			if control == nil {
+				op.Cancel()
+				continue
+			}
+			sendSignal(control, syscall.SIGHUP)
+		case <-hangup:
+			if control == nil {
+				op.Cancel()
+			}
+			sendSignal(control, syscall.SIGKILL)
+			return -1, ctx.Err()
+		case err := <-done:
+			if err != nil {
+				return -1, fmt.Errorf("error running console: %w", err)
+			}
+			// the shell's last output may still be in flight
+			<-dataDone
+			code, _ := op.Get().Metadata["return"].(float64)
+			return int(code), nil
+		}
+	}
+}
+
+func sendResize(control *websocket.Conn, size TerminalSize) {
+	control.WriteJSON(api.ContainerExecControl{
+		Command: "window-resize",
+		Args: map[string]string{
+			"width":  strconv.Itoa(size.Width),
+			"height": strconv.Itoa(size.Height),
+		},
+	})
+}
+
+func sendSignal(control *websocket.Conn, signal syscall.Signal) {
+	if control == nil {
+		return
+	}
+	control.WriteJSON(api.ContainerExecControl{
+		Command: "signal",
+		Signal:  int(signal),
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
@@ -14,80 +15,63 @@ import (
 
 	"github.com/cenkalti/backoff"
 
-	lxd "github.com/lxc/lxd/client"
-
 	"github.com/Strum355/log"
 
-	"github.com/spf13/viper"
-
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/volume"
 	"github.com/UCCNetworkingSociety/Windlass-worker/utils/writecloser"
 	lxdclient "github.com/lxc/lxd/client"
 	"github.com/lxc/lxd/shared/api"
 )
 
-var lxdConn lxd.ContainerServer
-
 type lxdHost struct {
-	conn       lxdclient.ContainerServer
-	dockerConn *docker.Client
-	ip         string
-
-	// certs for interacting with the host's Docker daemon
-	clientKeyPEM  []byte
-	clientCertPEM []byte
-	caPEM         []byte
-}
-
-func getLXD() (lxd.ContainerServer, error) {
-	if lxdConn != nil {
-		return lxdConn, nil
-	}
-
-	lxdconn, err := lxd.ConnectLXDUnix(viper.GetString("lxd.socket"), &lxd.ConnectionArgs{
-		UserAgent: "Windlass",
-	})
-	if err != nil {
-		return nil, fmt.Errorf("couldnt connect to LXD socket: %v", err)
-	}
-
-	lxdConn = lxdconn
-
-	return lxdConn, nil
+	remotes *lxdRemotes
+	docker  *dockerPool
+	// held while namespace bridges and ACLs are changed, and until a host using them is created
+	netMu *sync.Mutex
 }
 
 // TODO context tiemouts
 func NewLXDRepository() ContainerHostRepository {
-	lxdHostConn, err := getLXD()
+	remotes, err := connectRemotes()
 	if err != nil {
 		panic(fmt.Sprintf("error getting LXD host: %v", err))
 	}
 
-	return &lxdHost{
-		conn: lxdHostConn,
+	lxd := &lxdHost{
+		remotes: remotes,
+		netMu:   new(sync.Mutex),
 	}
+	lxd.docker = newDockerPool(lxd.GetContainerHostIP)
+	return lxd
 }
 
-func (lxd *lxdHost) createDockerConn() error {
-	if lxd.dockerConn == nil {
-		client, err := docker.NewTLSClientFromBytes("https://"+lxd.ip, lxd.clientCertPEM, lxd.clientKeyPEM, lxd.caPEM)
-		if err != nil {
-			return err
-		}
-		lxd.dockerConn = client
-	}
-	return nil
+func (lxd *lxdHost) UseCertSource(certs CertSource) {
+	lxd.docker.useCertSource(certs)
 }
 
-func (lxd *lxdHost) Ping(ctx context.Context) error {
-	if err := lxd.createDockerConn(); err != nil {
+const (
+	// how often WaitForContainer checks a container's state
+	containerPollInterval = time.Second
+
+	// label on Docker containers created by windlass recording the container host they belong to
+	projectLabel = "windlass.project"
+
+	// Docker network inside each container host that the project's containers are attached to
+	projectNetwork = "windlass"
+)
+
+// Ping pings the Docker daemon on a container host, evicting its client if it keeps failing
+func (lxd *lxdHost) Ping(ctx context.Context, name string) error {
+	client, err := lxd.docker.get(ctx, name)
+	if err != nil {
 		return err
 	}
-	/* log.WithFields({
-		"ip": lxd.ip,
-	}).Info("pinging docker endpoint") */
-	return lxd.dockerConn.PingWithContext(ctx)
+
+	err = client.PingWithContext(ctx)
+	lxd.docker.observe(name, err)
+	return err
 }
 
 func (lxd *lxdHost) parseError(err error) error {
@@ -100,50 +84,183 @@ func (lxd *lxdHost) parseError(err error) error {
 	return err
 }
 
+// stopContainer returns a cleanup that force stops a container started by an abandoned operation
+func stopContainer(conn lxdclient.ContainerServer, name string) helpers.Cleanup {
+	return func(ctx context.Context) error {
+		state, _, err := conn.GetContainerState(name)
+		if err != nil {
+			return err
+		}
+		if state.StatusCode == api.Stopped {
+			return nil
+		}
+
+		op, err := conn.UpdateContainerState(name, api.ContainerStatePut{Action: "stop", Timeout: -1, Force: true}, "")
+		if err != nil {
+			return err
+		}
+		return helpers.OperationTimeout(ctx, op)
+	}
+}
+
+// removeContainer returns a cleanup that deletes a container created by an abandoned operation
+func removeContainer(conn lxdclient.ContainerServer, name string) helpers.Cleanup {
+	return func(ctx context.Context) error {
+		if op, err := conn.UpdateContainerState(name, api.ContainerStatePut{Action: "stop", Timeout: -1, Force: true}, ""); err == nil {
+			helpers.OperationTimeout(ctx, op)
+		}
+
+		// ephemeral containers are gone once stopped
+		if _, _, err := conn.GetContainer(name); err != nil {
+			return nil
+		}
+
+		op, err := conn.DeleteContainer(name)
+		if err != nil {
+			return err
+		}
+		return helpers.OperationTimeout(ctx, op)
+	}
+}
+
 func (lxd *lxdHost) CreateContainerHost(ctx context.Context, opts ContainerHostCreateOptions) error {
 	log.WithFields(log.Fields{
 		"containerHost": opts.Name,
 	}).Debug("create container host request")
 
-	op, err := lxd.conn.CreateContainer(api.ContainersPost{
+	conn, err := lxd.remotes.get(opts.Remote)
+	if err != nil {
+		return err
+	}
+
+	member, err := lxd.remotes.placement(opts.Remote, opts.Target)
+	if err != nil {
+		return err
+	}
+
+	lxd.netMu.Lock()
+	nic, err := lxd.hostNIC(ctx, conn, opts.Namespace)
+	if err != nil {
+		lxd.netMu.Unlock()
+		return err
+	}
+
+	target := conn
+	if member != "" {
+		target = conn.UseTarget(member)
+	}
+
+	op, err := target.CreateContainer(api.ContainersPost{
 		ContainerPut: api.ContainerPut{
 			Devices: map[string]map[string]string{
-				"eth0": {
-					"type":         "nic",
-					"nictype":      "bridged",
-					"name":         "eth0",
-					"parent":       "windlassbr0",
-					"ipv4.address": "10.69.1.5", // sample data
-				},
+				"eth0": nic,
 			},
 			Config: map[string]string{
-				"security.nesting": "true",
+				"security.nesting":  "true",
+				namespaceConfigKey:  opts.Namespace,
+				projectConfigKey:    opts.Project,
+				imageAliasConfigKey: imageAlias(),
 			},
 		},
 		Name: opts.Name,
 		Source: api.ContainerSource{
-			Type:        "image",
-			Fingerprint: viper.GetString("lxd.baseImage"),
+			Type:  "image",
+			Alias: imageAlias(),
 		},
 	})
+	lxd.netMu.Unlock()
 	if err != nil {
 		return lxd.parseError(err)
 	}
 
-	err = helpers.OperationTimeout(ctx, op)
-	return lxd.parseError(err)
+	if err := helpers.OperationTimeoutCleanup(ctx, op, removeContainer(target, opts.Name)); err != nil {
+		return lxd.parseError(err)
+	}
+
+	lxd.remotes.setLocation(opts.Name, opts.Remote)
+	return nil
 }
 
 func (lxd *lxdHost) DeleteContainerHost(ctx context.Context, opts ContainerHostDeleteOptions) error {
-	op, err := lxd.conn.DeleteContainer(opts.Name)
+	conn, err := lxd.remotes.forHost(opts.Name)
 	if err != nil {
 		return err
 	}
-	return helpers.OperationTimeout(ctx, op)
+
+	// custom volumes are local to the host's cluster member, which is only known while it exists
+	var volumeConn lxdclient.ContainerServer
+	if opts.DeleteVolumes {
+		if volumeConn, err = lxd.memberConn(opts.Name); err != nil {
+			return err
+		}
+	}
+
+	ctr, _, err := conn.GetContainer(opts.Name)
+	if err != nil {
+		return err
+	}
+	namespace, hasNamespace := ctr.Config[namespaceConfigKey]
+
+	op, err := conn.DeleteContainer(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := helpers.OperationTimeoutCleanup(ctx, op, func(ctx context.Context) error {
+		lxd.remotes.forget(opts.Name)
+		if hasNamespace {
+			return lxd.releaseNamespaceNetwork(ctx, conn, namespace)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	lxd.remotes.forget(opts.Name)
+	lxd.docker.evict(opts.Name)
+
+	if hasNamespace {
+		if err := lxd.releaseNamespaceNetwork(ctx, conn, namespace); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"containerHost": opts.Name,
+				"namespace":     namespace,
+			}).Error("failed to release namespace network")
+		}
+	}
+
+	if opts.DeleteVolumes {
+		return lxd.deleteHostVolumes(volumeConn, opts.Name)
+	}
+	return nil
+}
+
+// ListContainerHosts returns the names of the windlass container hosts on every remote
+func (lxd *lxdHost) ListContainerHosts(ctx context.Context) ([]string, error) {
+	var hosts []string
+
+	for _, remote := range lxd.remotes.names {
+		containers, err := lxd.remotes.conns[remote].GetContainers()
+		if err != nil {
+			return nil, fmt.Errorf("error listing containers on remote %s: %w", remote, err)
+		}
+
+		for _, container := range containers {
+			if _, ok := container.Config[namespaceConfigKey]; ok {
+				hosts = append(hosts, container.Name)
+			}
+		}
+	}
+
+	return hosts, nil
 }
 
 func (lxd *lxdHost) StartContainerHost(ctx context.Context, opts ContainerHostStartOptions) error {
-	op, err := lxd.conn.UpdateContainerState(opts.Name, api.ContainerStatePut{
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	op, err := conn.UpdateContainerState(opts.Name, api.ContainerStatePut{
 		Action:  "start",
 		Timeout: -1,
 	}, "")
@@ -151,11 +268,17 @@ func (lxd *lxdHost) StartContainerHost(ctx context.Context, opts ContainerHostSt
 		return err
 	}
 
-	return helpers.OperationTimeout(ctx, op)
+	// a start that was reported as failed leaves the host stopped
+	return helpers.OperationTimeoutCleanup(ctx, op, stopContainer(conn, opts.Name))
 }
 
 func (lxd *lxdHost) StopContainerHost(ctx context.Context, opts ContainerHostStopOptions) error {
-	op, err := lxd.conn.UpdateContainerState(opts.Name, api.ContainerStatePut{
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	op, err := conn.UpdateContainerState(opts.Name, api.ContainerStatePut{
 		Action:  "stop",
 		Timeout: -1,
 	}, "")
@@ -163,14 +286,38 @@ func (lxd *lxdHost) StopContainerHost(ctx context.Context, opts ContainerHostSto
 		return err
 	}
 
-	return helpers.OperationTimeout(ctx, op)
+	// a clean shutdown that outlives the request is forced, so the host still ends up stopped
+	return helpers.OperationTimeoutSettle(ctx, op, func(ctx context.Context, opErr error) error {
+		if opErr == nil {
+			return nil
+		}
+		return stopContainer(conn, opts.Name)(ctx)
+	})
+}
+
+func (lxd *lxdHost) IsContainerHostRunning(ctx context.Context, name string) (bool, error) {
+	conn, err := lxd.remotes.forHost(name)
+	if err != nil {
+		return false, err
+	}
+
+	state, _, err := conn.GetContainerState(name)
+	if err != nil {
+		return false, err
+	}
+	return state.StatusCode == api.Running, nil
 }
 
 func (lxd *lxdHost) GetContainerHostIP(ctx context.Context, name string) (string, error) {
+	conn, err := lxd.remotes.forHost(name)
+	if err != nil {
+		return "", err
+	}
+
 	var ip string
 	retry := backoff.WithContext(backoff.NewConstantBackOff(time.Millisecond*5), ctx)
 	f := func() error {
-		state, _, err := lxd.conn.GetContainerState(name)
+		state, _, err := conn.GetContainerState(name)
 		if err != nil {
 			return backoff.Permanent(err)
 		}
@@ -178,7 +325,6 @@ func (lxd *lxdHost) GetContainerHostIP(ctx context.Context, name string) (string
 		for _, addr := range state.Network["eth0"].Addresses {
 			if addr.Family == "inet" {
 				ip = addr.Address
-				lxd.ip = ip
 				return nil
 			}
 		}
@@ -189,16 +335,24 @@ func (lxd *lxdHost) GetContainerHostIP(ctx context.Context, name string) (string
 }
 
 func (lxd *lxdHost) PushAuthCerts(ctx context.Context, opts ContainerPushCertsOptions, caPEM, serverKeyPEM, serverCertPEM []byte) error {
+	conn, lookupErr := lxd.remotes.forHost(opts.Name)
+	if lookupErr != nil {
+		return lookupErr
+	}
+
+	// the host's server cert is changing, its Docker client has to be rebuilt
+	lxd.docker.evict(opts.Name)
+
 	var err *multierror.Error
 
-	multierror.Append(err,
-		errors.WithMessage(lxd.conn.CreateContainerFile(opts.Name, "/nginx/ca-cert.pem", lxdclient.ContainerFileArgs{
+	err = multierror.Append(err,
+		errors.WithMessage(conn.CreateContainerFile(opts.Name, "/nginx/ca-cert.pem", lxdclient.ContainerFileArgs{
 			UID: 0, GID: 0, Content: bytes.NewReader(caPEM), Mode: 400, Type: "file", WriteMode: "overwrite",
 		}), "failed to push /nginx/ca-cert.pem"),
-		errors.WithMessage(lxd.conn.CreateContainerFile(opts.Name, "/nginx/server-key.pem", lxdclient.ContainerFileArgs{
+		errors.WithMessage(conn.CreateContainerFile(opts.Name, "/nginx/server-key.pem", lxdclient.ContainerFileArgs{
 			UID: 0, GID: 0, Content: bytes.NewReader(serverKeyPEM), Mode: 400, Type: "file", WriteMode: "overwrite",
 		}), "failed to push /nginx/server-key.pem"),
-		errors.WithMessage(lxd.conn.CreateContainerFile(opts.Name, "/nginx/server-cert.pem", lxdclient.ContainerFileArgs{
+		errors.WithMessage(conn.CreateContainerFile(opts.Name, "/nginx/server-cert.pem", lxdclient.ContainerFileArgs{
 			UID: 0, GID: 0, Content: bytes.NewReader(serverCertPEM), Mode: 400, Type: "file", WriteMode: "overwrite",
 		}), "failed to push /nginx/server-cert.pem"),
 	)
@@ -206,46 +360,135 @@ func (lxd *lxdHost) PushAuthCerts(ctx context.Context, opts ContainerPushCertsOp
 	return err.ErrorOrNil()
 }
 
-func (lxd *lxdHost) UseCerts(clientKeyPEM, clientCertPEM, caPEM []byte) {
-	lxd.clientKeyPEM = clientKeyPEM
-	lxd.clientCertPEM = clientCertPEM
-	lxd.caPEM = caPEM
-}
-
 func (lxd *lxdHost) RestartNGINX(ctx context.Context, name string) error {
 	exec := api.ContainerExecPost{
 		Command:   []string{"systemctl", "restart", "nginx"},
 		WaitForWS: true,
 	}
 
-	buf := &writecloser.BytesBuffer{bytes.NewBuffer(nil)}
-	op, err := lxd.conn.ExecContainer(name, exec, &lxdclient.ContainerExecArgs{
+	conn, err := lxd.remotes.forHost(name)
+	if err != nil {
+		return err
+	}
+
+	buf := &writecloser.BytesBuffer{Buffer: bytes.NewBuffer(nil)}
+	op, err := conn.ExecContainer(name, exec, &lxdclient.ContainerExecArgs{
 		Stderr: buf,
 	})
 	if err != nil {
 		return err
 	}
 
-	err = helpers.OperationTimeout(ctx, op)
+	// execs cant be cancelled, if the restart fails after the request gave up nginx is started
+	// again so the host isn't left without it
+	err = helpers.OperationTimeoutSettle(ctx, op, func(ctx context.Context, opErr error) error {
+		if code, _ := op.Get().Metadata["return"].(float64); opErr == nil && code == 0 {
+			return nil
+		}
+		out, code, err := execHost(ctx, conn, name, "systemctl", "start", "nginx")
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("error starting nginx: %s", strings.TrimSpace(out))
+		}
+		return nil
+	})
 	if err == context.DeadlineExceeded {
 		return err
 	}
 	return errors.WithMessage(err, fmt.Sprintf("error restarting nginx: %s", buf.String()))
 }
 
-func (lxd *lxdHost) CreateContainer(ctx context.Context, ctr container.Container) error {
-	if err := lxd.createDockerConn(); err != nil {
+// EnsureProjectNetwork creates the Docker network the project's containers find each other on
+func (lxd *lxdHost) EnsureProjectNetwork(ctx context.Context, name string) error {
+	client, err := lxd.docker.get(ctx, name)
+	if err != nil {
 		return err
 	}
 
-	mounts := make([]docker.Mount, 0, len(ctr.Mounts))
+	_, err = client.NetworkInfo(projectNetwork)
+	if _, ok := err.(*docker.NoSuchNetwork); !ok {
+		return err
+	}
+
+	_, err = client.CreateNetwork(docker.CreateNetworkOptions{
+		Name:           projectNetwork,
+		Driver:         "bridge",
+		Labels:         map[string]string{projectLabel: name},
+		CheckDuplicate: true,
+		Context:        ctx,
+	})
+	if err != nil && err != docker.ErrNetworkAlreadyExists {
+		return fmt.Errorf("error creating network: %w", err)
+	}
+	return nil
+}
+
+// PullImage pulls an image into a container host's Docker daemon
+func (lxd *lxdHost) PullImage(ctx context.Context, opts ImagePullOptions) error {
+	image, err := container.ParseImageReference(opts.Image)
+	if err != nil {
+		return err
+	}
+
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	auth := docker.AuthConfiguration{ServerAddress: image.Registry}
+	if opts.RegistryAuth != nil {
+		auth.Username = opts.RegistryAuth.Username
+		auth.Password = opts.RegistryAuth.Password
+		auth.IdentityToken = opts.RegistryAuth.IdentityToken
+	}
+
+	if err := client.PullImage(docker.PullImageOptions{
+		Repository: image.Name(),
+		Tag:        image.PullTag(),
+		Context:    ctx,
+	}, auth); err != nil {
+		return fmt.Errorf("error pulling image: %w", err)
+	}
+	return nil
+}
+
+// CreateContainer creates a container from an image already pulled with PullImage
+func (lxd *lxdHost) CreateContainer(ctx context.Context, opts ContainerCreateOptions) error {
+	ctr := opts.Container
+
+	image, err := container.ParseImageReference(ctr.Image)
+	if err != nil {
+		return err
+	}
+
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	volumes := make(map[string]volume.Volume, len(opts.Volumes))
+	for _, vol := range opts.Volumes {
+		volumes[vol.Name] = vol
+	}
+
+	binds := make([]string, 0, len(ctr.Mounts))
 
 	for _, mount := range ctr.Mounts {
-		mounts = append(mounts, docker.Mount{
-			Destination: mount.Destination,
-			Source:      mount.Source,
-			RW:          mount.RW,
-		})
+		source := mount.Source
+		if vol, ok := volumes[mount.Volume]; ok {
+			source = vol.Name
+			if vol.BackendOrDefault() == volume.BackendLXD {
+				source = volumePath(vol.Name)
+			}
+		}
+
+		mode := "ro"
+		if mount.RW {
+			mode = "rw"
+		}
+		binds = append(binds, fmt.Sprintf("%s:%s:%s", source, mount.Destination, mode))
 	}
 
 	env := make([]string, 0, len(ctr.Env))
@@ -255,33 +498,65 @@ func (lxd *lxdHost) CreateContainer(ctx context.Context, ctr container.Container
 	}
 
 	ports := make(map[docker.Port][]docker.PortBinding)
+	exposed := make(map[docker.Port]struct{})
 
 	for _, portMap := range ctr.Ports {
-		ports[docker.Port(fmt.Sprintf("%d/tcp", portMap.ContainerPort))] = []docker.PortBinding{
-			{HostPort: fmt.Sprintf("%d", portMap.HostPort)},
-		}
+		port := docker.Port(fmt.Sprintf("%d/%s", portMap.ContainerPort, portMap.Proto()))
+		exposed[port] = struct{}{}
+		ports[port] = append(ports[port], docker.PortBinding{
+			HostIP:   portMap.HostIP,
+			HostPort: fmt.Sprintf("%d", portMap.HostPort),
+		})
 	}
 
-	splitImage := strings.Split(ctr.Image, ":")
-	if err := lxd.dockerConn.PullImage(docker.PullImageOptions{
-		Repository: ctr.Image,
-		Tag:        splitImage[len(splitImage)-1],
-	}, docker.AuthConfiguration{}); err != nil {
-		return fmt.Errorf("error pulling image: %w", err)
+	labels := make(map[string]string, len(ctr.Labels)+1)
+	for k, v := range ctr.Labels {
+		labels[k] = v
+	}
+	labels[projectLabel] = opts.Name
+
+	var healthcheck *docker.HealthConfig
+	if ctr.Healthcheck != nil {
+		healthcheck = &docker.HealthConfig{
+			Test:        ctr.Healthcheck.Test,
+			Interval:    time.Duration(ctr.Healthcheck.Interval),
+			Timeout:     time.Duration(ctr.Healthcheck.Timeout),
+			StartPeriod: time.Duration(ctr.Healthcheck.StartPeriod),
+			Retries:     ctr.Healthcheck.Retries,
+		}
 	}
 
-	newCtr, err := lxd.dockerConn.CreateContainer(docker.CreateContainerOptions{
+	newCtr, err := client.CreateContainer(docker.CreateContainerOptions{
 		Context: ctx,
 		Name:    ctr.Name,
 		Config: &docker.Config{
-			Image:  ctr.Image,
-			Cmd:    []string{ctr.Command},
-			Labels: ctr.Labels,
-			Mounts: mounts,
-			Env:    env,
+			Image:        image.String(),
+			Entrypoint:   ctr.Entrypoint,
+			Cmd:          ctr.Cmd(),
+			Labels:       labels,
+			Env:          env,
+			ExposedPorts: exposed,
+			Healthcheck:  healthcheck,
+			WorkingDir:   ctr.WorkingDir,
+			User:         ctr.User,
+			Hostname:     ctr.Hostname,
+		},
+		NetworkingConfig: &docker.NetworkingConfig{
+			EndpointsConfig: map[string]*docker.EndpointConfig{
+				projectNetwork: {Aliases: []string{ctr.Name}},
+			},
 		},
 		HostConfig: &docker.HostConfig{
+			NetworkMode:  projectNetwork,
+			Binds:        binds,
 			PortBindings: ports,
+			RestartPolicy: docker.RestartPolicy{
+				Name:              ctr.RestartPolicy.Name,
+				MaximumRetryCount: ctr.RestartPolicy.MaximumRetryCount,
+			},
+			NanoCPUs:   int64(ctr.Resources.CPUs * 1e9),
+			Memory:     ctr.Resources.Memory,
+			ExtraHosts: ctr.ExtraHosts,
 		},
 	})
 	if err != nil {
@@ -292,9 +567,128 @@ func (lxd *lxdHost) CreateContainer(ctx context.Context, ctr container.Container
 		"container": fmt.Sprintf("%#v", newCtr),
 	}).Info("created new container")
 
-	if err := lxd.dockerConn.StartContainer(newCtr.ID, nil); err != nil {
+	if !ctr.StartOnCreate() {
+		return nil
+	}
+
+	if err := client.StartContainer(newCtr.ID, nil); err != nil {
 		return fmt.Errorf("error starting container: %w", err)
 	}
 
 	return nil
 }
+
+// WaitForContainer blocks until a container is running, or healthy if it has a healthcheck. A
+// container without a healthcheck must also accept connections on ProbePort, if set
+func (lxd *lxdHost) WaitForContainer(ctx context.Context, opts ContainerWaitOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(containerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ctr, err := client.InspectContainerWithOptions(docker.InspectContainerOptions{
+			Context: ctx,
+			ID:      opts.Container,
+		})
+		if err != nil {
+			return fmt.Errorf("error inspecting container: %w", err)
+		}
+
+		state := ctr.State
+		switch {
+		case state.Running && state.Health.Status == "" && opts.ProbePort != 0:
+			if lxd.probe(ctx, opts.Name, ctr, opts.ProbePort) {
+				return nil
+			}
+		case state.Running && state.Health.Status == "":
+			return nil
+		case state.Running && state.Health.Status == "healthy":
+			return nil
+		case state.Running && state.Health.Status == "unhealthy":
+			return ErrContainerUnhealthy
+		case !state.Running && !state.Restarting && state.Status != "created":
+			return fmt.Errorf("%w with code %d", ErrContainerExited, state.ExitCode)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListContainers returns the Docker containers on a container host that were created by windlass
+func (lxd *lxdHost) ListContainers(ctx context.Context, name string) ([]Container, error) {
+	client, err := lxd.docker.get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctrs, err := client.ListContainers(docker.ListContainersOptions{
+		All:     true,
+		Filters: map[string][]string{"label": {projectLabel}},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %w", err)
+	}
+
+	containers := make([]Container, 0, len(ctrs))
+	for _, ctr := range ctrs {
+		var ctrName string
+		if len(ctr.Names) > 0 {
+			ctrName = strings.TrimPrefix(ctr.Names[0], "/")
+		}
+
+		ports := make([]container.PortMapping, 0, len(ctr.Ports))
+		for _, port := range ctr.Ports {
+			if port.PublicPort == 0 {
+				continue
+			}
+			ports = append(ports, container.PortMapping{
+				ContainerPort: uint16(port.PrivatePort),
+				HostPort:      uint16(port.PublicPort),
+				Protocol:      port.Type,
+				HostIP:        port.IP,
+			})
+		}
+
+		containers = append(containers, Container{
+			ID:     ctr.ID,
+			Name:   ctrName,
+			Image:  ctr.Image,
+			State:  ctr.State,
+			Labels: ctr.Labels,
+			Ports:  ports,
+		})
+	}
+	return containers, nil
+}
+
+// RemoveContainer force removes a Docker container along with its anonymous volumes, unless they
+// are to be kept
+func (lxd *lxdHost) RemoveContainer(ctx context.Context, opts ContainerRemoveOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	err = client.RemoveContainer(docker.RemoveContainerOptions{
+		ID:            opts.Container,
+		RemoveVolumes: !opts.KeepVolumes,
+		Force:         true,
+		Context:       ctx,
+	})
+	if _, ok := err.(*docker.NoSuchContainer); ok {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error removing container: %w", err)
+	}
+	return nil
+}
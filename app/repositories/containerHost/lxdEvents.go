@@ -0,0 +1,175 @@
+package host
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/lxc/lxd/shared/api"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/event"
+)
+
+var errEventsClosed = errors.New("event stream closed")
+
+// WatchContainerHostEvents calls handle with the lifecycle events of the container hosts on every
+// remote until ctx is done. It returns early with an error if any remote's event stream drops
+func (lxd *lxdHost) WatchContainerHostEvents(ctx context.Context, handle func(event.Event)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errC := make(chan error, len(lxd.remotes.names))
+	for _, remote := range lxd.remotes.names {
+		listener, err := lxd.remotes.conns[remote].GetEvents()
+		if err != nil {
+			return fmt.Errorf("error listening for events on remote %s: %w", remote, err)
+		}
+
+		conn := lxd.remotes.conns[remote]
+		if _, err := listener.AddHandler([]string{"lifecycle"}, func(e api.Event) {
+			ev, ok := hostEvent(e)
+			if !ok {
+				return
+			}
+			if ctr, _, err := conn.GetContainer(ev.Host); err == nil {
+				ev.Namespace, ev.Project = ctr.Config[namespaceConfigKey], ctr.Config[projectConfigKey]
+			}
+			handle(ev)
+		}); err != nil {
+			listener.Disconnect()
+			return fmt.Errorf("error listening for events on remote %s: %w", remote, err)
+		}
+
+		go func() {
+			<-ctx.Done()
+			listener.Disconnect()
+		}()
+
+		go func(remote string) {
+			err := listener.Wait()
+			if err == nil {
+				err = errEventsClosed
+			}
+			errC <- fmt.Errorf("error listening for events on remote %s: %w", remote, err)
+		}(remote)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errC:
+		return err
+	}
+}
+
+// hostEvent translates an LXD lifecycle event, ignoring any that aren't about a container
+// starting or stopping
+func hostEvent(e api.Event) (event.Event, bool) {
+	var lifecycle api.EventLifecycle
+	if err := json.Unmarshal(e.Metadata, &lifecycle); err != nil {
+		return event.Event{}, false
+	}
+
+	source := lifecycle.Source
+	if i := strings.Index(source, "?"); i >= 0 {
+		source = source[:i]
+	}
+	if path.Dir(source) != "/1.0/containers" {
+		return event.Event{}, false
+	}
+
+	ev := event.Event{
+		Time: e.Timestamp,
+		Host: path.Base(source),
+	}
+
+	switch lifecycle.Action {
+	case "container-started":
+		ev.Type, ev.Message = event.HostStarted, "container host started"
+	case "container-stopped":
+		ev.Type, ev.Message = event.HostStopped, "container host stopped"
+	case "container-shutdown":
+		ev.Type, ev.Message = event.HostStopped, "container host shut down"
+	default:
+		return event.Event{}, false
+	}
+	return ev, true
+}
+
+// WatchContainerEvents calls handle with the events of the Docker containers in a container host
+// until ctx is done. It returns an error if the event stream drops, such as when the host stops
+func (lxd *lxdHost) WatchContainerEvents(ctx context.Context, name string, handle func(event.Event)) error {
+	client, err := lxd.docker.get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var namespace, project string
+	if conn, err := lxd.remotes.forHost(name); err == nil {
+		if ctr, _, err := conn.GetContainer(name); err == nil {
+			namespace, project = ctr.Config[namespaceConfigKey], ctr.Config[projectConfigKey]
+		}
+	}
+
+	events := make(chan *docker.APIEvents, 64)
+	if err := client.AddEventListener(events); err != nil {
+		return fmt.Errorf("error listening for Docker events: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			client.RemoveEventListener(events)
+			return nil
+		case e, ok := <-events:
+			if !ok {
+				return errEventsClosed
+			}
+			if ev, ok := containerEvent(name, e); ok {
+				ev.Namespace, ev.Project = namespace, project
+				handle(ev)
+			}
+		}
+	}
+}
+
+// containerEvent translates a Docker event, ignoring any that aren't a container starting, dying,
+// being OOM killed or changing health
+func containerEvent(name string, e *docker.APIEvents) (event.Event, bool) {
+	if e.Type != "container" {
+		return event.Event{}, false
+	}
+
+	ev := event.Event{
+		Time:      time.Unix(0, e.TimeNano),
+		Host:      name,
+		Container: e.Actor.Attributes["name"],
+	}
+
+	switch e.Action {
+	case "start":
+		ev.Type, ev.Message = event.ContainerStarted, "container started"
+	case "die":
+		ev.Type = event.ContainerDied
+		ev.Message = "container exited"
+		if code, err := strconv.Atoi(e.Actor.Attributes["exitCode"]); err == nil {
+			ev.ExitCode = &code
+			ev.Message = fmt.Sprintf("container exited with code %d", code)
+		}
+	case "oom":
+		ev.Type, ev.Message = event.ContainerOOMKilled, "container ran out of memory"
+	case "health_status: unhealthy":
+		ev.Type, ev.Message = event.ContainerUnhealthy, "container became unhealthy"
+	case "health_status: healthy":
+		ev.Type, ev.Message = event.ContainerHealthy, "container became healthy"
+	default:
+		return event.Event{}, false
+	}
+	return ev, true
+}
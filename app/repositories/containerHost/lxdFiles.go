@@ -0,0 +1,280 @@
+package host
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	lxdclient "github.com/lxc/lxd/client"
+)
+
+// PushFiles extracts a tar archive into a directory of the container host or of one of its
+// Docker containers, like `docker cp`
+func (lxd *lxdHost) PushFiles(ctx context.Context, opts FilePushOptions) error {
+	if !path.IsAbs(opts.Path) {
+		return ErrInvalidPath
+	}
+
+	if opts.Container != "" {
+		return lxd.pushContainerFiles(ctx, opts)
+	}
+
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	dest := path.Clean(opts.Path)
+	_, resp, err := conn.GetContainerFile(opts.Name, dest)
+	if err != nil {
+		return lxdFileError(err)
+	}
+	if resp.Type != "directory" {
+		return fmt.Errorf("%s is not a directory: %w", dest, ErrInvalidPath)
+	}
+
+	archive := tar.NewReader(opts.Archive)
+	for {
+		hdr, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		// rooting the name before cleaning it keeps entries like ../../etc/passwd inside dest
+		name := path.Clean("/" + hdr.Name)
+		if name == "/" {
+			continue
+		}
+		target := path.Join(dest, name)
+
+		applyFileOverrides(hdr, opts)
+		args := lxdclient.ContainerFileArgs{
+			UID:       int64(hdr.Uid),
+			GID:       int64(hdr.Gid),
+			Mode:      int(hdr.FileInfo().Mode().Perm()),
+			WriteMode: "overwrite",
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			args.Type = "directory"
+		case tar.TypeReg, tar.TypeRegA:
+			args.Type = "file"
+			args.Content = streamSeeker{archive}
+		case tar.TypeSymlink:
+			args.Type = "symlink"
+			args.Content = strings.NewReader(hdr.Linkname)
+		default:
+			return fmt.Errorf("%w: %s", ErrUnsupportedFile, hdr.Name)
+		}
+
+		if err := conn.CreateContainerFile(opts.Name, target, args); err != nil {
+			return fmt.Errorf("error pushing %s: %w", target, lxdFileError(err))
+		}
+	}
+}
+
+func (lxd *lxdHost) pushContainerFiles(ctx context.Context, opts FilePushOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	archive := opts.Archive
+	if opts.UID != nil || opts.GID != nil || opts.Mode != nil {
+		archive = rewriteArchive(opts)
+	}
+
+	err = client.UploadToContainer(opts.Container, docker.UploadToContainerOptions{
+		InputStream: archive,
+		Path:        path.Clean(opts.Path),
+		Context:     ctx,
+	})
+	return dockerFileError(err)
+}
+
+// rewriteArchive streams the archive of opts with its owner and mode overrides applied to
+// every entry
+func rewriteArchive(opts FilePushOptions) io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		in, out := tar.NewReader(opts.Archive), tar.NewWriter(w)
+		for {
+			hdr, err := in.Next()
+			if err == io.EOF {
+				w.CloseWithError(out.Close())
+				return
+			}
+			if err != nil {
+				w.CloseWithError(fmt.Errorf("%w: %v", ErrInvalidArchive, err))
+				return
+			}
+
+			applyFileOverrides(hdr, opts)
+			if err := out.WriteHeader(hdr); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(out, in); err != nil {
+				w.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func applyFileOverrides(hdr *tar.Header, opts FilePushOptions) {
+	if opts.UID != nil {
+		hdr.Uid = int(*opts.UID)
+	}
+	if opts.GID != nil {
+		hdr.Gid = int(*opts.GID)
+	}
+	if opts.Mode != nil && (hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA) {
+		hdr.Mode = int64(opts.Mode.Perm())
+	}
+}
+
+// PullFiles writes a tar archive of a file or directory of the container host or of one of its
+// Docker containers to w. Entries are named relative to the parent of the path, like `docker cp`
+func (lxd *lxdHost) PullFiles(ctx context.Context, opts FilePullOptions, w io.Writer) error {
+	if !path.IsAbs(opts.Path) {
+		return ErrInvalidPath
+	}
+
+	if opts.Container != "" {
+		client, err := lxd.docker.get(ctx, opts.Name)
+		if err != nil {
+			return err
+		}
+
+		err = client.DownloadFromContainer(opts.Container, docker.DownloadFromContainerOptions{
+			OutputStream: w,
+			Path:         path.Clean(opts.Path),
+			Context:      ctx,
+		})
+		return dockerFileError(err)
+	}
+
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewWriter(w)
+	src := path.Clean(opts.Path)
+	if err := pullHostFile(ctx, conn, opts.Name, src, path.Base(src), time.Now(), archive); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func pullHostFile(ctx context.Context, conn lxdclient.ContainerServer, host, src, name string, modTime time.Time, archive *tar.Writer) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	body, resp, err := conn.GetContainerFile(host, src)
+	if err != nil {
+		return fmt.Errorf("error pulling %s: %w", src, lxdFileError(err))
+	}
+	if body != nil {
+		defer body.Close()
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Uid:     int(resp.UID),
+		Gid:     int(resp.GID),
+		Mode:    int64(resp.Mode),
+		ModTime: modTime,
+	}
+
+	switch resp.Type {
+	case "directory":
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		if err := archive.WriteHeader(hdr); err != nil {
+			return err
+		}
+		for _, entry := range resp.Entries {
+			if err := pullHostFile(ctx, conn, host, path.Join(src, entry), path.Join(name, entry), modTime, archive); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "symlink":
+		target, err := ioutil.ReadAll(body)
+		if err != nil {
+			return fmt.Errorf("error pulling %s: %w", src, err)
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = strings.TrimSpace(string(target))
+		return archive.WriteHeader(hdr)
+	default:
+		// LXD doesnt send the size the tar header needs up front
+		tmp, err := ioutil.TempFile("", "windlass-pull-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		size, err := io.Copy(tmp, body)
+		if err != nil {
+			return fmt.Errorf("error pulling %s: %w", src, err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = size
+		if err := archive.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = io.Copy(archive, tmp)
+		return err
+	}
+}
+
+// streamSeeker passes a stream where LXD asks for an io.ReadSeeker it only ever reads from
+type streamSeeker struct {
+	io.Reader
+}
+
+func (streamSeeker) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("cannot seek a stream")
+}
+
+func lxdFileError(err error) error {
+	if strings.HasSuffix(err.Error(), "not found") {
+		return ErrFileNotFound
+	}
+	return err
+}
+
+// dockerFileError maps the 404s of the Docker archive API, which are returned both for missing
+// containers and missing paths
+func dockerFileError(err error) error {
+	dockerErr, ok := err.(*docker.Error)
+	if !ok || dockerErr.Status != 404 {
+		return err
+	}
+	if strings.Contains(dockerErr.Message, "No such container") {
+		return ErrContainerNotFound
+	}
+	return ErrFileNotFound
+}
@@ -0,0 +1,415 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+	"github.com/UCCNetworkingSociety/Windlass-worker/utils/writecloser"
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+)
+
+const (
+	// image property tying an image to the windlass alias it was imported for
+	imageAliasProperty = "windlass.alias"
+	// config key on container hosts recording the alias the host was created from
+	imageAliasConfigKey = "user.windlass.image.alias"
+	// set by LXD on every container created from an image
+	baseImageConfigKey = "volatile.base_image"
+)
+
+// verifyImageScript checks that an image has the nginx TLS proxy and Docker daemon windlass expects
+const verifyImageScript = `command -v nginx && command -v dockerd && test -d /nginx && systemctl is-enabled nginx docker`
+
+func imageAlias() string {
+	return viper.GetString("lxd.image.alias")
+}
+
+// EnsureBaseImage makes sure the base image alias exists on every remote, importing it
+// from the configured source if it doesnt, and verifies the image it points to.
+func (lxd *lxdHost) EnsureBaseImage(ctx context.Context) error {
+	for _, remote := range lxd.remotes.names {
+		conn := lxd.remotes.conns[remote]
+
+		alias, _, err := conn.GetImageAlias(imageAlias())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"remote": remote,
+				"alias":  imageAlias(),
+			}).Info("base image alias missing, importing")
+
+			if err := lxd.refreshRemoteImage(ctx, conn); err != nil {
+				return fmt.Errorf("remote %s: %w", remote, err)
+			}
+			continue
+		}
+
+		if err := verifyImage(ctx, conn, alias.Target); err != nil {
+			return fmt.Errorf("remote %s: %w", remote, err)
+		}
+	}
+	return nil
+}
+
+// RefreshBaseImage imports the latest base image from the configured source on every remote.
+// If a new image was imported and passes verification the alias is moved to it and all
+// but the newest `lxd.image.keep` older versions are deleted.
+func (lxd *lxdHost) RefreshBaseImage(ctx context.Context) error {
+	for _, remote := range lxd.remotes.names {
+		if err := lxd.refreshRemoteImage(ctx, lxd.remotes.conns[remote]); err != nil {
+			return fmt.Errorf("remote %s: %w", remote, err)
+		}
+	}
+	return nil
+}
+
+func (lxd *lxdHost) refreshRemoteImage(ctx context.Context, conn lxdclient.ContainerServer) error {
+	var fingerprint string
+	var err error
+
+	switch {
+	case viper.GetString("lxd.image.file") != "":
+		fingerprint, err = importImageFile(ctx, conn, viper.GetString("lxd.image.file"))
+	case viper.GetString("lxd.image.server") != "":
+		fingerprint, err = importImageSimpleStreams(ctx, conn, viper.GetString("lxd.image.server"), viper.GetString("lxd.image.remoteAlias"))
+	default:
+		return fmt.Errorf("base image %s not found and no lxd.image.file or lxd.image.server configured", imageAlias())
+	}
+	if err != nil {
+		return fmt.Errorf("error importing base image: %w", err)
+	}
+
+	current, _, aliasErr := conn.GetImageAlias(imageAlias())
+	if aliasErr == nil && current.Target == fingerprint {
+		return nil
+	}
+
+	if err := verifyImage(ctx, conn, fingerprint); err != nil {
+		return err
+	}
+
+	if err := tagImage(conn, fingerprint); err != nil {
+		return err
+	}
+
+	if aliasErr == nil {
+		err = conn.UpdateImageAlias(imageAlias(), api.ImageAliasesEntryPut{
+			Description: "Windlass base image",
+			Target:      fingerprint,
+		}, "")
+	} else {
+		err = conn.CreateImageAlias(api.ImageAliasesPost{ImageAliasesEntry: api.ImageAliasesEntry{
+			ImageAliasesEntryPut: api.ImageAliasesEntryPut{
+				Description: "Windlass base image",
+				Target:      fingerprint,
+			},
+			Name: imageAlias(),
+		}})
+	}
+	if err != nil {
+		return fmt.Errorf("error pointing alias %s at %s: %w", imageAlias(), fingerprint, err)
+	}
+
+	log.WithFields(log.Fields{
+		"alias":       imageAlias(),
+		"fingerprint": fingerprint,
+	}).Info("base image updated")
+
+	return pruneImages(ctx, conn, fingerprint)
+}
+
+// importImageFile imports a unified image tarball, skipping the upload if LXD already has it
+func importImageFile(ctx context.Context, conn lxdclient.ContainerServer, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+	if _, _, err := conn.GetImage(fingerprint); err == nil {
+		return fingerprint, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	op, err := conn.CreateImage(api.ImagesPost{}, &lxdclient.ImageCreateArgs{
+		MetaFile: file,
+		MetaName: filepath.Base(path),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := helpers.OperationTimeout(ctx, op); err != nil {
+		return "", err
+	}
+	return fingerprint, nil
+}
+
+// importImageSimpleStreams copies the image an alias points to on a simplestreams server
+func importImageSimpleStreams(ctx context.Context, conn lxdclient.ContainerServer, server, remoteAlias string) (string, error) {
+	source, err := lxdclient.ConnectSimpleStreams(server, &lxdclient.ConnectionArgs{
+		UserAgent: "Windlass",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	alias, _, err := source.GetImageAlias(remoteAlias)
+	if err != nil {
+		return "", fmt.Errorf("error getting alias %s from %s: %w", remoteAlias, server, err)
+	}
+
+	image, _, err := source.GetImage(alias.Target)
+	if err != nil {
+		return "", err
+	}
+
+	if _, _, err := conn.GetImage(image.Fingerprint); err == nil {
+		return image.Fingerprint, nil
+	}
+
+	op, err := conn.CopyImage(source, *image, &lxdclient.ImageCopyArgs{})
+	if err != nil {
+		return "", err
+	}
+
+	if err := helpers.OperationTimeout(ctx, op); err != nil {
+		return "", err
+	}
+	return image.Fingerprint, nil
+}
+
+func tagImage(conn lxdclient.ContainerServer, fingerprint string) error {
+	image, etag, err := conn.GetImage(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	put := image.Writable()
+	if put.Properties == nil {
+		put.Properties = make(map[string]string)
+	}
+	put.Properties[imageAliasProperty] = imageAlias()
+
+	return conn.UpdateImage(fingerprint, put, etag)
+}
+
+// verifyImage boots a throwaway container from the image and checks that nginx and Docker
+// are installed and enabled
+func verifyImage(ctx context.Context, conn lxdclient.ContainerServer, fingerprint string) error {
+	if !viper.GetBool("lxd.image.verify") {
+		return nil
+	}
+
+	name := fmt.Sprintf("windlass-verify-%s", fingerprint[:12])
+
+	op, err := conn.CreateContainer(api.ContainersPost{
+		ContainerPut: api.ContainerPut{
+			Ephemeral: true,
+			Config: map[string]string{
+				"security.nesting": "true",
+			},
+		},
+		Name: name,
+		Source: api.ContainerSource{
+			Type:        "image",
+			Fingerprint: fingerprint,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating image verification container: %w", err)
+	}
+	if err := helpers.OperationTimeoutCleanup(ctx, op, removeContainer(conn, name)); err != nil {
+		return fmt.Errorf("error creating image verification container: %w", err)
+	}
+
+	// the verification may have timed out, so removing the container gets its own deadline
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := removeContainer(conn, name)(ctx); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"container": name,
+			}).Error("failed to remove image verification container")
+		}
+	}()
+
+	op, err = conn.UpdateContainerState(name, api.ContainerStatePut{Action: "start", Timeout: -1}, "")
+	if err != nil {
+		return err
+	}
+	if err := helpers.OperationTimeoutCleanup(ctx, op, removeContainer(conn, name)); err != nil {
+		return err
+	}
+
+	out := &writecloser.BytesBuffer{Buffer: bytes.NewBuffer(nil)}
+	op, err = conn.ExecContainer(name, api.ContainerExecPost{
+		Command:   []string{"sh", "-c", verifyImageScript},
+		WaitForWS: true,
+	}, &lxdclient.ContainerExecArgs{
+		Stdout: out,
+		Stderr: out,
+	})
+	if err != nil {
+		return err
+	}
+	if err := helpers.OperationTimeout(ctx, op); err != nil {
+		return err
+	}
+
+	if code, ok := op.Get().Metadata["return"].(float64); !ok || code != 0 {
+		return fmt.Errorf("image %s failed verification: %s", fingerprint, out.String())
+	}
+	return nil
+}
+
+// pruneImages deletes old versions of the base image beyond the `lxd.image.keep` newest
+func pruneImages(ctx context.Context, conn lxdclient.ContainerServer, current string) error {
+	images, err := aliasImages(conn)
+	if err != nil {
+		return err
+	}
+
+	keep := viper.GetInt("lxd.image.keep")
+	for _, image := range images {
+		if image.Fingerprint == current {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"fingerprint": image.Fingerprint,
+		}).Info("deleting old base image")
+
+		op, err := conn.DeleteImage(image.Fingerprint)
+		if err != nil {
+			return err
+		}
+		// an abandoned delete that fails is retried, the images after it are pruned next refresh
+		fingerprint := image.Fingerprint
+		err = helpers.OperationTimeoutSettle(ctx, op, func(ctx context.Context, opErr error) error {
+			if opErr == nil {
+				return nil
+			}
+			if _, _, err := conn.GetImage(fingerprint); err != nil {
+				return nil
+			}
+			op, err := conn.DeleteImage(fingerprint)
+			if err != nil {
+				return err
+			}
+			return helpers.OperationTimeout(ctx, op)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aliasImages returns the versions of the base image, newest first
+func aliasImages(conn lxdclient.ContainerServer) ([]api.Image, error) {
+	all, err := conn.GetImages()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []api.Image
+	for _, image := range all {
+		if image.Properties[imageAliasProperty] == imageAlias() {
+			images = append(images, image)
+		}
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].UploadedAt.After(images[j].UploadedAt)
+	})
+	return images, nil
+}
+
+func (lxd *lxdHost) ListBaseImages(ctx context.Context) ([]BaseImage, error) {
+	var images []BaseImage
+
+	for _, remote := range lxd.remotes.names {
+		conn := lxd.remotes.conns[remote]
+
+		current := ""
+		if alias, _, err := conn.GetImageAlias(imageAlias()); err == nil {
+			current = alias.Target
+		}
+
+		versions, err := aliasImages(conn)
+		if err != nil {
+			return nil, fmt.Errorf("error listing images on remote %s: %w", remote, err)
+		}
+
+		for _, image := range versions {
+			images = append(images, BaseImage{
+				Remote:      remote,
+				Fingerprint: image.Fingerprint,
+				Current:     image.Fingerprint == current,
+				UploadedAt:  image.UploadedAt,
+			})
+		}
+	}
+
+	return images, nil
+}
+
+func (lxd *lxdHost) ListHostImages(ctx context.Context) ([]HostImage, error) {
+	var hosts []HostImage
+
+	for _, remote := range lxd.remotes.names {
+		conn := lxd.remotes.conns[remote]
+
+		current := ""
+		if alias, _, err := conn.GetImageAlias(imageAlias()); err == nil {
+			current = alias.Target
+		}
+
+		containers, err := conn.GetContainers()
+		if err != nil {
+			return nil, fmt.Errorf("error listing containers on remote %s: %w", remote, err)
+		}
+
+		for _, container := range containers {
+			if _, ok := container.Config[namespaceConfigKey]; !ok {
+				continue
+			}
+			hosts = append(hosts, HostImage{
+				Host:        container.Name,
+				Remote:      remote,
+				Alias:       container.Config[imageAliasConfigKey],
+				Fingerprint: container.Config[baseImageConfigKey],
+				Current:     container.Config[baseImageConfigKey] == current,
+			})
+		}
+	}
+
+	return hosts, nil
+}
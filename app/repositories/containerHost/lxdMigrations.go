@@ -0,0 +1,195 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Strum355/log"
+	"github.com/hashicorp/go-multierror"
+	"github.com/lxc/lxd/shared/api"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/migration"
+)
+
+// MigrateContainerHost sets up the host as the source of an LXD pull migration and hands
+// the source details to transfer, which should get the target LXD server to pull it.
+// Once transfer returns the source side of the migration is waited on. A host that isnt
+// being migrated live is stopped first, and started again if the transfer fails.
+// Hosts with LXD volumes are refused, as the migration wouldnt move them
+func (lxd *lxdHost) MigrateContainerHost(ctx context.Context, opts ContainerHostMigrateOptions, transfer func(migration.Source) error) error {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	container, _, err := conn.GetContainer(opts.Name)
+	if err != nil {
+		return err
+	}
+	if hasLXDVolumes(container.Devices) {
+		return ErrHostHasVolumes
+	}
+
+	server, _, err := conn.GetServer()
+	if err != nil {
+		return err
+	}
+
+	info, err := conn.GetConnectionInfo()
+	if err != nil {
+		return err
+	}
+
+	if len(info.Addresses) == 0 {
+		return fmt.Errorf("LXD server holding %s isnt listening on the network, core.https_address must be set", opts.Name)
+	}
+
+	running := container.StatusCode == api.Running
+	live := opts.Live && running
+
+	if running && !live {
+		log.WithFields(log.Fields{
+			"containerHost": opts.Name,
+		}).Info("stopping container host for migration")
+
+		if err := lxd.StopContainerHost(ctx, ContainerHostStopOptions{ContainerName: opts.ContainerName}); err != nil {
+			return fmt.Errorf("error stopping host: %w", err)
+		}
+	}
+
+	op, err := conn.MigrateContainer(opts.Name, api.ContainerPost{
+		Migration: true,
+		Live:      live,
+	})
+	if err != nil {
+		return err
+	}
+
+	secrets := make(map[string]string)
+	for k, v := range op.Get().Metadata {
+		if secret, ok := v.(string); ok {
+			secrets[k] = secret
+		}
+	}
+
+	source := migration.Source{
+		Addresses:    info.Addresses,
+		Operation:    op.Get().ID,
+		Certificate:  server.Environment.Certificate,
+		Secrets:      secrets,
+		Live:         live,
+		BaseImage:    container.Config[baseImageConfigKey],
+		Architecture: container.Architecture,
+		Config:       container.Config,
+		Devices:      container.Devices,
+		Profiles:     container.Profiles,
+	}
+
+	if err := transfer(source); err != nil {
+		// the source operation waits for a target to connect, if none did it has to be cancelled
+		op.Cancel()
+
+		if running && !live {
+			if startErr := lxd.StartContainerHost(ctx, ContainerHostStartOptions{ContainerName: opts.ContainerName}); startErr != nil {
+				log.WithError(startErr).WithFields(log.Fields{
+					"containerHost": opts.Name,
+				}).Error("failed to restart container host after failed migration")
+			}
+		}
+		return err
+	}
+
+	return helpers.OperationTimeout(ctx, op)
+}
+
+// ReceiveContainerHost creates a container host by pulling it from a migration source.
+// The host's NIC is rebuilt for this worker's networks, the rest of its config is kept.
+func (lxd *lxdHost) ReceiveContainerHost(ctx context.Context, opts ContainerHostReceiveOptions) error {
+	if hasLXDVolumes(opts.Source.Devices) {
+		return ErrHostHasVolumes
+	}
+
+	conn, err := lxd.remotes.get(opts.Remote)
+	if err != nil {
+		return err
+	}
+
+	devices := make(map[string]map[string]string, len(opts.Source.Devices))
+	for name, device := range opts.Source.Devices {
+		devices[name] = device
+	}
+
+	member, err := lxd.remotes.placement(opts.Remote, opts.Target)
+	if err != nil {
+		return err
+	}
+
+	// the namespace network is only held until the host exists, which for migrations is once
+	// the first pull is accepted
+	lxd.netMu.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			lxd.netMu.Unlock()
+		}
+	}()
+
+	if namespace, ok := opts.Source.Config[namespaceConfigKey]; ok {
+		nic, err := lxd.hostNIC(ctx, conn, namespace)
+		if err != nil {
+			return err
+		}
+		devices["eth0"] = nic
+	}
+
+	if member != "" {
+		conn = conn.UseTarget(member)
+	}
+
+	req := api.ContainersPost{
+		ContainerPut: api.ContainerPut{
+			Architecture: opts.Source.Architecture,
+			Config:       opts.Source.Config,
+			Devices:      devices,
+			Profiles:     opts.Source.Profiles,
+		},
+		Name: opts.Name,
+		Source: api.ContainerSource{
+			Type:        "migration",
+			Mode:        "pull",
+			BaseImage:   opts.Source.BaseImage,
+			Certificate: opts.Source.Certificate,
+			Websockets:  opts.Source.Secrets,
+			Live:        opts.Source.Live,
+		},
+	}
+
+	// the source may listen on several addresses, not all of which are reachable from here
+	var errs *multierror.Error
+	for _, addr := range opts.Source.Addresses {
+		req.Source.Operation = fmt.Sprintf("%s/1.0/operations/%s", strings.TrimSuffix(addr, "/"), url.QueryEscape(opts.Source.Operation))
+
+		op, err := conn.CreateContainer(req)
+		if locked {
+			lxd.netMu.Unlock()
+			locked = false
+		}
+		if err == nil {
+			err = helpers.OperationTimeoutCleanup(ctx, op, removeContainer(conn, opts.Name))
+		}
+		if err == nil {
+			lxd.remotes.setLocation(opts.Name, opts.Remote)
+			return nil
+		}
+
+		if err := lxd.parseError(err); err == ErrHostExists || ctx.Err() != nil {
+			return err
+		}
+		errs = multierror.Append(errs, fmt.Errorf("%s: %w", addr, err))
+	}
+
+	return fmt.Errorf("error pulling host from migration source: %w", errs.ErrorOrNil())
+}
@@ -0,0 +1,675 @@
+package host
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+)
+
+const (
+	// IsolationNone puts every container host on the shared windlass bridge
+	IsolationNone = "none"
+	// IsolationBridge gives each namespace its own managed bridge. The LXD host routes between
+	// bridges, so each bridge also gets an ACL dropping traffic to and from every other windlass
+	// bridge's subnet
+	IsolationBridge = "bridge"
+	// IsolationACL keeps the shared bridge but gives each host's NIC its namespace's ACL, which
+	// drops traffic to and from every address on the bridge other than the gateway and the
+	// namespace's own hosts. Hosts get static addresses so the ACL can name them
+	IsolationACL = "acl"
+
+	// config key on networks, ACLs and container hosts recording the owning namespace
+	namespaceConfigKey = "user.windlass.namespace"
+	// config key on container hosts recording the project name within the namespace
+	projectConfigKey = "user.windlass.name"
+)
+
+// networkACL mirrors the LXD network ACL object, which the vendored client predates
+type networkACL struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Ingress     []networkACLRule  `json:"ingress"`
+	Egress      []networkACLRule  `json:"egress"`
+	Config      map[string]string `json:"config"`
+}
+
+type networkACLRule struct {
+	Action      string `json:"action"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Description string `json:"description,omitempty"`
+	State       string `json:"state"`
+}
+
+func isolationMode() string {
+	return viper.GetString("lxd.network.isolation")
+}
+
+// EnsureNetworks creates the shared windlass bridge on every LXD remote if it is missing
+// and checks that any existing windlass networks are managed bridges. With isolation on, the
+// namespace bridges and ACLs that already exist are checked and brought up to date, and any
+// whose namespace has no hosts left are deleted; missing ones are created when the first
+// host in the namespace is created.
+func (lxd *lxdHost) EnsureNetworks(ctx context.Context) error {
+	for _, remote := range lxd.remotes.names {
+		if err := lxd.ensureRemoteNetworks(ctx, lxd.remotes.conns[remote]); err != nil {
+			return fmt.Errorf("remote %s: %w", remote, err)
+		}
+	}
+	return nil
+}
+
+// the LXD client doesnt take contexts, so ctx is checked between requests
+func (lxd *lxdHost) ensureRemoteNetworks(ctx context.Context, conn lxdclient.ContainerServer) error {
+	switch isolationMode() {
+	case IsolationNone:
+	case IsolationBridge, IsolationACL:
+		if !conn.HasExtension("network_acl") {
+			return fmt.Errorf("lxd.network.isolation is %q but the LXD server is missing the network_acl API extension", isolationMode())
+		}
+	default:
+		return fmt.Errorf("invalid lxd.network.isolation %q", isolationMode())
+	}
+
+	name := viper.GetString("lxd.network.name")
+	if err := ensureBridge(conn, name, api.NetworkPut{
+		Description: "Windlass container host bridge",
+		Config: map[string]string{
+			"ipv4.address": viper.GetString("lxd.network.ipv4"),
+			"ipv4.nat":     "true",
+			"ipv6.address": "none",
+		},
+	}); err != nil {
+		return err
+	}
+
+	if isolationMode() == IsolationNone || ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	networks, err := conn.GetNetworks()
+	if err != nil {
+		return fmt.Errorf("error listing LXD networks: %w", err)
+	}
+
+	namespaces := make(map[string]bool)
+	for _, network := range networks {
+		namespace, ok := network.Config[namespaceConfigKey]
+		if !ok {
+			continue
+		}
+		if err := checkBridge(network); err != nil {
+			return err
+		}
+		if network.Name != namespaceBridgeName(namespace) {
+			return fmt.Errorf("network %s is tagged with namespace %s but should be named %s", network.Name, namespace, namespaceBridgeName(namespace))
+		}
+		namespaces[namespace] = true
+	}
+
+	acls, err := listACLs(conn)
+	if err != nil {
+		return err
+	}
+	for _, acl := range acls {
+		if namespace, ok := acl.Config[namespaceConfigKey]; ok {
+			namespaces[namespace] = true
+		}
+	}
+
+	// networks left behind by hosts deleted before they were cleaned up on delete are removed,
+	// the rest are brought up to date with the hosts in their namespace
+	for namespace := range namespaces {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := lxd.releaseNamespaceNetwork(ctx, conn, namespace); err != nil {
+			return fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+	}
+
+	if isolationMode() == IsolationBridge {
+		lxd.netMu.Lock()
+		defer lxd.netMu.Unlock()
+		return syncBridgeACLs(ctx, conn)
+	}
+	return nil
+}
+
+// ensureBridge creates a managed bridge with the given config if it doesnt already exist,
+// otherwise it checks that the existing network is usable as a windlass bridge.
+// On a cluster the network is first defined on every member and then created cluster wide.
+func ensureBridge(conn lxdclient.ContainerServer, name string, put api.NetworkPut) error {
+	network, _, err := conn.GetNetwork(name)
+	if err == nil {
+		return checkBridge(*network)
+	}
+
+	log.WithFields(log.Fields{
+		"network": name,
+	}).Info("creating LXD network")
+
+	if conn.IsClustered() {
+		members, err := conn.GetClusterMemberNames()
+		if err != nil {
+			return fmt.Errorf("error listing cluster members: %w", err)
+		}
+
+		for _, member := range members {
+			if err := conn.UseTarget(member).CreateNetwork(api.NetworksPost{
+				Name: name,
+				Type: "bridge",
+			}); err != nil {
+				return fmt.Errorf("error defining network %s on member %s: %w", name, member, err)
+			}
+		}
+	}
+
+	if err := conn.CreateNetwork(api.NetworksPost{
+		NetworkPut: put,
+		Name:       name,
+		Type:       "bridge",
+	}); err != nil {
+		return fmt.Errorf("error creating network %s: %w", name, err)
+	}
+	return nil
+}
+
+func checkBridge(network api.Network) error {
+	if !network.Managed {
+		return fmt.Errorf("network %s exists but is not managed by LXD", network.Name)
+	}
+	if network.Type != "bridge" {
+		return fmt.Errorf("network %s is of type %s, expected bridge", network.Name, network.Type)
+	}
+	return nil
+}
+
+// namespaceBridgeName returns the bridge name for a namespace. Interface names are
+// limited to 15 characters so the namespace is hashed rather than used directly
+func namespaceBridgeName(namespace string) string {
+	sum := sha1.Sum([]byte(namespace))
+	return "wl" + hex.EncodeToString(sum[:])[:10]
+}
+
+func namespaceACLName(namespace string) string {
+	return "windlass-" + namespace
+}
+
+// hostNIC returns the eth0 device for a new container host in the given namespace, creating or
+// updating the namespace bridge or ACL first if isolation requires it. The caller must hold
+// netMu until the host has been created, so that the network isn't released in between
+func (lxd *lxdHost) hostNIC(ctx context.Context, conn lxdclient.ContainerServer, namespace string) (map[string]string, error) {
+	nic := map[string]string{
+		"type":    "nic",
+		"nictype": "bridged",
+		"name":    "eth0",
+		"parent":  viper.GetString("lxd.network.name"),
+	}
+
+	switch isolationMode() {
+	case IsolationBridge:
+		bridge := namespaceBridgeName(namespace)
+		if _, _, err := conn.GetNetwork(bridge); err != nil {
+			// the new bridge's ACL is filled in once its subnet is known
+			if err := putACL(conn, namespaceACL(namespace, nil, nil)); err != nil {
+				return nil, err
+			}
+		}
+		if err := ensureBridge(conn, bridge, api.NetworkPut{
+			Description: fmt.Sprintf("Windlass bridge for namespace %s", namespace),
+			Config: map[string]string{
+				"ipv4.address":                         viper.GetString("lxd.network.namespaceIPv4"),
+				"ipv4.nat":                             "true",
+				"ipv6.address":                         "none",
+				"security.acls":                        namespaceACLName(namespace),
+				"security.acls.default.egress.action":  "allow",
+				"security.acls.default.ingress.action": "allow",
+				namespaceConfigKey:                     namespace,
+			},
+		}); err != nil {
+			return nil, err
+		}
+		if err := syncBridgeACLs(ctx, conn); err != nil {
+			return nil, err
+		}
+		nic["parent"] = bridge
+	case IsolationACL:
+		ip, err := allocateHostIP(conn)
+		if err != nil {
+			return nil, err
+		}
+		if err := syncNamespaceACL(ctx, conn, namespace, ip); err != nil {
+			return nil, err
+		}
+		delete(nic, "nictype")
+		delete(nic, "parent")
+		nic["network"] = viper.GetString("lxd.network.name")
+		nic["ipv4.address"] = ip.String()
+		nic["security.acls"] = namespaceACLName(namespace)
+		nic["security.acls.default.egress.action"] = "allow"
+		nic["security.acls.default.ingress.action"] = "allow"
+	}
+
+	return nic, nil
+}
+
+// ReleaseNamespaceNetwork deletes the namespace's bridge and ACL on a remote if no host in the
+// namespace is left using them, such as after creating the namespace's first host failed
+func (lxd *lxdHost) ReleaseNamespaceNetwork(ctx context.Context, opts NamespaceNetworkOptions) error {
+	conn, err := lxd.remotes.get(opts.Remote)
+	if err != nil {
+		return err
+	}
+	return lxd.releaseNamespaceNetwork(ctx, conn, opts.Namespace)
+}
+
+// releaseNamespaceNetwork deletes a namespace's bridge and ACL once the remote has no hosts left
+// in the namespace. While it still has some, their ACL is updated to drop any that are gone
+func (lxd *lxdHost) releaseNamespaceNetwork(ctx context.Context, conn lxdclient.ContainerServer, namespace string) error {
+	lxd.netMu.Lock()
+	defer lxd.netMu.Unlock()
+
+	hosts, err := namespaceHosts(conn, namespace)
+	if err != nil {
+		return err
+	}
+
+	if len(hosts) > 0 {
+		if isolationMode() == IsolationACL {
+			return syncNamespaceACL(ctx, conn, namespace)
+		}
+		return nil
+	}
+
+	fields := log.Fields{
+		"namespace": namespace,
+	}
+
+	bridge := namespaceBridgeName(namespace)
+	_, _, err = conn.GetNetwork(bridge)
+	hadBridge := err == nil
+	if hadBridge {
+		log.WithFields(log.Fields{
+			"network":   bridge,
+			"namespace": namespace,
+		}).Info("deleting unused LXD network")
+
+		if err := conn.DeleteNetwork(bridge); err != nil {
+			return fmt.Errorf("error deleting network %s: %w", bridge, err)
+		}
+	}
+
+	if conn.HasExtension("network_acl") {
+		name := namespaceACLName(namespace)
+		_, _, err := conn.RawQuery("DELETE", "/1.0/network-acls/"+name, nil, "")
+		switch {
+		case err == nil:
+			log.WithFields(fields).WithFields(log.Fields{"acl": name}).Info("deleted unused LXD network ACL")
+		case !strings.HasSuffix(err.Error(), "not found"):
+			return fmt.Errorf("error deleting network ACL %s: %w", name, err)
+		}
+	}
+
+	// the other bridges' ACLs no longer need to drop the deleted bridge's subnet
+	if hadBridge {
+		return syncBridgeACLs(ctx, conn)
+	}
+	return nil
+}
+
+// syncBridgeACLs brings the ACL of every namespace bridge up to date with the subnets of the
+// other windlass bridges, and applies it to the bridge if it isn't already
+func syncBridgeACLs(ctx context.Context, conn lxdclient.ContainerServer) error {
+	networks, err := conn.GetNetworks()
+	if err != nil {
+		return fmt.Errorf("error listing LXD networks: %w", err)
+	}
+
+	// the shared bridge is recorded under the empty namespace, which no namespace bridge belongs to
+	subnets := make(map[string]string)
+	for _, network := range networks {
+		namespace, ok := network.Config[namespaceConfigKey]
+		if network.Name != viper.GetString("lxd.network.name") && !ok {
+			continue
+		}
+		if _, subnet, err := net.ParseCIDR(network.Config["ipv4.address"]); err == nil {
+			subnets[namespace] = subnet.String()
+		}
+	}
+
+	for _, network := range networks {
+		namespace, ok := network.Config[namespaceConfigKey]
+		if !ok {
+			continue
+		}
+		// netMu is held while syncing, so a hung LXD server mustnt keep it forever
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var others []string
+		for other, subnet := range subnets {
+			if other != namespace {
+				others = append(others, subnet)
+			}
+		}
+		sort.Strings(others)
+
+		if err := putACL(conn, namespaceACL(namespace, others, nil)); err != nil {
+			return err
+		}
+
+		name := namespaceACLName(namespace)
+		if network.Config["security.acls"] == name {
+			continue
+		}
+
+		put := network.NetworkPut
+		put.Config["security.acls"] = name
+		put.Config["security.acls.default.egress.action"] = "allow"
+		put.Config["security.acls.default.ingress.action"] = "allow"
+		if err := conn.UpdateNetwork(network.Name, put, ""); err != nil {
+			return fmt.Errorf("error applying ACL %s to network %s: %w", name, network.Name, err)
+		}
+	}
+	return nil
+}
+
+// syncNamespaceACL brings a namespace's ACL on the shared bridge up to date with the addresses of
+// the namespace's hosts. extra are the addresses of hosts about to be created
+func syncNamespaceACL(ctx context.Context, conn lxdclient.ContainerServer, namespace string, extra ...net.IP) error {
+	gateway, subnet, err := bridgeSubnet(conn, viper.GetString("lxd.network.name"))
+	if err != nil {
+		return err
+	}
+
+	hosts, err := namespaceHosts(conn, namespace)
+	if err != nil {
+		return err
+	}
+
+	allowed := append([]net.IP{gateway}, extra...)
+	for _, host := range hosts {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		ip, err := hostAddress(conn, host)
+		if err != nil {
+			return err
+		}
+		if ip != nil {
+			allowed = append(allowed, ip)
+		}
+	}
+
+	if err := putACL(conn, namespaceACL(namespace, nil, excludeAddresses(subnet, allowed))); err != nil {
+		return err
+	}
+
+	// NICs without a default action reject whatever the ACL doesnt allow, which for hosts created
+	// before the ACL only held drop rules would be everything
+	for _, host := range hosts {
+		nic, ok := host.Devices["eth0"]
+		if !ok || nic["security.acls"] != namespaceACLName(namespace) || nic["security.acls.default.egress.action"] == "allow" {
+			continue
+		}
+		nic["security.acls.default.egress.action"] = "allow"
+		nic["security.acls.default.ingress.action"] = "allow"
+
+		op, err := conn.UpdateContainer(host.Name, host.Writable(), "")
+		if err != nil {
+			return fmt.Errorf("error updating NIC of %s: %w", host.Name, err)
+		}
+		if err := helpers.OperationTimeout(ctx, op); err != nil {
+			return fmt.Errorf("error updating NIC of %s: %w", host.Name, err)
+		}
+	}
+	return nil
+}
+
+// namespaceACL builds the ACL for a namespace that drops traffic to and from the given subnets and
+// address ranges. LXD evaluates drop rules before allow rules, so rather than allowing the
+// namespace's own hosts the ranges must already leave them out
+func namespaceACL(namespace string, subnets, ranges []string) networkACL {
+	acl := networkACL{
+		Name:        namespaceACLName(namespace),
+		Description: fmt.Sprintf("Windlass isolation for namespace %s", namespace),
+		Ingress:     []networkACLRule{},
+		Egress:      []networkACLRule{},
+		Config: map[string]string{
+			namespaceConfigKey: namespace,
+		},
+	}
+
+	blocked := strings.Join(append(append([]string{}, subnets...), ranges...), ",")
+	if blocked != "" {
+		acl.Ingress = append(acl.Ingress, networkACLRule{Action: "drop", Source: blocked, State: "enabled", Description: "other namespaces"})
+		acl.Egress = append(acl.Egress, networkACLRule{Action: "drop", Destination: blocked, State: "enabled", Description: "other namespaces"})
+	}
+	return acl
+}
+
+// putACL creates the ACL, or replaces the rules of the existing one if they differ. An existing
+// ACL of the same name that isn't this namespace's is left alone
+func putACL(conn lxdclient.ContainerServer, acl networkACL) error {
+	resp, _, err := conn.RawQuery("GET", "/1.0/network-acls/"+acl.Name, nil, "")
+	if err != nil {
+		if !strings.HasSuffix(err.Error(), "not found") {
+			return fmt.Errorf("error getting network ACL %s: %w", acl.Name, err)
+		}
+
+		log.WithFields(log.Fields{
+			"acl":       acl.Name,
+			"namespace": acl.Config[namespaceConfigKey],
+		}).Info("creating LXD network ACL")
+
+		if _, _, err := conn.RawQuery("POST", "/1.0/network-acls", acl, ""); err != nil {
+			return fmt.Errorf("error creating network ACL %s: %w", acl.Name, err)
+		}
+		return nil
+	}
+
+	var existing networkACL
+	if err := json.Unmarshal(resp.Metadata, &existing); err != nil {
+		return fmt.Errorf("error decoding network ACL %s: %w", acl.Name, err)
+	}
+	if existing.Config[namespaceConfigKey] != acl.Config[namespaceConfigKey] {
+		return fmt.Errorf("network ACL %s exists but doesnt belong to namespace %s", acl.Name, acl.Config[namespaceConfigKey])
+	}
+	if reflect.DeepEqual(existing.Ingress, acl.Ingress) && reflect.DeepEqual(existing.Egress, acl.Egress) {
+		return nil
+	}
+
+	log.WithFields(log.Fields{
+		"acl":       acl.Name,
+		"namespace": acl.Config[namespaceConfigKey],
+	}).Info("updating LXD network ACL rules")
+
+	put := struct {
+		Description string            `json:"description"`
+		Ingress     []networkACLRule  `json:"ingress"`
+		Egress      []networkACLRule  `json:"egress"`
+		Config      map[string]string `json:"config"`
+	}{acl.Description, acl.Ingress, acl.Egress, acl.Config}
+	if _, _, err := conn.RawQuery("PUT", "/1.0/network-acls/"+acl.Name, put, ""); err != nil {
+		return fmt.Errorf("error updating network ACL %s: %w", acl.Name, err)
+	}
+	return nil
+}
+
+func listACLs(conn lxdclient.ContainerServer) ([]networkACL, error) {
+	if !conn.HasExtension("network_acl") {
+		return nil, nil
+	}
+
+	resp, _, err := conn.RawQuery("GET", "/1.0/network-acls?recursion=1", nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("error listing network ACLs: %w", err)
+	}
+
+	var acls []networkACL
+	if err := json.Unmarshal(resp.Metadata, &acls); err != nil {
+		return nil, fmt.Errorf("error decoding network ACLs: %w", err)
+	}
+	return acls, nil
+}
+
+// namespaceHosts returns the container hosts on the remote that belong to a namespace
+func namespaceHosts(conn lxdclient.ContainerServer, namespace string) ([]api.Container, error) {
+	containers, err := conn.GetContainers()
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %w", err)
+	}
+
+	var hosts []api.Container
+	for _, container := range containers {
+		if ns, ok := container.Config[namespaceConfigKey]; ok && ns == namespace {
+			hosts = append(hosts, container)
+		}
+	}
+	return hosts, nil
+}
+
+// hostAddress returns the static address of a host's NIC, or the address it was given over DHCP
+// for hosts created before addresses were assigned statically. nil if it has neither
+func hostAddress(conn lxdclient.ContainerServer, host api.Container) (net.IP, error) {
+	if ip := net.ParseIP(host.Devices["eth0"]["ipv4.address"]); ip != nil {
+		return ip, nil
+	}
+
+	state, _, err := conn.GetContainerState(host.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting state of %s: %w", host.Name, err)
+	}
+	for _, addr := range state.Network["eth0"].Addresses {
+		if addr.Family == "inet" {
+			return net.ParseIP(addr.Address), nil
+		}
+	}
+	return nil, nil
+}
+
+// allocateHostIP picks a free address on the shared bridge, skipping addresses assigned to other
+// hosts or leased out over DHCP
+func allocateHostIP(conn lxdclient.ContainerServer) (net.IP, error) {
+	bridge := viper.GetString("lxd.network.name")
+	gateway, subnet, err := bridgeSubnet(conn, bridge)
+	if err != nil {
+		return nil, err
+	}
+
+	used := map[uint32]bool{ipToUint(gateway): true}
+
+	containers, err := conn.GetContainers()
+	if err != nil {
+		return nil, fmt.Errorf("error listing containers: %w", err)
+	}
+	for _, container := range containers {
+		for _, device := range container.Devices {
+			if ip := net.ParseIP(device["ipv4.address"]); ip != nil {
+				used[ipToUint(ip)] = true
+			}
+		}
+	}
+
+	leases, err := conn.GetNetworkLeases(bridge)
+	if err != nil {
+		return nil, fmt.Errorf("error listing leases on network %s: %w", bridge, err)
+	}
+	for _, lease := range leases {
+		if ip := net.ParseIP(lease.Address); ip != nil && ip.To4() != nil {
+			used[ipToUint(ip)] = true
+		}
+	}
+
+	first, last := subnetBounds(subnet)
+	// the network and broadcast addresses are never handed out
+	for n := first + 1; n < last; n++ {
+		if !used[n] {
+			return uintToIP(n), nil
+		}
+	}
+	return nil, fmt.Errorf("no free addresses left on network %s", bridge)
+}
+
+// excludeAddresses returns the address ranges making up subnet without the given addresses, in
+// the a.b.c.d-e.f.g.h form LXD ACLs accept
+func excludeAddresses(subnet *net.IPNet, exclude []net.IP) []string {
+	first, last := subnetBounds(subnet)
+
+	skip := make([]uint32, 0, len(exclude))
+	for _, ip := range exclude {
+		if ip.To4() != nil && subnet.Contains(ip) {
+			skip = append(skip, ipToUint(ip))
+		}
+	}
+	sort.Slice(skip, func(i, j int) bool { return skip[i] < skip[j] })
+
+	var ranges []string
+	next := first
+	for _, n := range skip {
+		if n > next {
+			ranges = append(ranges, addressRange(next, n-1))
+		}
+		if n >= next {
+			next = n + 1
+		}
+	}
+	if next <= last && next != 0 {
+		ranges = append(ranges, addressRange(next, last))
+	}
+	return ranges
+}
+
+func addressRange(from, to uint32) string {
+	if from == to {
+		return uintToIP(from).String()
+	}
+	return uintToIP(from).String() + "-" + uintToIP(to).String()
+}
+
+func subnetBounds(subnet *net.IPNet) (uint32, uint32) {
+	first := ipToUint(subnet.IP)
+	ones, bits := subnet.Mask.Size()
+	return first, first | uint32(1<<uint(bits-ones)-1)
+}
+
+func ipToUint(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func uintToIP(n uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, n)
+	return ip
+}
+
+// bridgeSubnet returns the address LXD assigned to the bridge itself and the bridge's subnet
+func bridgeSubnet(conn lxdclient.ContainerServer, name string) (net.IP, *net.IPNet, error) {
+	network, _, err := conn.GetNetwork(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting network %s: %w", name, err)
+	}
+
+	ip, subnet, err := net.ParseCIDR(network.Config["ipv4.address"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("network %s has no usable ipv4.address: %w", name, err)
+	}
+	return ip, subnet, nil
+}
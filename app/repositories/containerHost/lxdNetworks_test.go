@@ -0,0 +1,203 @@
+package host
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/spf13/viper"
+)
+
+// fakeNetworkServer serves the shared bridge, its hosts and its DHCP leases
+type fakeNetworkServer struct {
+	lxdclient.ContainerServer
+
+	bridgeAddress string
+	containers    []api.Container
+	leases        []api.NetworkLease
+}
+
+func (s fakeNetworkServer) GetNetwork(name string) (*api.Network, string, error) {
+	return &api.Network{
+		Name: name,
+		NetworkPut: api.NetworkPut{
+			Config: map[string]string{"ipv4.address": s.bridgeAddress},
+		},
+	}, "", nil
+}
+
+func (s fakeNetworkServer) GetContainers() ([]api.Container, error) {
+	return s.containers, nil
+}
+
+func (s fakeNetworkServer) GetNetworkLeases(name string) ([]api.NetworkLease, error) {
+	return s.leases, nil
+}
+
+func hostWithAddress(name, ip string) api.Container {
+	return api.Container{
+		Name: name,
+		ContainerPut: api.ContainerPut{
+			Devices: map[string]map[string]string{
+				"eth0": {"type": "nic", "ipv4.address": ip},
+			},
+		},
+	}
+}
+
+func TestAllocateHostIP(t *testing.T) {
+	viper.Set("lxd.network.name", "windlassbr0")
+	defer viper.Set("lxd.network.name", nil)
+
+	tests := []struct {
+		name    string
+		server  fakeNetworkServer
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "empty bridge skips the gateway",
+			server: fakeNetworkServer{bridgeAddress: "10.10.0.1/24"},
+			want:   "10.10.0.2",
+		},
+		{
+			name:   "gateway not first",
+			server: fakeNetworkServer{bridgeAddress: "10.10.0.254/24"},
+			want:   "10.10.0.1",
+		},
+		{
+			name: "skips static addresses",
+			server: fakeNetworkServer{
+				bridgeAddress: "10.10.0.1/24",
+				containers:    []api.Container{hostWithAddress("a", "10.10.0.2"), hostWithAddress("b", "10.10.0.3")},
+			},
+			want: "10.10.0.4",
+		},
+		{
+			name: "skips leases",
+			server: fakeNetworkServer{
+				bridgeAddress: "10.10.0.1/24",
+				leases:        []api.NetworkLease{{Address: "10.10.0.2"}, {Address: "fd42::2"}},
+			},
+			want: "10.10.0.3",
+		},
+		{
+			name: "fills gaps",
+			server: fakeNetworkServer{
+				bridgeAddress: "10.10.0.1/24",
+				containers:    []api.Container{hostWithAddress("a", "10.10.0.3")},
+			},
+			want: "10.10.0.2",
+		},
+		{
+			name: "full",
+			server: fakeNetworkServer{
+				bridgeAddress: "10.10.0.1/30",
+				containers:    []api.Container{hostWithAddress("a", "10.10.0.2")},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no ipv4 subnet",
+			server:  fakeNetworkServer{bridgeAddress: "none"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, err := allocateHostIP(tt.server)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("allocateHostIP() = %s, want an error", ip)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("allocateHostIP() error = %v", err)
+			}
+			if ip.String() != tt.want {
+				t.Errorf("allocateHostIP() = %s, want %s", ip, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludeAddresses(t *testing.T) {
+	ips := func(addrs ...string) []net.IP {
+		out := make([]net.IP, 0, len(addrs))
+		for _, addr := range addrs {
+			out = append(out, net.ParseIP(addr))
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		subnet  string
+		exclude []net.IP
+		want    []string
+	}{
+		{
+			name:   "nothing excluded",
+			subnet: "10.10.0.0/24",
+			want:   []string{"10.10.0.0-10.10.0.255"},
+		},
+		{
+			name:    "gateway and hosts",
+			subnet:  "10.10.0.0/24",
+			exclude: ips("10.10.0.1", "10.10.0.5", "10.10.0.6"),
+			want:    []string{"10.10.0.0", "10.10.0.2-10.10.0.4", "10.10.0.7-10.10.0.255"},
+		},
+		{
+			name:    "unsorted and duplicated",
+			subnet:  "10.10.0.0/24",
+			exclude: ips("10.10.0.9", "10.10.0.1", "10.10.0.9"),
+			want:    []string{"10.10.0.0", "10.10.0.2-10.10.0.8", "10.10.0.10-10.10.0.255"},
+		},
+		{
+			name:    "bounds",
+			subnet:  "10.10.0.0/24",
+			exclude: ips("10.10.0.0", "10.10.0.255"),
+			want:    []string{"10.10.0.1-10.10.0.254"},
+		},
+		{
+			name:    "outside the subnet and ipv6 ignored",
+			subnet:  "10.10.0.0/24",
+			exclude: ips("10.10.1.1", "fd42::1"),
+			want:    []string{"10.10.0.0-10.10.0.255"},
+		},
+		{
+			name:    "ipv4 mapped ipv6",
+			subnet:  "10.10.0.0/24",
+			exclude: ips("::ffff:10.10.0.1"),
+			want:    []string{"10.10.0.0", "10.10.0.2-10.10.0.255"},
+		},
+		{
+			name:    "everything",
+			subnet:  "10.10.0.0/30",
+			exclude: ips("10.10.0.0", "10.10.0.1", "10.10.0.2", "10.10.0.3"),
+			want:    nil,
+		},
+		{
+			name:    "top of the address space",
+			subnet:  "255.255.255.252/30",
+			exclude: ips("255.255.255.255"),
+			want:    []string{"255.255.255.252-255.255.255.254"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, subnet, err := net.ParseCIDR(tt.subnet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := excludeAddresses(subnet, tt.exclude); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("excludeAddresses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+	"github.com/UCCNetworkingSociety/Windlass-worker/utils/writecloser"
+)
+
+// ApplyNginxConfig replaces the managed config file at `nginx.configPath` in the container host
+// and reloads nginx. If `nginx -t` rejects the new config the previous file is put back and
+// nginx is left running the previous config
+func (lxd *lxdHost) ApplyNginxConfig(ctx context.Context, opts NginxConfigOptions) error {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	path := viper.GetString("nginx.configPath")
+
+	var previous []byte
+	body, _, err := conn.GetContainerFile(opts.Name, path)
+	switch {
+	case err != nil && !strings.HasSuffix(err.Error(), "not found"):
+		return fmt.Errorf("error reading previous nginx config: %w", err)
+	case err == nil:
+		defer body.Close()
+		if previous, err = ioutil.ReadAll(body); err != nil {
+			return fmt.Errorf("error reading previous nginx config: %w", err)
+		}
+	}
+
+	if err := pushHostFile(conn, opts.Name, path, opts.Config, 0644); err != nil {
+		return err
+	}
+
+	out, code, err := execHost(ctx, conn, opts.Name, "nginx", "-t")
+	if err != nil {
+		return fmt.Errorf("error testing nginx config: %w", err)
+	}
+	if code != 0 {
+		var restoreErr error
+		if previous != nil {
+			restoreErr = pushHostFile(conn, opts.Name, path, previous, 0644)
+		} else {
+			restoreErr = conn.DeleteContainerFile(opts.Name, path)
+		}
+		if restoreErr != nil {
+			return fmt.Errorf("error restoring previous nginx config after nginx -t failed: %w", restoreErr)
+		}
+		return fmt.Errorf("%w: %s", ErrInvalidNginxConfig, strings.TrimSpace(out))
+	}
+
+	out, code, err = execHost(ctx, conn, opts.Name, "systemctl", "reload", "nginx")
+	if err != nil {
+		return fmt.Errorf("error reloading nginx: %w", err)
+	}
+	if code != 0 {
+		return fmt.Errorf("error reloading nginx: %s", strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// PushIngressCert writes a hostname's certificate and key to `nginx.certDir` in the container host.
+// nginx only picks them up on its next reload
+func (lxd *lxdHost) PushIngressCert(ctx context.Context, opts IngressCertOptions) error {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	dir := viper.GetString("nginx.certDir")
+	if err := ensureHostDir(ctx, conn, opts.Name, dir); err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	errs = multierror.Append(errs,
+		pushHostFile(conn, opts.Name, path.Join(dir, opts.Hostname+".crt"), opts.CertPEM, 0644),
+		pushHostFile(conn, opts.Name, path.Join(dir, opts.Hostname+".key"), opts.KeyPEM, 0600),
+	)
+	return errs.ErrorOrNil()
+}
+
+// PutACMEChallenge writes the response to an ACME HTTP-01 challenge to `nginx.challengeDir` in the
+// container host, where the ingress config serves it from
+func (lxd *lxdHost) PutACMEChallenge(ctx context.Context, opts ACMEChallengeOptions) error {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	dir := viper.GetString("nginx.challengeDir")
+	if err := ensureHostDir(ctx, conn, opts.Name, dir); err != nil {
+		return err
+	}
+	return pushHostFile(conn, opts.Name, path.Join(dir, path.Base(opts.Token)), []byte(opts.KeyAuth), 0644)
+}
+
+func (lxd *lxdHost) DeleteACMEChallenge(ctx context.Context, opts ACMEChallengeOptions) error {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	err = conn.DeleteContainerFile(opts.Name, path.Join(viper.GetString("nginx.challengeDir"), path.Base(opts.Token)))
+	if err != nil && !strings.HasSuffix(err.Error(), "not found") {
+		return err
+	}
+	return nil
+}
+
+func ensureHostDir(ctx context.Context, conn lxdclient.ContainerServer, name, dir string) error {
+	out, code, err := execHost(ctx, conn, name, "mkdir", "-p", dir)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	if code != 0 {
+		return fmt.Errorf("error creating %s: %s", dir, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+func pushHostFile(conn lxdclient.ContainerServer, name, path string, content []byte, mode int) error {
+	err := conn.CreateContainerFile(name, path, lxdclient.ContainerFileArgs{
+		UID: 0, GID: 0, Content: bytes.NewReader(content), Mode: mode, Type: "file", WriteMode: "overwrite",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to push %s: %w", path, err)
+	}
+	return nil
+}
+
+// execHost runs a command in a container host, returning its combined output and exit code
+func execHost(ctx context.Context, conn lxdclient.ContainerServer, name string, command ...string) (string, int, error) {
+	out := &writecloser.BytesBuffer{Buffer: bytes.NewBuffer(nil)}
+	dataDone := make(chan bool)
+	op, err := conn.ExecContainer(name, api.ContainerExecPost{
+		Command:   command,
+		WaitForWS: true,
+	}, &lxdclient.ContainerExecArgs{
+		Stdout:   out,
+		Stderr:   out,
+		DataDone: dataDone,
+	})
+	if err != nil {
+		return "", -1, err
+	}
+	if err := helpers.OperationTimeout(ctx, op); err != nil {
+		return "", -1, err
+	}
+	<-dataDone
+
+	code, _ := op.Get().Metadata["return"].(float64)
+	return out.String(), int(code), nil
+}
@@ -0,0 +1,238 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/spf13/viper"
+)
+
+// lxdRemoteConfig is a single entry under `lxd.remotes`
+type lxdRemoteConfig struct {
+	// unix:///path/to/unix.socket or https://host:8443
+	URL string `mapstructure:"url"`
+	// Paths to the PEM encoded client certificate and key trusted by the remote
+	ClientCert string `mapstructure:"clientCert"`
+	ClientKey  string `mapstructure:"clientKey"`
+	// Path to the remote's server certificate. If empty the system CAs are used
+	ServerCert string `mapstructure:"serverCert"`
+	// Set if this worker can reach the bridges on every member of the remote, such as over a
+	// static route or VPN. Without it hosts are only placed where the worker runs
+	Routed bool `mapstructure:"routed"`
+}
+
+// lxdRemotes holds a connection per configured LXD endpoint and remembers which
+// remote each container host lives on
+type lxdRemotes struct {
+	names   []string
+	conns   map[string]lxdclient.ContainerServer
+	configs map[string]lxdRemoteConfig
+
+	mu        *sync.RWMutex
+	locations map[string]string
+}
+
+func defaultRemote() string {
+	return viper.GetString("lxd.defaultRemote")
+}
+
+// connectRemotes connects to every remote under `lxd.remotes`. If none are configured
+// the local unix socket at `lxd.socket` is used as the default remote.
+func connectRemotes() (*lxdRemotes, error) {
+	configs := make(map[string]lxdRemoteConfig)
+	if err := viper.UnmarshalKey("lxd.remotes", &configs); err != nil {
+		return nil, fmt.Errorf("invalid lxd.remotes config: %v", err)
+	}
+
+	if len(configs) == 0 {
+		configs[defaultRemote()] = lxdRemoteConfig{
+			URL: "unix://" + viper.GetString("lxd.socket"),
+		}
+	}
+
+	if _, ok := configs[defaultRemote()]; !ok {
+		return nil, fmt.Errorf("default LXD remote %s is not configured", defaultRemote())
+	}
+
+	remotes := &lxdRemotes{
+		conns:     make(map[string]lxdclient.ContainerServer),
+		configs:   configs,
+		mu:        new(sync.RWMutex),
+		locations: make(map[string]string),
+	}
+
+	for name, config := range configs {
+		conn, err := connectRemote(config)
+		if err != nil {
+			return nil, fmt.Errorf("couldnt connect to LXD remote %s: %v", name, err)
+		}
+		remotes.conns[name] = conn
+		remotes.names = append(remotes.names, name)
+	}
+
+	// the default remote is searched first, the rest in a stable order
+	sort.Slice(remotes.names, func(i, j int) bool {
+		if remotes.names[i] == defaultRemote() || remotes.names[j] == defaultRemote() {
+			return remotes.names[i] == defaultRemote()
+		}
+		return remotes.names[i] < remotes.names[j]
+	})
+
+	return remotes, nil
+}
+
+func connectRemote(config lxdRemoteConfig) (lxdclient.ContainerServer, error) {
+	if strings.HasPrefix(config.URL, "unix://") {
+		return lxdclient.ConnectLXDUnix(strings.TrimPrefix(config.URL, "unix://"), &lxdclient.ConnectionArgs{
+			UserAgent: "Windlass",
+		})
+	}
+
+	args := &lxdclient.ConnectionArgs{
+		UserAgent: "Windlass",
+	}
+
+	files := []struct {
+		path string
+		dest *string
+	}{
+		{config.ClientCert, &args.TLSClientCert},
+		{config.ClientKey, &args.TLSClientKey},
+		{config.ServerCert, &args.TLSServerCert},
+	}
+
+	for _, file := range files {
+		if file.path == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(file.path)
+		if err != nil {
+			return nil, err
+		}
+		*file.dest = string(b)
+	}
+
+	return lxdclient.ConnectLXD(config.URL, args)
+}
+
+// get returns the connection for a named remote, or the default remote if name is empty
+func (r *lxdRemotes) get(name string) (lxdclient.ContainerServer, error) {
+	if name == "" {
+		name = defaultRemote()
+	}
+
+	conn, ok := r.conns[name]
+	if !ok {
+		return nil, ErrUnknownRemote
+	}
+	return conn, nil
+}
+
+// placement returns the cluster member a new host on the remote should be created on. The worker
+// talks to each host's Docker daemon over the host's bridge, which unless the remote is routed is
+// only reachable on the LXD server the worker runs on: the local socket's own cluster member
+func (r *lxdRemotes) placement(remote, target string) (string, error) {
+	if remote == "" {
+		remote = defaultRemote()
+	}
+
+	conn, ok := r.conns[remote]
+	if !ok {
+		return "", ErrUnknownRemote
+	}
+	if target != "" && !conn.IsClustered() {
+		return "", ErrNotClustered
+	}
+
+	config := r.configs[remote]
+	if config.Routed {
+		return target, nil
+	}
+	if !strings.HasPrefix(config.URL, "unix://") {
+		return "", ErrRemoteUnreachable
+	}
+	if !conn.IsClustered() {
+		return target, nil
+	}
+
+	server, _, err := conn.GetServer()
+	if err != nil {
+		return "", err
+	}
+	local := server.Environment.ServerName
+	if target != "" && target != local {
+		return "", ErrRemoteUnreachable
+	}
+	return local, nil
+}
+
+// forHost returns the connection for the remote that the named container host lives on.
+// For clustered remotes the connection is to the cluster as a whole, LXD forwards requests
+// to whichever member holds the container.
+func (r *lxdRemotes) forHost(name string) (lxdclient.ContainerServer, error) {
+	r.mu.RLock()
+	remote, ok := r.locations[name]
+	r.mu.RUnlock()
+	if ok {
+		return r.conns[remote], nil
+	}
+
+	for _, remote := range r.names {
+		if _, _, err := r.conns[remote].GetContainer(name); err == nil {
+			r.setLocation(name, remote)
+			return r.conns[remote], nil
+		}
+	}
+	return nil, ErrHostNotFound
+}
+
+func (r *lxdRemotes) setLocation(name, remote string) {
+	if remote == "" {
+		remote = defaultRemote()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.locations[name] = remote
+}
+
+func (r *lxdRemotes) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.locations, name)
+}
+
+func (lxd *lxdHost) ListRemotes(ctx context.Context) ([]Remote, error) {
+	remotes := make([]Remote, 0, len(lxd.remotes.names))
+
+	for _, name := range lxd.remotes.names {
+		conn := lxd.remotes.conns[name]
+		remote := Remote{
+			Name:      name,
+			Default:   name == defaultRemote(),
+			Clustered: conn.IsClustered(),
+		}
+
+		if remote.Clustered {
+			members, err := conn.GetClusterMembers()
+			if err != nil {
+				return nil, fmt.Errorf("error listing members of remote %s: %w", name, err)
+			}
+			for _, member := range members {
+				remote.Members = append(remote.Members, RemoteMember{
+					Name:   member.ServerName,
+					URL:    member.URL,
+					Status: member.Status,
+				})
+			}
+		}
+
+		remotes = append(remotes, remote)
+	}
+
+	return remotes, nil
+}
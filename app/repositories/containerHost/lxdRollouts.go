@@ -0,0 +1,237 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/utils/writecloser"
+)
+
+// seconds a container is given to stop before it is killed
+const containerStopTimeout = 10
+
+func (lxd *lxdHost) InspectContainer(ctx context.Context, opts ContainerInspectOptions) (*Container, error) {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctr, err := client.InspectContainerWithOptions(docker.InspectContainerOptions{
+		Context: ctx,
+		ID:      opts.Container,
+	})
+	if _, ok := err.(*docker.NoSuchContainer); ok {
+		return nil, ErrContainerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error inspecting container: %w", err)
+	}
+
+	var ports []container.PortMapping
+	if ctr.HostConfig != nil {
+		for port, bindings := range ctr.HostConfig.PortBindings {
+			ctrPort, _ := strconv.ParseUint(port.Port(), 10, 16)
+			for _, binding := range bindings {
+				hostPort, _ := strconv.ParseUint(binding.HostPort, 10, 16)
+				ports = append(ports, container.PortMapping{
+					ContainerPort: uint16(ctrPort),
+					HostPort:      uint16(hostPort),
+					Protocol:      port.Proto(),
+					HostIP:        binding.HostIP,
+				})
+			}
+		}
+	}
+
+	healthcheck := ctr.Config.Healthcheck != nil && len(ctr.Config.Healthcheck.Test) > 0 && ctr.Config.Healthcheck.Test[0] != "NONE"
+
+	var ip string
+	if ctr.NetworkSettings != nil {
+		ip = ctr.NetworkSettings.Networks[projectNetwork].IPAddress
+	}
+
+	return &Container{
+		ID:          ctr.ID,
+		Name:        strings.TrimPrefix(ctr.Name, "/"),
+		Image:       ctr.Config.Image,
+		State:       ctr.State.StateString(),
+		Labels:      ctr.Config.Labels,
+		Ports:       ports,
+		Healthcheck: healthcheck,
+		IPAddress:   ip,
+	}, nil
+}
+
+// CloneContainer creates a copy of a container, optionally with a different image, and starts it
+// unless CreateOnly is set
+func (lxd *lxdHost) CloneContainer(ctx context.Context, opts ContainerCloneOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	ctr, err := client.InspectContainerWithOptions(docker.InspectContainerOptions{
+		Context: ctx,
+		ID:      opts.Container,
+	})
+	if _, ok := err.(*docker.NoSuchContainer); ok {
+		return ErrContainerNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error inspecting container: %w", err)
+	}
+
+	config := *ctr.Config
+	if opts.Image != "" {
+		config.Image = opts.Image
+	}
+	// Docker sets the hostname to the container ID unless one was given
+	if strings.HasPrefix(ctr.ID, config.Hostname) {
+		config.Hostname = ""
+	}
+
+	hostConfig := *ctr.HostConfig
+	if opts.Unpublished {
+		hostConfig.PortBindings = nil
+	}
+
+	endpoint := &docker.EndpointConfig{}
+	if opts.Alias != "" {
+		endpoint.Aliases = []string{opts.Alias}
+	}
+
+	newCtr, err := client.CreateContainer(docker.CreateContainerOptions{
+		Context:    ctx,
+		Name:       opts.As,
+		Config:     &config,
+		HostConfig: &hostConfig,
+		NetworkingConfig: &docker.NetworkingConfig{
+			EndpointsConfig: map[string]*docker.EndpointConfig{projectNetwork: endpoint},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating container: %w", err)
+	}
+	if opts.CreateOnly {
+		return nil
+	}
+
+	if err := client.StartContainerWithContext(newCtr.ID, nil, ctx); err != nil {
+		return fmt.Errorf("error starting container: %w", err)
+	}
+	return nil
+}
+
+func (lxd *lxdHost) RenameContainer(ctx context.Context, opts ContainerRenameOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := client.RenameContainer(docker.RenameContainerOptions{
+		ID:      opts.Container,
+		Name:    opts.NewName,
+		Context: ctx,
+	}); err != nil {
+		return fmt.Errorf("error renaming container: %w", err)
+	}
+	return nil
+}
+
+func (lxd *lxdHost) StartContainer(ctx context.Context, opts ContainerStartOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	err = client.StartContainerWithContext(opts.Container, nil, ctx)
+	if _, ok := err.(*docker.ContainerAlreadyRunning); ok {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error starting container: %w", err)
+	}
+	return nil
+}
+
+func (lxd *lxdHost) StopContainer(ctx context.Context, opts ContainerStopOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	err = client.StopContainerWithContext(opts.Container, containerStopTimeout, ctx)
+	if _, ok := err.(*docker.ContainerNotRunning); ok {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error stopping container: %w", err)
+	}
+	return nil
+}
+
+// SetContainerAlias reconnects a container to the project network under a new alias
+func (lxd *lxdHost) SetContainerAlias(ctx context.Context, opts ContainerAliasOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := client.DisconnectNetwork(projectNetwork, docker.NetworkConnectionOptions{
+		Container: opts.Container,
+		Force:     true,
+		Context:   ctx,
+	}); err != nil {
+		return fmt.Errorf("error disconnecting container from network: %w", err)
+	}
+
+	if err := client.ConnectNetwork(projectNetwork, docker.NetworkConnectionOptions{
+		Container:      opts.Container,
+		EndpointConfig: &docker.EndpointConfig{Aliases: []string{opts.Alias}},
+		Context:        ctx,
+	}); err != nil {
+		return fmt.Errorf("error connecting container to network: %w", err)
+	}
+	return nil
+}
+
+// probe reports whether a container accepts TCP connections on a port. The container's address
+// is only reachable from within its container host, so the connection is made from there
+func (lxd *lxdHost) probe(ctx context.Context, name string, ctr *docker.Container, port uint16) bool {
+	network, ok := ctr.NetworkSettings.Networks[projectNetwork]
+	if !ok || network.IPAddress == "" {
+		return false
+	}
+
+	conn, err := lxd.remotes.forHost(name)
+	if err != nil {
+		return false
+	}
+
+	out := &writecloser.BytesBuffer{Buffer: bytes.NewBuffer(nil)}
+	op, err := conn.ExecContainer(name, api.ContainerExecPost{
+		Command:   []string{"timeout", "2", "bash", "-c", fmt.Sprintf("exec 3<>/dev/tcp/%s/%d", network.IPAddress, port)},
+		WaitForWS: true,
+	}, &lxdclient.ContainerExecArgs{
+		Stdout: out,
+		Stderr: out,
+	})
+	if err != nil {
+		return false
+	}
+	if err := helpers.OperationTimeout(ctx, op); err != nil {
+		return false
+	}
+
+	code, ok := op.Get().Metadata["return"].(float64)
+	return ok && code == 0
+}
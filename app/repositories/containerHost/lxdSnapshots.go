@@ -0,0 +1,141 @@
+package host
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lxc/lxd/shared/api"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/snapshot"
+)
+
+func (lxd *lxdHost) CreateSnapshot(ctx context.Context, opts SnapshotCreateOptions) error {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	op, err := conn.CreateContainerSnapshot(opts.Name, api.ContainerSnapshotsPost{
+		Name:     opts.Snapshot,
+		Stateful: opts.Stateful,
+	})
+	if err != nil {
+		return lxd.parseSnapshotError(err)
+	}
+
+	return lxd.parseSnapshotError(helpers.OperationTimeoutCleanup(ctx, op, func(ctx context.Context) error {
+		op, err := conn.DeleteContainerSnapshot(opts.Name, opts.Snapshot)
+		if err != nil {
+			return err
+		}
+		return helpers.OperationTimeout(ctx, op)
+	}))
+}
+
+func (lxd *lxdHost) ListSnapshots(ctx context.Context, name string) ([]snapshot.Snapshot, error) {
+	conn, err := lxd.remotes.forHost(name)
+	if err != nil {
+		return nil, err
+	}
+
+	lxdSnapshots, err := conn.GetContainerSnapshots(name)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]snapshot.Snapshot, 0, len(lxdSnapshots))
+	for _, snap := range lxdSnapshots {
+		// LXD names snapshots `container/snapshot`
+		snapName := strings.TrimPrefix(snap.Name, name+"/")
+		snapshots = append(snapshots, snapshot.Snapshot{
+			Name:      snapName,
+			CreatedAt: snap.CreatedAt,
+			Stateful:  snap.Stateful,
+			Scheduled: strings.HasPrefix(snapName, snapshot.ScheduledPrefix),
+		})
+	}
+
+	return snapshots, nil
+}
+
+func (lxd *lxdHost) DeleteSnapshot(ctx context.Context, opts SnapshotOptions) error {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	op, err := conn.DeleteContainerSnapshot(opts.Name, opts.Snapshot)
+	if err != nil {
+		return lxd.parseSnapshotError(err)
+	}
+
+	// deletes are retried once an abandoned one fails, so the snapshot ends up gone either way
+	return lxd.parseSnapshotError(helpers.OperationTimeoutSettle(ctx, op, func(ctx context.Context, opErr error) error {
+		if opErr == nil {
+			return nil
+		}
+		op, err := conn.DeleteContainerSnapshot(opts.Name, opts.Snapshot)
+		if err != nil {
+			if lxd.parseSnapshotError(err) == ErrSnapshotNotFound {
+				return nil
+			}
+			return err
+		}
+		return helpers.OperationTimeout(ctx, op)
+	}))
+}
+
+func (lxd *lxdHost) RestoreSnapshot(ctx context.Context, opts SnapshotRestoreOptions) error {
+	conn, err := lxd.remotes.forHost(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	state, _, err := conn.GetContainerState(opts.Name)
+	if err != nil {
+		return err
+	}
+	wasRunning := state.StatusCode == api.Running
+
+	op, err := conn.UpdateContainer(opts.Name, api.ContainerPut{
+		Restore:  opts.Snapshot,
+		Stateful: opts.Stateful,
+	}, "")
+	if err != nil {
+		return lxd.parseSnapshotError(err)
+	}
+
+	// restores stop the host while they run. Whichever state an abandoned restore leaves the
+	// host's filesystem in, a host that was running is started again
+	return lxd.parseSnapshotError(helpers.OperationTimeoutSettle(ctx, op, func(ctx context.Context, opErr error) error {
+		if !wasRunning {
+			return nil
+		}
+		state, _, err := conn.GetContainerState(opts.Name)
+		if err != nil {
+			return err
+		}
+		if state.StatusCode == api.Running {
+			return nil
+		}
+		op, err := conn.UpdateContainerState(opts.Name, api.ContainerStatePut{Action: "start", Timeout: -1}, "")
+		if err != nil {
+			return err
+		}
+		return helpers.OperationTimeout(ctx, op)
+	}))
+}
+
+func (lxd *lxdHost) parseSnapshotError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if strings.HasSuffix(err.Error(), "not found") {
+		return ErrSnapshotNotFound
+	}
+	if strings.Contains(err.Error(), "already exists") {
+		return ErrSnapshotExists
+	}
+	return err
+}
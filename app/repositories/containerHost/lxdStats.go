@@ -0,0 +1,185 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/hashicorp/go-multierror"
+)
+
+func (lxd *lxdHost) GetContainerHostStats(ctx context.Context, name string) (*HostStats, error) {
+	conn, err := lxd.remotes.forHost(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctr, _, err := conn.GetContainer(name)
+	if err != nil {
+		if strings.HasSuffix(err.Error(), "not found") {
+			return nil, ErrHostNotFound
+		}
+		return nil, fmt.Errorf("error getting container host: %w", err)
+	}
+
+	state, _, err := conn.GetContainerState(name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting container host state: %w", err)
+	}
+
+	stats := &HostStats{
+		Namespace:   ctr.Config[namespaceConfigKey],
+		Project:     ctr.Config[projectConfigKey],
+		Status:      state.Status,
+		CPUSeconds:  float64(state.CPU.Usage) / 1e9,
+		MemoryBytes: state.Memory.Usage,
+		SwapBytes:   state.Memory.SwapUsage,
+		Processes:   state.Processes,
+		DiskBytes:   make(map[string]int64, len(state.Disk)),
+		Network:     make(map[string]NetworkCounters, len(state.Network)),
+	}
+
+	for device, disk := range state.Disk {
+		stats.DiskBytes[device] = disk.Usage
+	}
+
+	for iface, network := range state.Network {
+		if network.Type == "loopback" {
+			continue
+		}
+		stats.Network[iface] = NetworkCounters{
+			RxBytes:   network.Counters.BytesReceived,
+			TxBytes:   network.Counters.BytesSent,
+			RxPackets: network.Counters.PacketsReceived,
+			TxPackets: network.Counters.PacketsSent,
+		}
+	}
+
+	return stats, nil
+}
+
+// GetContainerStats returns the resource usage of a project's containers. Docker samples CPU
+// usage over a second, so the containers are sampled at the same time
+func (lxd *lxdHost) GetContainerStats(ctx context.Context, name string) ([]ContainerStats, error) {
+	client, err := lxd.docker.get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctrs, err := lxd.ListContainers(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		errs  *multierror.Error
+		stats = make([]*ContainerStats, len(ctrs))
+	)
+	for i, ctr := range ctrs {
+		wg.Add(1)
+		go func(i int, ctr Container) {
+			defer wg.Done()
+
+			stat, err := containerStats(ctx, client, ctr)
+			// removed since it was listed
+			if _, ok := err.(*docker.NoSuchContainer); ok {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("error getting stats of container %s: %w", ctr.Name, err))
+				return
+			}
+			stats[i] = stat
+		}(i, ctr)
+	}
+	wg.Wait()
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	list := make([]ContainerStats, 0, len(stats))
+	for _, stat := range stats {
+		if stat != nil {
+			list = append(list, *stat)
+		}
+	}
+	return list, nil
+}
+
+func containerStats(ctx context.Context, client *docker.Client, ctr Container) (*ContainerStats, error) {
+	samples := make(chan *docker.Stats)
+	errC := make(chan error, 1)
+	go func() {
+		errC <- client.Stats(docker.StatsOptions{
+			ID:      ctr.ID,
+			Stats:   samples,
+			Stream:  false,
+			Context: ctx,
+		})
+	}()
+
+	var sample *docker.Stats
+	for s := range samples {
+		sample = s
+	}
+	if err := <-errC; err != nil {
+		return nil, err
+	}
+
+	stats := &ContainerStats{
+		Name: ctr.Name,
+		ID:   ctr.ID,
+	}
+	if sample == nil {
+		return stats, nil
+	}
+
+	cpu, preCPU := sample.CPUStats, sample.PreCPUStats
+	stats.CPUSeconds = float64(cpu.CPUUsage.TotalUsage) / 1e9
+	if cpu.SystemCPUUsage > preCPU.SystemCPUUsage && cpu.CPUUsage.TotalUsage >= preCPU.CPUUsage.TotalUsage {
+		cpus := cpu.OnlineCPUs
+		if cpus == 0 {
+			cpus = uint64(len(cpu.CPUUsage.PercpuUsage))
+		}
+		ctrDelta := float64(cpu.CPUUsage.TotalUsage - preCPU.CPUUsage.TotalUsage)
+		systemDelta := float64(cpu.SystemCPUUsage - preCPU.SystemCPUUsage)
+		stats.CPUPercent = ctrDelta / systemDelta * float64(cpus) * 100
+	}
+
+	// the page cache is reclaimable, so isn't counted as used as in `docker stats`
+	memory := sample.MemoryStats
+	usage := memory.Usage
+	if memory.Stats.Cache < usage {
+		usage -= memory.Stats.Cache
+	}
+	stats.MemoryBytes = int64(usage)
+	stats.MemoryLimitBytes = int64(memory.Limit)
+
+	for _, entry := range sample.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockReadBytes += int64(entry.Value)
+		case "write":
+			stats.BlockWriteBytes += int64(entry.Value)
+		}
+	}
+
+	stats.PIDs = int64(sample.PidsStats.Current)
+
+	for _, network := range sample.Networks {
+		stats.Network.RxBytes += int64(network.RxBytes)
+		stats.Network.TxBytes += int64(network.TxBytes)
+		stats.Network.RxPackets += int64(network.RxPackets)
+		stats.Network.TxPackets += int64(network.TxPackets)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,305 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	lxdclient "github.com/lxc/lxd/client"
+	"github.com/lxc/lxd/shared/api"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/volume"
+)
+
+const (
+	// directory in container hosts that LXD volumes are attached under
+	volumeMountDir = "/var/lib/windlass/volumes"
+	// prefix of the container host devices LXD volumes are attached with
+	volumeDevicePrefix = "windlass-volume-"
+)
+
+// lxdVolumeName is the name of the custom storage volume backing a project's volume. Host
+// names cant contain underscores, so the host is everything up to the first one
+func lxdVolumeName(name, vol string) string {
+	return name + "_" + vol
+}
+
+// volumePath is where a project's LXD volume is attached in its container host
+func volumePath(vol string) string {
+	return path.Join(volumeMountDir, vol)
+}
+
+// hasLXDVolumes reports whether any LXD volumes are attached to a container host. They live in the
+// storage pool rather than in the host, so they dont move with it
+func hasLXDVolumes(devices map[string]map[string]string) bool {
+	for device := range devices {
+		if strings.HasPrefix(device, volumeDevicePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// memberConn returns a connection to the LXD server a container host is on. Custom volumes
+// are local to a cluster member, so on a cluster this targets the host's member
+func (lxd *lxdHost) memberConn(name string) (lxdclient.ContainerServer, error) {
+	conn, err := lxd.remotes.forHost(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !conn.IsClustered() {
+		return conn, nil
+	}
+
+	ctr, _, err := conn.GetContainer(name)
+	if err != nil {
+		return nil, err
+	}
+	return conn.UseTarget(ctr.Location), nil
+}
+
+// EnsureVolume creates a project's volume if it doesnt exist yet. LXD volumes are attached to the
+// container host and have their quota updated to the volume's size
+func (lxd *lxdHost) EnsureVolume(ctx context.Context, opts VolumeOptions) error {
+	if opts.Volume.BackendOrDefault() == volume.BackendDocker {
+		return lxd.ensureDockerVolume(ctx, opts)
+	}
+
+	conn, err := lxd.memberConn(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	pool := viper.GetString("lxd.volumes.pool")
+	lxdName := lxdVolumeName(opts.Name, opts.Volume.Name)
+
+	existing, etag, err := conn.GetStoragePoolVolume(pool, "custom", lxdName)
+	switch {
+	case err != nil && strings.HasSuffix(err.Error(), "not found"):
+		config := map[string]string{}
+		if opts.Volume.Size != "" {
+			config["size"] = opts.Volume.Size
+		}
+
+		if err := conn.CreateStoragePoolVolume(pool, api.StorageVolumesPost{
+			Name: lxdName,
+			Type: "custom",
+			StorageVolumePut: api.StorageVolumePut{
+				Config:      config,
+				Description: "windlass volume " + opts.Volume.Name + " of " + opts.Name,
+			},
+		}); err != nil {
+			return fmt.Errorf("error creating volume: %w", err)
+		}
+	case err != nil:
+		return err
+	case existing.Config["size"] != opts.Volume.Size:
+		put := existing.Writable()
+		if opts.Volume.Size == "" {
+			delete(put.Config, "size")
+		} else {
+			put.Config["size"] = opts.Volume.Size
+		}
+
+		if err := conn.UpdateStoragePoolVolume(pool, "custom", lxdName, put, etag); err != nil {
+			return fmt.Errorf("error resizing volume: %w", err)
+		}
+	}
+
+	return lxd.attachVolume(ctx, conn, opts.Name, opts.Volume.Name)
+}
+
+func (lxd *lxdHost) attachVolume(ctx context.Context, conn lxdclient.ContainerServer, name, vol string) error {
+	ctr, etag, err := conn.GetContainer(name)
+	if err != nil {
+		return err
+	}
+
+	device := volumeDevicePrefix + vol
+	if _, ok := ctr.Devices[device]; ok {
+		return nil
+	}
+
+	put := ctr.Writable()
+	put.Devices[device] = map[string]string{
+		"type":   "disk",
+		"pool":   viper.GetString("lxd.volumes.pool"),
+		"source": lxdVolumeName(name, vol),
+		"path":   volumePath(vol),
+	}
+
+	op, err := conn.UpdateContainer(name, put, etag)
+	if err != nil {
+		return fmt.Errorf("error attaching volume: %w", err)
+	}
+	return helpers.OperationTimeout(ctx, op)
+}
+
+func (lxd *lxdHost) ensureDockerVolume(ctx context.Context, opts VolumeOptions) error {
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	// creating a volume that already exists is a no-op
+	if _, err := client.CreateVolume(docker.CreateVolumeOptions{
+		Name:    opts.Volume.Name,
+		Labels:  map[string]string{projectLabel: opts.Name},
+		Context: ctx,
+	}); err != nil {
+		return fmt.Errorf("error creating volume: %w", err)
+	}
+	return nil
+}
+
+// ListVolumes returns a project's LXD and Docker volumes
+func (lxd *lxdHost) ListVolumes(ctx context.Context, name string) ([]volume.Volume, error) {
+	conn, err := lxd.memberConn(name)
+	if err != nil {
+		return nil, err
+	}
+
+	lxdVolumes, err := conn.GetStoragePoolVolumes(viper.GetString("lxd.volumes.pool"))
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := make([]volume.Volume, 0)
+	for _, vol := range lxdVolumes {
+		if vol.Type != "custom" || !strings.HasPrefix(vol.Name, name+"_") {
+			continue
+		}
+		volumes = append(volumes, volume.Volume{
+			Name:    strings.TrimPrefix(vol.Name, name+"_"),
+			Backend: volume.BackendLXD,
+			Size:    vol.Config["size"],
+		})
+	}
+
+	client, err := lxd.docker.get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	dockerVolumes, err := client.ListVolumes(docker.ListVolumesOptions{
+		Filters: map[string][]string{"label": {projectLabel + "=" + name}},
+		Context: ctx,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing volumes: %w", err)
+	}
+
+	for _, vol := range dockerVolumes {
+		volumes = append(volumes, volume.Volume{
+			Name:    vol.Name,
+			Backend: volume.BackendDocker,
+		})
+	}
+
+	return volumes, nil
+}
+
+// DeleteVolume deletes a project's volume, unless a container still mounts it
+func (lxd *lxdHost) DeleteVolume(ctx context.Context, opts VolumeDeleteOptions) error {
+	volumes, err := lxd.ListVolumes(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	var vol *volume.Volume
+	for i := range volumes {
+		if volumes[i].Name == opts.Volume {
+			vol = &volumes[i]
+			break
+		}
+	}
+	if vol == nil {
+		return ErrVolumeNotFound
+	}
+
+	client, err := lxd.docker.get(ctx, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	ctrs, err := client.ListContainers(docker.ListContainersOptions{All: true, Context: ctx})
+	if err != nil {
+		return fmt.Errorf("error listing containers: %w", err)
+	}
+
+	for _, ctr := range ctrs {
+		for _, mount := range ctr.Mounts {
+			if (vol.Backend == volume.BackendDocker && mount.Name == vol.Name) ||
+				(vol.Backend == volume.BackendLXD && mount.Source == volumePath(vol.Name)) {
+				return ErrVolumeInUse
+			}
+		}
+	}
+
+	if vol.Backend == volume.BackendDocker {
+		if err := client.RemoveVolumeWithOptions(docker.RemoveVolumeOptions{Context: ctx, Name: vol.Name}); err != nil {
+			return fmt.Errorf("error deleting volume: %w", err)
+		}
+		return nil
+	}
+
+	conn, err := lxd.memberConn(opts.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := lxd.detachVolume(ctx, conn, opts.Name, vol.Name); err != nil {
+		return err
+	}
+
+	if err := conn.DeleteStoragePoolVolume(viper.GetString("lxd.volumes.pool"), "custom", lxdVolumeName(opts.Name, vol.Name)); err != nil {
+		return fmt.Errorf("error deleting volume: %w", err)
+	}
+	return nil
+}
+
+// deleteHostVolumes deletes the LXD custom volumes of a deleted container host
+func (lxd *lxdHost) deleteHostVolumes(conn lxdclient.ContainerServer, name string) error {
+	pool := viper.GetString("lxd.volumes.pool")
+
+	lxdVolumes, err := conn.GetStoragePoolVolumes(pool)
+	if err != nil {
+		return err
+	}
+
+	for _, vol := range lxdVolumes {
+		if vol.Type != "custom" || !strings.HasPrefix(vol.Name, name+"_") {
+			continue
+		}
+		if err := conn.DeleteStoragePoolVolume(pool, "custom", vol.Name); err != nil {
+			return fmt.Errorf("error deleting volume %s: %w", vol.Name, err)
+		}
+	}
+	return nil
+}
+
+func (lxd *lxdHost) detachVolume(ctx context.Context, conn lxdclient.ContainerServer, name, vol string) error {
+	ctr, etag, err := conn.GetContainer(name)
+	if err != nil {
+		return err
+	}
+
+	device := volumeDevicePrefix + vol
+	if _, ok := ctr.Devices[device]; !ok {
+		return nil
+	}
+
+	put := ctr.Writable()
+	delete(put.Devices, device)
+
+	op, err := conn.UpdateContainer(name, put, etag)
+	if err != nil {
+		return fmt.Errorf("error detaching volume: %w", err)
+	}
+	return helpers.OperationTimeout(ctx, op)
+}
@@ -1,8 +1,6 @@
 package providers
 
 import (
-	"context"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,7 +9,9 @@ import (
 	"sync"
 	"time"
 
-	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/ingress"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/snapshot"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/webhook"
 
 	"github.com/Strum355/log"
 
@@ -20,6 +20,11 @@ import (
 	consul "github.com/hashicorp/consul/api"
 )
 
+var ErrWorkerNotFound = errors.New("worker not registered with Consul")
+
+// each worker keeps its project metadata under kvPathPrefix followed by its hostname
+const kvPathPrefix = "windlass_worker@"
+
 type ConsulProvider struct {
 	client           *consul.Client
 	ttl              time.Duration
@@ -31,9 +36,11 @@ type ConsulProvider struct {
 type projectCheck struct {
 	check  func(ip string) (string, bool)
 	ticker *time.Ticker
+	stop   chan struct{}
 }
 
-type projectMeta struct {
+// ProjectMeta is stored in Consul KV for each project under the worker's KV path
+type ProjectMeta struct {
 	ID string `json:"id"`
 	IP string `json:"ip_address"`
 }
@@ -70,17 +77,13 @@ func (p *ConsulProvider) port() int {
 	return viper.GetInt("http.port")
 }
 
-// Register registers the worker and its associated projects with Consul.
-// See registerWorker() and registerProjects() for specific details
+// Register registers the worker with Consul. See registerWorker() for specific details.
+// Its projects are registered by the container host service, which can reach their hosts
 func (p *ConsulProvider) Register() error {
 	if err := p.registerWorker(); err != nil {
 		return fmt.Errorf("failed to register worker: %v", err)
 	}
 
-	if err := p.registerProjects(); err != nil {
-		return fmt.Errorf("failed to register one or more associated projects: %v", err)
-	}
-
 	p.udpateWorkerTTL()
 
 	return nil
@@ -104,65 +107,9 @@ func (p *ConsulProvider) registerWorker() error {
 	return p.client.Agent().ServiceRegister(service)
 }
 
-// Registers the projects associated with this worker with Consul using a TTL based health check
-// It pings the Docker Daemon on each project, see https://docs.docker.com/engine/api/v1.37/#operation/SystemPing for details
-func (p *ConsulProvider) registerProjects() error {
-	pairs, _, err := p.client.KV().List(p.kvPath(), &consul.QueryOptions{})
-	if err != nil {
-		return errors.New(fmt.Sprintf("failed to load KV at path %s", p.kvPath()))
-	}
-
-	for _, pair := range pairs {
-		var meta projectMeta
-		err := json.Unmarshal(pair.Value, &meta)
-		if err != nil {
-			return err
-		}
-
-		containerHost := host.NewContainerHostRepository()
-
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
-
-		projectName := p.projectNameFromKVPath(pair.Key)
-		ip, err := containerHost.GetContainerHostIP(ctx, projectName)
-		if err != nil {
-			return errors.New(fmt.Sprintf("failed to get container IP for host %s: %v", projectName, err))
-		}
-
-		vault, err := NewVaultProvider()
-		if err != nil {
-			return err
-		}
-
-		tls, err := vault.Get(viper.GetString("vault.path") + meta.ID)
-		if err != nil {
-			return err
-		}
-
-		clientKey, _ := base64.StdEncoding.DecodeString(tls["client_key"].(string))
-		clientCert, _ := base64.StdEncoding.DecodeString(tls["client_cert"].(string))
-		clientCA, _ := base64.StdEncoding.DecodeString(tls["client_ca"].(string))
-
-		containerHost.UseCerts([]byte(clientKey), []byte(clientCert), []byte(clientCA))
-
-		p.RegisterProject(p.projectNameFromKVPath(pair.Key), ip, func(ip string) (string, bool) {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-			defer cancel()
-			err := containerHost.Ping(ctx)
-			if err != nil {
-				return err.Error(), false
-			}
-			return "Remote Docker daemon reachable", true
-		})
-	}
-
-	return nil
-}
-
 // RegisterProject registers a single project
 func (p *ConsulProvider) RegisterProject(projectName string, ip string, check func(ip string) (string, bool)) error {
-	projectM := projectMeta{ID: projectName, IP: ip}
+	projectM := ProjectMeta{ID: projectName, IP: ip}
 
 	projectService := &consul.AgentServiceRegistration{
 		ID:      projectName,
@@ -213,12 +160,26 @@ func (p *ConsulProvider) udpateWorkerTTL() {
 // runs `check` on each tick which returns a string for health message and a bool true if healthy and false if not
 func (p *ConsulProvider) updateProjectTTL(id, ip string, check func(ip string) (string, bool)) {
 	ticker := time.NewTicker((p.ttl * 5) / 2)
+	stop := make(chan struct{})
+
+	p.mu.Lock()
+	if existing, ok := p.projectIDtoCheck[id]; ok {
+		existing.ticker.Stop()
+		close(existing.stop)
+	}
 	p.projectIDtoCheck[id] = projectCheck{
-		check: check, ticker: ticker,
+		check: check, ticker: ticker, stop: stop,
 	}
+	p.mu.Unlock()
 
 	go func() {
-		for range ticker.C {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+
 			health := consul.HealthPassing
 			msg, healthy := check(ip)
 			logFields := log.WithFields(log.Fields{
@@ -273,13 +234,14 @@ func (p *ConsulProvider) GetAndSetSharedSecret() error {
 	return err
 }
 
-func (p *ConsulProvider) SaveProjectMeta(projectMetadata projectMeta) error {
+func (p *ConsulProvider) SaveProjectMeta(projectMetadata ProjectMeta) error {
 	b, err := json.Marshal(projectMetadata)
 	if err != nil {
 		return err
 	}
 
 	p.mu.Lock()
+	defer p.mu.Unlock()
 	_, err = p.client.KV().Put(&consul.KVPair{
 		Key:   fmt.Sprintf("%s/%s", p.kvPath(), projectMetadata.ID),
 		Value: b,
@@ -287,8 +249,395 @@ func (p *ConsulProvider) SaveProjectMeta(projectMetadata projectMeta) error {
 	return err
 }
 
+// Snapshot policies are keyed by project rather than by worker so they follow a project
+// if it moves to another worker
+func (p *ConsulProvider) snapshotPolicyPath() string {
+	return viper.GetString("consul.path") + "/snapshot_policies"
+}
+
+func (p *ConsulProvider) SaveSnapshotPolicy(projectID string, policy snapshot.Policy) error {
+	b, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.KV().Put(&consul.KVPair{
+		Key:   fmt.Sprintf("%s/%s", p.snapshotPolicyPath(), projectID),
+		Value: b,
+	}, &consul.WriteOptions{})
+	return err
+}
+
+// GetSnapshotPolicy returns the snapshot policy for a project, or nil if it has none
+func (p *ConsulProvider) GetSnapshotPolicy(projectID string) (*snapshot.Policy, error) {
+	pair, _, err := p.client.KV().Get(fmt.Sprintf("%s/%s", p.snapshotPolicyPath(), projectID), &consul.QueryOptions{})
+	if err != nil || pair == nil {
+		return nil, err
+	}
+
+	var policy snapshot.Policy
+	if err := json.Unmarshal(pair.Value, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// GetSnapshotPolicies returns the snapshot policies of every project, keyed by project ID
+func (p *ConsulProvider) GetSnapshotPolicies() (map[string]snapshot.Policy, error) {
+	pairs, _, err := p.client.KV().List(p.snapshotPolicyPath(), &consul.QueryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KV at path %s: %v", p.snapshotPolicyPath(), err)
+	}
+
+	policies := make(map[string]snapshot.Policy, len(pairs))
+	for _, pair := range pairs {
+		var policy snapshot.Policy
+		if err := json.Unmarshal(pair.Value, &policy); err != nil {
+			return nil, err
+		}
+		policies[strings.TrimPrefix(pair.Key, p.snapshotPolicyPath()+"/")] = policy
+	}
+	return policies, nil
+}
+
+func (p *ConsulProvider) DeleteSnapshotPolicy(projectID string) error {
+	_, err := p.client.KV().Delete(fmt.Sprintf("%s/%s", p.snapshotPolicyPath(), projectID), &consul.WriteOptions{})
+	return err
+}
+
+// Ingress rules are keyed by project like snapshot policies
+func (p *ConsulProvider) ingressPath() string {
+	return viper.GetString("consul.path") + "/ingress"
+}
+
+func (p *ConsulProvider) SaveIngressRules(projectID string, rules ingress.Rules) error {
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.KV().Put(&consul.KVPair{
+		Key:   fmt.Sprintf("%s/%s", p.ingressPath(), projectID),
+		Value: b,
+	}, &consul.WriteOptions{})
+	return err
+}
+
+// GetIngressRules returns the ingress rules of a project, or nil if it has none
+func (p *ConsulProvider) GetIngressRules(projectID string) (ingress.Rules, error) {
+	pair, _, err := p.client.KV().Get(fmt.Sprintf("%s/%s", p.ingressPath(), projectID), &consul.QueryOptions{})
+	if err != nil || pair == nil {
+		return nil, err
+	}
+
+	var rules ingress.Rules
+	if err := json.Unmarshal(pair.Value, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (p *ConsulProvider) DeleteIngressRules(projectID string) error {
+	_, err := p.client.KV().Delete(fmt.Sprintf("%s/%s", p.ingressPath(), projectID), &consul.WriteOptions{})
+	return err
+}
+
+// GetAllIngressRules returns the ingress rules of every project on every worker, by project ID
+func (p *ConsulProvider) GetAllIngressRules() (map[string]ingress.Rules, error) {
+	pairs, _, err := p.client.KV().List(p.ingressPath()+"/", &consul.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	all := make(map[string]ingress.Rules, len(pairs))
+	for _, pair := range pairs {
+		var rules ingress.Rules
+		if err := json.Unmarshal(pair.Value, &rules); err != nil {
+			return nil, err
+		}
+		all[strings.TrimPrefix(pair.Key, p.ingressPath()+"/")] = rules
+	}
+	return all, nil
+}
+
+// Ingress hostnames are claimed by the project that first sets a rule for them, keyed by hostname
+// with the project ID as the value
+func (p *ConsulProvider) hostnamePath() string {
+	return viper.GetString("consul.path") + "/ingress_hostnames"
+}
+
+// GetHostnameOwner returns the ID of the project that claimed an ingress hostname, or an empty
+// string if it is unclaimed
+func (p *ConsulProvider) GetHostnameOwner(hostname string) (string, error) {
+	pair, _, err := p.client.KV().Get(fmt.Sprintf("%s/%s", p.hostnamePath(), hostname), &consul.QueryOptions{})
+	if err != nil || pair == nil {
+		return "", err
+	}
+	return string(pair.Value), nil
+}
+
+// ClaimHostname claims an ingress hostname for a project unless another project already has,
+// returning the ID of the project that owns it afterwards
+func (p *ConsulProvider) ClaimHostname(hostname, projectID string) (string, error) {
+	for {
+		owner, err := p.GetHostnameOwner(hostname)
+		if err != nil || owner != "" {
+			return owner, err
+		}
+
+		// a ModifyIndex of 0 only writes the key if it doesnt exist yet
+		ok, _, err := p.client.KV().CAS(&consul.KVPair{
+			Key:   fmt.Sprintf("%s/%s", p.hostnamePath(), hostname),
+			Value: []byte(projectID),
+		}, &consul.WriteOptions{})
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return projectID, nil
+		}
+	}
+}
+
+// ReleaseHostname gives up a project's claim on an ingress hostname, leaving claims held by other
+// projects alone
+func (p *ConsulProvider) ReleaseHostname(hostname, projectID string) error {
+	pair, _, err := p.client.KV().Get(fmt.Sprintf("%s/%s", p.hostnamePath(), hostname), &consul.QueryOptions{})
+	if err != nil || pair == nil || string(pair.Value) != projectID {
+		return err
+	}
+
+	_, _, err = p.client.KV().DeleteCAS(pair, &consul.WriteOptions{})
+	return err
+}
+
+// Webhooks are shared by every worker, each sending the events of its own projects
+func (p *ConsulProvider) webhookPath() string {
+	return viper.GetString("consul.path") + "/webhooks"
+}
+
+// deliveries are kept per webhook so that they're deleted with it
+func (p *ConsulProvider) webhookDeliveryPath(webhookID string) string {
+	return viper.GetString("consul.path") + "/webhook_deliveries/" + webhookID
+}
+
+func (p *ConsulProvider) SaveWebhook(hook webhook.Webhook) error {
+	b, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.KV().Put(&consul.KVPair{
+		Key:   fmt.Sprintf("%s/%s", p.webhookPath(), hook.ID),
+		Value: b,
+	}, &consul.WriteOptions{})
+	return err
+}
+
+// GetWebhook returns a webhook, or nil if there is none with that ID
+func (p *ConsulProvider) GetWebhook(id string) (*webhook.Webhook, error) {
+	pair, _, err := p.client.KV().Get(fmt.Sprintf("%s/%s", p.webhookPath(), id), &consul.QueryOptions{})
+	if err != nil || pair == nil {
+		return nil, err
+	}
+
+	var hook webhook.Webhook
+	if err := json.Unmarshal(pair.Value, &hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (p *ConsulProvider) GetWebhooks() ([]webhook.Webhook, error) {
+	pairs, _, err := p.client.KV().List(p.webhookPath()+"/", &consul.QueryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KV at path %s: %v", p.webhookPath(), err)
+	}
+
+	hooks := make([]webhook.Webhook, 0, len(pairs))
+	for _, pair := range pairs {
+		var hook webhook.Webhook
+		if err := json.Unmarshal(pair.Value, &hook); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook deletes a webhook and its delivery history
+func (p *ConsulProvider) DeleteWebhook(id string) error {
+	if _, err := p.client.KV().Delete(fmt.Sprintf("%s/%s", p.webhookPath(), id), &consul.WriteOptions{}); err != nil {
+		return err
+	}
+	_, err := p.client.KV().DeleteTree(p.webhookDeliveryPath(id)+"/", &consul.WriteOptions{})
+	return err
+}
+
+func (p *ConsulProvider) SaveDelivery(delivery webhook.Delivery) error {
+	b, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.KV().Put(&consul.KVPair{
+		Key:   fmt.Sprintf("%s/%s", p.webhookDeliveryPath(delivery.Webhook), delivery.ID),
+		Value: b,
+	}, &consul.WriteOptions{})
+	return err
+}
+
+// GetDeliveries returns the deliveries of a webhook, oldest first as delivery IDs sort by time
+func (p *ConsulProvider) GetDeliveries(webhookID string) ([]webhook.Delivery, error) {
+	pairs, _, err := p.client.KV().List(p.webhookDeliveryPath(webhookID)+"/", &consul.QueryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KV at path %s: %v", p.webhookDeliveryPath(webhookID), err)
+	}
+
+	deliveries := make([]webhook.Delivery, 0, len(pairs))
+	for _, pair := range pairs {
+		var delivery webhook.Delivery
+		if err := json.Unmarshal(pair.Value, &delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+func (p *ConsulProvider) DeleteDelivery(webhookID, id string) error {
+	_, err := p.client.KV().Delete(fmt.Sprintf("%s/%s", p.webhookDeliveryPath(webhookID), id), &consul.WriteOptions{})
+	return err
+}
+
+// GetProjectMeta returns the metadata of a project on this worker, or nil if it isnt registered
+func (p *ConsulProvider) GetProjectMeta(projectID string) (*ProjectMeta, error) {
+	pair, _, err := p.client.KV().Get(fmt.Sprintf("%s/%s", p.kvPath(), projectID), &consul.QueryOptions{})
+	if err != nil || pair == nil {
+		return nil, err
+	}
+
+	var meta ProjectMeta
+	if err := json.Unmarshal(pair.Value, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// DeregisterProject stops the health check of a project and removes it and its metadata from
+// this worker, such as when the project has moved to another worker
+func (p *ConsulProvider) DeregisterProject(projectID string) error {
+	p.mu.Lock()
+	if check, ok := p.projectIDtoCheck[projectID]; ok {
+		check.ticker.Stop()
+		close(check.stop)
+		delete(p.projectIDtoCheck, projectID)
+	}
+	p.mu.Unlock()
+
+	// workers may share a Consul agent, in which case the service could already belong to the
+	// worker the project moved to
+	services, err := p.client.Agent().Services()
+	if err != nil {
+		return err
+	}
+
+	if service, ok := services[projectID]; ok && p.ownsService(service) {
+		if err := p.client.Agent().ServiceDeregister(projectID); err != nil {
+			return err
+		}
+	}
+
+	_, err = p.client.KV().Delete(fmt.Sprintf("%s/%s", p.kvPath(), projectID), &consul.WriteOptions{})
+	return err
+}
+
+func (p *ConsulProvider) ownsService(service *consul.AgentService) bool {
+	for _, tag := range service.Tags {
+		if tag == fmt.Sprintf("Worker:%s", p.kvPath()) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWorkerAddress returns the base URL of the worker registered with the given hostname
+func (p *ConsulProvider) GetWorkerAddress(hostname string) (string, error) {
+	services, _, err := p.client.Catalog().Service("windlass_worker", "", &consul.QueryOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	prefix := fmt.Sprintf("windlass-worker@%s:", hostname)
+	for _, service := range services {
+		if !strings.HasPrefix(service.ServiceID, prefix) {
+			continue
+		}
+
+		address := service.ServiceAddress
+		if address == "" {
+			address = service.Address
+		}
+		return fmt.Sprintf("http://%s:%d", address, service.ServicePort), nil
+	}
+	return "", ErrWorkerNotFound
+}
+
+// GetProjectMetas returns the metadata of every project on this worker
+func (p *ConsulProvider) GetProjectMetas() ([]ProjectMeta, error) {
+	// the trailing slash stops workers whose hostname starts with this one's from matching
+	pairs, _, err := p.client.KV().List(p.kvPath()+"/", &consul.QueryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KV at path %s: %v", p.kvPath(), err)
+	}
+
+	metas := make([]ProjectMeta, 0, len(pairs))
+	for _, pair := range pairs {
+		var meta ProjectMeta
+		if err := json.Unmarshal(pair.Value, &meta); err != nil {
+			return nil, err
+		}
+		metas = append(metas, meta)
+	}
+	return metas, nil
+}
+
+// GetProjectOwners returns the hostname of the worker each project is registered to, across all workers
+func (p *ConsulProvider) GetProjectOwners() (map[string]string, error) {
+	pairs, _, err := p.client.KV().List(kvPathPrefix, &consul.QueryOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KV at path %s: %v", kvPathPrefix, err)
+	}
+
+	owners := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(strings.TrimPrefix(pair.Key, kvPathPrefix), "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			continue
+		}
+		owners[parts[1]] = parts[0]
+	}
+	return owners, nil
+}
+
+// GetProjectServices returns the IDs of the project services this worker has registered with its Consul agent
+func (p *ConsulProvider) GetProjectServices() ([]string, error) {
+	services, err := p.client.Agent().Services()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id, service := range services {
+		if service.Service == "windlass_worker_projects" && p.ownsService(service) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
 func (p *ConsulProvider) kvPath() string {
-	return fmt.Sprintf("windlass_worker@%s", viper.GetString("http.hostname"))
+	return kvPathPrefix + viper.GetString("http.hostname")
 }
 
 func (p *ConsulProvider) onFailedWorkerTTL(err error) error {
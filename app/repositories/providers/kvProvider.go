@@ -3,4 +3,6 @@ package providers
 type KVProvider interface {
 	Put(pathPrefix string, kv map[string]interface{}) error
 	Get(pathPrefix string) (map[string]interface{}, error)
+	Delete(pathPrefix string) error
+	List(pathPrefix string) ([]string, error)
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/spf13/viper"
 )
 
+var ErrNotFound = errors.New("nothing found in Vault at given prefix")
+
 type VaultProvider struct {
 	client *vault.Client
 }
@@ -39,8 +41,30 @@ func (p *VaultProvider) Get(pathPrefix string) (map[string]interface{}, error) {
 	}
 
 	if s == nil {
-		return nil, errors.New("nothing found in Vault at given prefix")
+		return nil, ErrNotFound
 	}
 
 	return s.Data, nil
 }
+
+func (p *VaultProvider) Delete(pathPrefix string) error {
+	_, err := p.client.Logical().Delete(pathPrefix)
+	return err
+}
+
+// List returns the keys directly under pathPrefix
+func (p *VaultProvider) List(pathPrefix string) ([]string, error) {
+	s, err := p.client.Logical().List(pathPrefix)
+	if err != nil || s == nil {
+		return nil, err
+	}
+
+	raw, _ := s.Data["keys"].([]interface{})
+	keys := make([]string, 0, len(raw))
+	for _, key := range raw {
+		if key, ok := key.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
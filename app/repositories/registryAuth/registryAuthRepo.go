@@ -0,0 +1,31 @@
+package registryauth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/registry"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
+	"github.com/spf13/viper"
+)
+
+// RegistryAuthRepo stores private registry credentials per namespace, keyed by registry host
+type RegistryAuthRepo interface {
+	PutCredential(ctx context.Context, namespace string, cred registry.Credential) error
+	// GetCredential returns the credential for a registry, or nil if the namespace has none
+	GetCredential(ctx context.Context, namespace, registryHost string) (*registry.Credential, error)
+	// ListRegistries returns the hosts of the registries a namespace has credentials for
+	ListRegistries(ctx context.Context, namespace string) ([]string, error)
+	DeleteCredential(ctx context.Context, namespace, registryHost string) error
+}
+
+func NewRegistryAuthRepo() RegistryAuthRepo {
+	if viper.GetBool("vault.enabled") {
+		vault, err := providers.NewVaultProvider()
+		if err != nil {
+			panic(fmt.Errorf("failed to create Vault client: %w", err))
+		}
+		return NewVaultRegistryAuthRepo(vault)
+	}
+	panic("vault currently required")
+}
@@ -0,0 +1,67 @@
+package registryauth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/registry"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
+)
+
+type vaultRegistryAuthRepo struct {
+	vault *providers.VaultProvider
+}
+
+func NewVaultRegistryAuthRepo(vault *providers.VaultProvider) RegistryAuthRepo {
+	return &vaultRegistryAuthRepo{
+		vault: vault,
+	}
+}
+
+func (v *vaultRegistryAuthRepo) path(namespace string) string {
+	return fmt.Sprintf("%s%s/", viper.GetString("vault.registryPath"), namespace)
+}
+
+func (v *vaultRegistryAuthRepo) PutCredential(ctx context.Context, namespace string, cred registry.Credential) error {
+	return v.vault.Put(v.path(namespace)+cred.Registry, map[string]interface{}{
+		"username": cred.Username, "password": cred.Password, "identity_token": cred.IdentityToken,
+	})
+}
+
+func (v *vaultRegistryAuthRepo) GetCredential(ctx context.Context, namespace, registryHost string) (*registry.Credential, error) {
+	data, err := v.vault.Get(v.path(namespace) + registryHost)
+	if err == providers.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed getting registry credential from Vault: %v", err)
+	}
+
+	cred := registry.Credential{Registry: registryHost}
+	cred.Username, _ = data["username"].(string)
+	cred.Password, _ = data["password"].(string)
+	cred.IdentityToken, _ = data["identity_token"].(string)
+	return &cred, nil
+}
+
+func (v *vaultRegistryAuthRepo) ListRegistries(ctx context.Context, namespace string) ([]string, error) {
+	keys, err := v.vault.List(v.path(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("failed listing registry credentials in Vault: %v", err)
+	}
+
+	registries := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !strings.HasSuffix(key, "/") {
+			registries = append(registries, key)
+		}
+	}
+	return registries, nil
+}
+
+func (v *vaultRegistryAuthRepo) DeleteCredential(ctx context.Context, namespace, registryHost string) error {
+	return v.vault.Delete(v.path(namespace) + registryHost)
+}
@@ -9,13 +9,31 @@ import (
 )
 
 type PEMContainer struct {
-	ServerKeyPEM, ServerCertPEM, ClientKeyPEM, ClientCertPEM []byte
+	ServerCAPEM, ClientCAPEM, ServerKeyPEM, ServerCertPEM, ClientKeyPEM, ClientCertPEM []byte
+}
+
+// Certificate is a PEM encoded certificate chain and its private key
+type Certificate struct {
+	CertPEM, KeyPEM []byte
 }
 
 type TLSStorageRepo interface {
 	PushAuthCerts(ctx context.Context, key string, serverCAPEM, clientCAPEM, serverKeyPEM, serverCertPEM, clientKeyPEM, clientCertPEM []byte) error
 	// GetAuthCerts returns the TLS certs and keys for a given key.
 	GetAuthCerts(ctx context.Context, key string) (PEMContainer, error)
+	DeleteAuthCerts(ctx context.Context, key string) error
+	// ListAuthCerts returns the keys that have TLS certs stored
+	ListAuthCerts(ctx context.Context) ([]string, error)
+
+	// PutCertificate stores the ACME certificate for one of a project's ingress hostnames
+	PutCertificate(ctx context.Context, project, hostname string, cert Certificate) error
+	// GetCertificate returns the ACME certificate for one of a project's ingress hostnames, or nil
+	// if it has none
+	GetCertificate(ctx context.Context, project, hostname string) (*Certificate, error)
+	DeleteCertificate(ctx context.Context, project, hostname string) error
+	PutACMEAccountKey(ctx context.Context, keyPEM []byte) error
+	// GetACMEAccountKey returns the ACME account key, or nil if no account has been registered
+	GetACMEAccountKey(ctx context.Context) ([]byte, error)
 }
 
 func NewTLSStorageRepo() TLSStorageRepo {
@@ -2,6 +2,8 @@ package tlsstorage
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
@@ -28,12 +30,100 @@ func (v *vaultTLSStorageRepo) PushAuthCerts(ctx context.Context, key string, ser
 func (v *vaultTLSStorageRepo) GetAuthCerts(ctx context.Context, key string) (PEMContainer, error) {
 	data, err := v.vault.Get(viper.GetString("vault.path") + key)
 	if err != nil {
-		return PEMContainer{}, fmt.Errorf("failed getting TLS data from Vault: %v", err)
+		return PEMContainer{}, fmt.Errorf("failed getting TLS data from Vault: %w", err)
 	}
-	return PEMContainer{
-		ServerCertPEM: data["server_cert"].([]byte),
-		ServerKeyPEM:  data["server_key"].([]byte),
-		ClientCertPEM: data["client_cert"].([]byte),
-		ClientKeyPEM:  data["client_key"].([]byte),
-	}, nil
+
+	var pems PEMContainer
+	fields := map[string]*[]byte{
+		"server_ca": &pems.ServerCAPEM, "client_ca": &pems.ClientCAPEM, "server_key": &pems.ServerKeyPEM,
+		"server_cert": &pems.ServerCertPEM, "client_key": &pems.ClientKeyPEM, "client_cert": &pems.ClientCertPEM,
+	}
+	for field, dest := range fields {
+		if *dest, err = decodeVaultBytes(data, field); err != nil {
+			return PEMContainer{}, fmt.Errorf("TLS data: %w", err)
+		}
+	}
+
+	return pems, nil
+}
+
+func (v *vaultTLSStorageRepo) DeleteAuthCerts(ctx context.Context, key string) error {
+	return v.vault.Delete(viper.GetString("vault.path") + key)
+}
+
+func (v *vaultTLSStorageRepo) ListAuthCerts(ctx context.Context) ([]string, error) {
+	keys, err := v.vault.List(viper.GetString("vault.path"))
+	if err != nil {
+		return nil, fmt.Errorf("failed listing TLS data in Vault: %w", err)
+	}
+	return keys, nil
+}
+
+// ACME state is kept apart from vault.path, where every key is expected to be a container host
+func acmePath(key string) string {
+	return viper.GetString("vault.acmePath") + key
+}
+
+// certificates are kept per project, so that a project only ever gets the keys of its own hostnames
+func certPath(project, hostname string) string {
+	return acmePath("certs/" + project + "/" + hostname)
+}
+
+func (v *vaultTLSStorageRepo) PutCertificate(ctx context.Context, project, hostname string, cert Certificate) error {
+	return v.vault.Put(certPath(project, hostname), map[string]interface{}{
+		"cert": cert.CertPEM, "key": cert.KeyPEM,
+	})
+}
+
+func (v *vaultTLSStorageRepo) GetCertificate(ctx context.Context, project, hostname string) (*Certificate, error) {
+	data, err := v.vault.Get(certPath(project, hostname))
+	if errors.Is(err, providers.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed getting certificate from Vault: %w", err)
+	}
+
+	var cert Certificate
+	if cert.CertPEM, err = decodeVaultBytes(data, "cert"); err != nil {
+		return nil, err
+	}
+	if cert.KeyPEM, err = decodeVaultBytes(data, "key"); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (v *vaultTLSStorageRepo) DeleteCertificate(ctx context.Context, project, hostname string) error {
+	return v.vault.Delete(certPath(project, hostname))
+}
+
+func (v *vaultTLSStorageRepo) PutACMEAccountKey(ctx context.Context, keyPEM []byte) error {
+	return v.vault.Put(acmePath("account"), map[string]interface{}{
+		"key": keyPEM,
+	})
+}
+
+func (v *vaultTLSStorageRepo) GetACMEAccountKey(ctx context.Context) ([]byte, error) {
+	data, err := v.vault.Get(acmePath("account"))
+	if errors.Is(err, providers.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed getting ACME account key from Vault: %w", err)
+	}
+	return decodeVaultBytes(data, "key")
+}
+
+// decodeVaultBytes returns a field written as []byte, which Vault stores as a base64 encoded string
+func decodeVaultBytes(data map[string]interface{}, field string) ([]byte, error) {
+	encoded, ok := data[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("data in Vault missing %s", field)
+	}
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("data in Vault has malformed %s: %w", field, err)
+	}
+	return b, nil
 }
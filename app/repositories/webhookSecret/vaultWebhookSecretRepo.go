@@ -0,0 +1,47 @@
+package webhooksecret
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
+)
+
+type vaultWebhookSecretRepo struct {
+	vault *providers.VaultProvider
+}
+
+func NewVaultWebhookSecretRepo(vault *providers.VaultProvider) WebhookSecretRepo {
+	return &vaultWebhookSecretRepo{
+		vault: vault,
+	}
+}
+
+func (v *vaultWebhookSecretRepo) path(id string) string {
+	return viper.GetString("vault.webhookPath") + id
+}
+
+func (v *vaultWebhookSecretRepo) PutSecret(ctx context.Context, id, secret string) error {
+	return v.vault.Put(v.path(id), map[string]interface{}{
+		"secret": secret,
+	})
+}
+
+func (v *vaultWebhookSecretRepo) GetSecret(ctx context.Context, id string) (string, error) {
+	data, err := v.vault.Get(v.path(id))
+	if err == providers.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed getting webhook secret from Vault: %v", err)
+	}
+
+	secret, _ := data["secret"].(string)
+	return secret, nil
+}
+
+func (v *vaultWebhookSecretRepo) DeleteSecret(ctx context.Context, id string) error {
+	return v.vault.Delete(v.path(id))
+}
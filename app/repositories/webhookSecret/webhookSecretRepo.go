@@ -0,0 +1,28 @@
+package webhooksecret
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
+	"github.com/spf13/viper"
+)
+
+// WebhookSecretRepo stores the secrets webhook payloads are signed with, keyed by webhook ID
+type WebhookSecretRepo interface {
+	PutSecret(ctx context.Context, id, secret string) error
+	// GetSecret returns a webhook's secret, or an empty string if it has none
+	GetSecret(ctx context.Context, id string) (string, error)
+	DeleteSecret(ctx context.Context, id string) error
+}
+
+func NewWebhookSecretRepo() WebhookSecretRepo {
+	if viper.GetBool("vault.enabled") {
+		vault, err := providers.NewVaultProvider()
+		if err != nil {
+			panic(fmt.Errorf("failed to create Vault client: %w", err))
+		}
+		return NewVaultWebhookSecretRepo(vault)
+	}
+	panic("vault currently required")
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/acme"
+
+	tlsstorage "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/tlsStorage"
+)
+
+var ErrNoHTTPChallenge = errors.New("ACME server offered no http-01 challenge")
+
+// ChallengeSolver answers ACME HTTP-01 challenges, serving keyAuth at
+// /.well-known/acme-challenge/<token> on the hostname being validated
+type ChallengeSolver interface {
+	Present(ctx context.Context, token, keyAuth string) error
+	CleanUp(ctx context.Context, token string) error
+}
+
+// ACMEService obtains certificates from the ACME server at `acme.directoryURL`. The account
+// key is generated and registered on first use, and kept in TLS storage
+type ACMEService struct {
+	hostService *ContainerHostService
+
+	mu     *sync.Mutex
+	client *acme.Client
+}
+
+func NewACMEService(hostService *ContainerHostService) *ACMEService {
+	return &ACMEService{
+		hostService: hostService,
+		mu:          new(sync.Mutex),
+	}
+}
+
+// Obtain orders a certificate for hostname, proving control of it with solver
+func (service *ACMEService) Obtain(ctx context.Context, hostname string, solver ChallengeSolver) (*tlsstorage.Certificate, error) {
+	client, err := service.account(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(hostname))
+	if err != nil {
+		return nil, fmt.Errorf("error creating ACME order: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := service.authorize(ctx, client, authzURL, solver); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("error waiting for ACME order: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{hostname}}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("error finalizing ACME order: %w", err)
+	}
+
+	var cert tlsstorage.Certificate
+	for _, der := range chain {
+		cert.CertPEM = append(cert.CertPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if cert.KeyPEM, err = encodeECKey(key); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func (service *ACMEService) authorize(ctx context.Context, client *acme.Client, authzURL string, solver ChallengeSolver) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("error getting ACME authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return ErrNoHTTPChallenge
+	}
+
+	keyAuth, err := client.HTTP01ChallengeResponse(chal.Token)
+	if err != nil {
+		return err
+	}
+	if err := solver.Present(ctx, chal.Token, keyAuth); err != nil {
+		return fmt.Errorf("error presenting ACME challenge: %w", err)
+	}
+	defer func() {
+		// validation may have timed out, so cleaning up gets its own deadline
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		if err := solver.CleanUp(ctx, chal.Token); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"hostname": authz.Identifier.Value,
+				"token":    chal.Token,
+			}).Warn("failed to clean up ACME challenge")
+		}
+	}()
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("error accepting ACME challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("error waiting for ACME authorization of %s: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// account returns a client for the ACME account, registering it if this is the first use
+func (service *ACMEService) account(ctx context.Context) (*acme.Client, error) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.client != nil {
+		return service.client, nil
+	}
+
+	httpClient, err := acmeHTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := service.hostService.tlsStorageRepo.GetACMEAccountKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var key *ecdsa.PrivateKey
+	if keyPEM != nil {
+		block, _ := pem.Decode(keyPEM)
+		if block == nil {
+			return nil, errors.New("malformed ACME account key")
+		}
+		if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("malformed ACME account key: %w", err)
+		}
+	} else {
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return nil, err
+		}
+		if keyPEM, err = encodeECKey(key); err != nil {
+			return nil, err
+		}
+		if err := service.hostService.tlsStorageRepo.PutACMEAccountKey(ctx, keyPEM); err != nil {
+			return nil, err
+		}
+	}
+
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: viper.GetString("acme.directoryURL"),
+		HTTPClient:   httpClient,
+	}
+
+	account := &acme.Account{}
+	if email := viper.GetString("acme.email"); email != "" {
+		account.Contact = []string{"mailto:" + email}
+	}
+	// registering an existing key is how the account is looked up again
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, fmt.Errorf("error registering ACME account: %w", err)
+	}
+
+	service.client = client
+	return client, nil
+}
+
+// acmeHTTPClient trusts the CAs in `acme.caFile` on top of the system roots, for ACME servers
+// such as Pebble that serve their directory with a private CA
+func acmeHTTPClient() (*http.Client, error) {
+	caFile := viper.GetString("acme.caFile")
+	if caFile == "" {
+		return http.DefaultClient, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading acme.caFile: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("acme.caFile contains no PEM certificates")
+	}
+
+	return &http.Client{
+		Timeout: time.Minute,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}, nil
+}
+
+func encodeECKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// CertificateExpiry returns when the leaf of a PEM encoded certificate chain expires
+func CertificateExpiry(certPEM []byte) (time.Time, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return time.Time{}, errors.New("malformed certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/audit"
+)
+
+// AuditService appends entries to the audit log at `audit.path`, one JSON object per line
+type AuditService struct {
+	mu   *sync.Mutex
+	file *os.File
+}
+
+func NewAuditService() *AuditService {
+	return &AuditService{
+		mu: new(sync.Mutex),
+	}
+}
+
+// Record appends entry to the audit log, opening it on first use
+func (service *AuditService) Record(entry audit.Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if service.file == nil {
+		file, err := os.OpenFile(viper.GetString("audit.path"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		service.file = file
+	}
+
+	_, err = service.file.Write(append(line, '\n'))
+	return err
+}
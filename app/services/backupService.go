@@ -0,0 +1,276 @@
+package services
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+	backupstorage "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/backupStorage"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
+	tlsstorage "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/tlsStorage"
+	"github.com/UCCNetworkingSociety/Windlass-worker/utils/encryption"
+)
+
+const (
+	archiveVersion = 1
+
+	// Entries of an export archive, in the order they are written. The host backup
+	// comes last so that it can be streamed straight into LXD on import
+	archiveManifest = "windlass.json"
+	archiveTLS      = "tls.json.enc"
+	archiveHost     = "host.tar.gz"
+)
+
+var (
+	ErrProjectNotRegistered = errors.New("project is not registered on this worker")
+	ErrInvalidArchive       = errors.New("invalid export archive")
+)
+
+// exportManifest describes the project an export archive was taken from
+type exportManifest struct {
+	Version    int                   `json:"version"`
+	Project    providers.ProjectMeta `json:"project"`
+	Worker     string                `json:"worker"`
+	ExportedAt time.Time             `json:"exportedAt"`
+}
+
+// ExportResult is returned after a project host has been exported
+type ExportResult struct {
+	Key string `json:"key"`
+}
+
+// BackupService exports project hosts to archives in backup storage and imports them
+// on any worker. An archive holds the LXD backup of the host, the project's metadata
+// and its TLS material, encrypted with `backup.encryptionKey`.
+type BackupService struct {
+	hostService *ContainerHostService
+	storage     backupstorage.BackupStorageRepo
+}
+
+func NewBackupService(hostService *ContainerHostService) *BackupService {
+	return &BackupService{
+		hostService: hostService,
+		storage:     backupstorage.NewBackupStorageRepo(),
+	}
+}
+
+func (service *BackupService) ListExports(ctx context.Context, name string) ([]string, error) {
+	prefix := ""
+	if name != "" {
+		prefix = name + "/"
+	}
+	return service.storage.List(ctx, prefix)
+}
+
+func (service *BackupService) Export(ctx context.Context, name string) (*ExportResult, error) {
+	meta, err := service.hostService.consul.GetProjectMeta(name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting project metadata: %w", err)
+	}
+	if meta == nil {
+		return nil, ErrProjectNotRegistered
+	}
+
+	pems, err := service.hostService.tlsStorageRepo.GetAuthCerts(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pemJSON, err := json.Marshal(pems)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedPEMs, err := encryption.Seal(viper.GetString("backup.encryptionKey"), pemJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting TLS material: %w", err)
+	}
+
+	manifest, err := json.Marshal(exportManifest{
+		Version:    archiveVersion,
+		Project:    *meta,
+		Worker:     viper.GetString("http.hostname"),
+		ExportedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hostBackup, err := ioutil.TempFile(viper.GetString("backup.tmpDir"), "windlass-host-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(hostBackup.Name())
+	defer hostBackup.Close()
+
+	log.WithFields(log.Fields{
+		"containerHost": name,
+	}).Info("exporting container host")
+
+	if err := service.hostService.repo.ExportContainerHost(ctx, name, hostBackup); err != nil {
+		return nil, err
+	}
+
+	archive, err := ioutil.TempFile(viper.GetString("backup.tmpDir"), "windlass-export-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if err := writeArchive(archive, manifest, sealedPEMs, hostBackup); err != nil {
+		return nil, fmt.Errorf("error writing export archive: %w", err)
+	}
+
+	size, err := archive.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/%s.tar", name, time.Now().UTC().Format("20060102-150405"))
+	if err := service.storage.Put(ctx, key, archive, size); err != nil {
+		return nil, fmt.Errorf("error storing export archive: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"containerHost": name,
+		"key":           key,
+	}).Info("exported container host")
+
+	return &ExportResult{Key: key}, nil
+}
+
+func writeArchive(w io.Writer, manifest, sealedPEMs []byte, hostBackup *os.File) error {
+	tw := tar.NewWriter(w)
+
+	for _, entry := range []struct {
+		name    string
+		content []byte
+	}{{archiveManifest, manifest}, {archiveTLS, sealedPEMs}} {
+		if err := tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0600, Size: int64(len(entry.content)), ModTime: time.Now()}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.content); err != nil {
+			return err
+		}
+	}
+
+	size, err := hostBackup.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := hostBackup.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{Name: archiveHost, Mode: 0600, Size: size, ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, hostBackup); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// Import restores a project host from an export archive, re-issuing its server cert if the
+// host came up with a different IP, and registers it with Consul under this worker.
+func (service *BackupService) Import(ctx context.Context, key string, placement project.Placement) (*providers.ProjectMeta, error) {
+	archive, err := service.storage.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("error getting export archive: %w", err)
+	}
+	defer archive.Close()
+
+	tr := tar.NewReader(archive)
+
+	var manifest exportManifest
+	if err := readArchiveEntry(tr, archiveManifest, func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(&manifest)
+	}); err != nil {
+		return nil, err
+	}
+
+	if manifest.Version != archiveVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, manifest.Version)
+	}
+
+	var pems tlsstorage.PEMContainer
+	if err := readArchiveEntry(tr, archiveTLS, func(r io.Reader) error {
+		sealed, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		pemJSON, err := encryption.Open(viper.GetString("backup.encryptionKey"), sealed)
+		if err != nil {
+			return fmt.Errorf("error decrypting TLS material: %w", err)
+		}
+		return json.Unmarshal(pemJSON, &pems)
+	}); err != nil {
+		return nil, err
+	}
+
+	name := manifest.Project.ID
+	exists, err := service.hostService.repo.HostExists(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, host.ErrHostExists
+	}
+
+	// the reconciler would otherwise adopt the host before it is imported
+	defer service.hostService.ops.begin(name)()
+
+	log.WithFields(log.Fields{
+		"containerHost": name,
+		"key":           key,
+		"exportedFrom":  manifest.Worker,
+	}).Info("importing container host")
+
+	if err := readArchiveEntry(tr, archiveHost, func(r io.Reader) error {
+		return service.hostService.repo.ImportContainerHost(ctx, host.ContainerHostImportOptions{
+			ContainerName: host.ContainerName{Name: name},
+			Remote:        placement.Remote,
+			Backup:        r,
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	ip, err := service.hostService.adoptHost(ctx, name, pems)
+	if err != nil {
+		return nil, err
+	}
+
+	return &providers.ProjectMeta{ID: name, IP: ip}, nil
+}
+
+// readArchiveEntry reads the next entry of an export archive, which must be named name
+func readArchiveEntry(tr *tar.Reader, name string, read func(io.Reader) error) error {
+	header, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("%w: error reading %s: %v", ErrInvalidArchive, name, err)
+	}
+
+	if header.Name != name {
+		return fmt.Errorf("%w: expected %s, found %s", ErrInvalidArchive, name, header.Name)
+	}
+
+	return read(tr)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/Strum355/log"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/audit"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+)
+
+// ConsoleSession is who opened a console into which container host
+type ConsoleSession struct {
+	Host   string
+	User   string
+	Remote string
+	Size   host.TerminalSize
+}
+
+// ConsoleService opens admin shells in container hosts, recording everything typed into and
+// written to them in the audit log
+type ConsoleService struct {
+	hostService *ContainerHostService
+	audit       *AuditService
+}
+
+func NewConsoleService(hostService *ContainerHostService, auditService *AuditService) *ConsoleService {
+	return &ConsoleService{
+		hostService: hostService,
+		audit:       auditService,
+	}
+}
+
+// CheckHost returns an error if a console cant be opened in the container host
+func (service *ConsoleService) CheckHost(ctx context.Context, name string) error {
+	running, err := service.hostService.repo.IsContainerHostRunning(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !running {
+		return host.ErrHostNotRunning
+	}
+	return nil
+}
+
+// Open runs a shell in the session's container host until it exits or ctx is done, returning its
+// exit code. A session that cant be recorded isnt opened, and is hung up if recording it fails
+// part way through
+func (service *ConsoleService) Open(ctx context.Context, session ConsoleSession, stdin io.ReadCloser, stdout io.WriteCloser, resize <-chan host.TerminalSize) (int, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return -1, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rec := &sessionRecorder{
+		audit: service.audit,
+		base: audit.Entry{
+			Session: id,
+			User:    session.User,
+			Remote:  session.Remote,
+			Host:    session.Host,
+		},
+		cancel: cancel,
+	}
+
+	if err := service.audit.Record(rec.entry(audit.Entry{
+		Type:   audit.SessionStarted,
+		Width:  session.Size.Width,
+		Height: session.Size.Height,
+	})); err != nil {
+		return -1, err
+	}
+
+	fields := log.Fields{
+		"containerHost": session.Host,
+		"session":       id,
+		"user":          session.User,
+	}
+	log.WithFields(fields).Info("console session started")
+
+	resized := make(chan host.TerminalSize)
+	go func() {
+		defer close(resized)
+		for size := range resize {
+			rec.record(audit.Entry{Type: audit.Resize, Width: size.Width, Height: size.Height})
+			select {
+			case resized <- size:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	code, err := service.hostService.repo.OpenConsole(ctx, host.ConsoleOptions{
+		ContainerName: host.ContainerName{Name: session.Host},
+		Size:          session.Size,
+		Stdin:         recordingReader{stdin, rec},
+		Stdout:        recordingWriter{stdout, rec},
+		Resize:        resized,
+	})
+
+	end := audit.Entry{Type: audit.SessionEnded}
+	if err != nil {
+		end.Error = err.Error()
+	} else {
+		end.ExitCode = &code
+	}
+	rec.record(end)
+
+	log.WithFields(log.Fields{
+		"containerHost": session.Host,
+		"session":       id,
+		"user":          session.User,
+		"exitCode":      code,
+	}).Info("console session ended")
+
+	return code, err
+}
+
+// sessionRecorder records the entries of a console session, hanging it up if the audit log
+// cant be written to
+type sessionRecorder struct {
+	audit  *AuditService
+	base   audit.Entry
+	cancel context.CancelFunc
+}
+
+func (rec *sessionRecorder) entry(entry audit.Entry) audit.Entry {
+	entry.Time = time.Now()
+	entry.Session = rec.base.Session
+	entry.User = rec.base.User
+	entry.Remote = rec.base.Remote
+	entry.Host = rec.base.Host
+	return entry
+}
+
+func (rec *sessionRecorder) record(entry audit.Entry) {
+	if err := rec.audit.Record(rec.entry(entry)); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"containerHost": rec.base.Host,
+			"session":       rec.base.Session,
+		}).Error("failed to write to audit log, hanging up console")
+		rec.cancel()
+	}
+}
+
+type recordingReader struct {
+	io.ReadCloser
+	rec *sessionRecorder
+}
+
+func (r recordingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.rec.record(audit.Entry{Type: audit.Input, Data: string(p[:n])})
+	}
+	return n, err
+}
+
+type recordingWriter struct {
+	io.WriteCloser
+	rec *sessionRecorder
+}
+
+func (w recordingWriter) Write(p []byte) (int, error) {
+	w.rec.record(audit.Entry{Type: audit.Output, Data: string(p)})
+	return w.WriteCloser.Write(p)
+}
@@ -2,16 +2,27 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Strum355/log"
 	"github.com/hashicorp/go-multierror"
+	"github.com/spf13/viper"
 
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/registry"
 
 	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
 
 	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	registryauth "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/registryAuth"
 	tlsstorage "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/tlsStorage"
 )
 
@@ -20,17 +31,67 @@ type ContainerHostService struct {
 	consul         *providers.ConsulProvider
 	tlsService     *TLSCertService
 	tlsStorageRepo tlsstorage.TLSStorageRepo
+	registryRepo   registryauth.RegistryAuthRepo
+
+	ops *hostOps
+}
+
+// hostOps tracks the container hosts with a create, import or migration in flight. Their metadata,
+// certs and services are still being put in place, so the reconciler leaves them alone
+type hostOps struct {
+	mu    *sync.Mutex
+	hosts map[string]int
+}
+
+// begin marks a host as busy until the returned func is called
+func (o *hostOps) begin(name string) func() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.hosts[name]++
+	return o.end(name)
+}
+
+// tryBegin is begin for a host that isn't already busy, returning false if it is
+func (o *hostOps) tryBegin(name string) (func(), bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.hosts[name] > 0 {
+		return nil, false
+	}
+	o.hosts[name]++
+	return o.end(name), true
+}
+
+func (o *hostOps) end(name string) func() {
+	return func() {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		if o.hosts[name]--; o.hosts[name] <= 0 {
+			delete(o.hosts, name)
+		}
+	}
 }
 
 func NewContainerHostService() *ContainerHostService {
 	hostService := &ContainerHostService{
 		tlsService: NewTLSCertService(),
+		ops: &hostOps{
+			mu:    new(sync.Mutex),
+			hosts: make(map[string]int),
+		},
 	}
 
 	hostService.repo = host.NewContainerHostRepository()
 
 	hostService.tlsStorageRepo = tlsstorage.NewTLSStorageRepo()
 
+	hostService.registryRepo = registryauth.NewRegistryAuthRepo()
+
+	hostService.repo.UseCertSource(func(ctx context.Context, name string) ([]byte, []byte, []byte, error) {
+		pems, err := hostService.tlsStorageRepo.GetAuthCerts(ctx, name)
+		return pems.ClientKeyPEM, pems.ClientCertPEM, pems.ClientCAPEM, err
+	})
+
 	consul, err := providers.NewConsulProvider()
 	if err != nil {
 		panic(fmt.Sprintf("failed to get consul provider: %v", err))
@@ -40,18 +101,58 @@ func NewContainerHostService() *ContainerHostService {
 	return hostService
 }
 
+// CreateHost provisions a container host for a project. Each stage registers how to undo it,
+// and if a later stage fails the completed stages are undone in reverse order so that a
+// failed create leaves nothing behind.
 // TODO: more to be part of ContainerHostCreateOptions
-// TODO: better error handling, rollback changes on failure etc
-func (service *ContainerHostService) CreateHost(ctx context.Context, name string) error {
-	containerName := host.ContainerName{name}
+func (service *ContainerHostService) CreateHost(ctx context.Context, proj project.Project) (err error) {
+	name := proj.HostName()
+	containerName := host.ContainerName{Name: name}
+
+	defer service.ops.begin(name)()
+
+	rollback := helpers.NewRollback(log.Fields{
+		"containerHost": name,
+	})
+	defer func() {
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"containerHost": name,
+			}).Warn("failed to provision container host, rolling back")
+			if rollbackErr := rollback.Run(); rollbackErr != nil {
+				err = fmt.Errorf("%w (rollback incomplete, the host may need cleaning up: %v)", err, rollbackErr)
+			}
+		}
+	}()
 
-	if err := service.repo.CreateContainerHost(ctx, host.ContainerHostCreateOptions{containerName}); err != nil {
+	createOpts := host.ContainerHostCreateOptions{
+		ContainerName: containerName,
+		Namespace:     proj.Namespace,
+		Project:       proj.Name,
+		Remote:        proj.Placement.Remote,
+		Target:        proj.Placement.Target,
+	}
+	// the namespace's bridge or ACL is set up as part of creating the host, and if this is the
+	// namespace's first host it has to go again even when the host itself was never created
+	rollback.Add("namespace network", func(ctx context.Context) error {
+		return service.repo.ReleaseNamespaceNetwork(ctx, host.NamespaceNetworkOptions{
+			Namespace: proj.Namespace,
+			Remote:    proj.Placement.Remote,
+		})
+	})
+	if err := service.repo.CreateContainerHost(ctx, createOpts); err != nil {
 		return fmt.Errorf("error creating host: %w", err)
 	}
+	rollback.Add("create host", func(ctx context.Context) error {
+		return service.repo.DeleteContainerHost(ctx, host.ContainerHostDeleteOptions{ContainerName: containerName})
+	})
 
-	if err := service.repo.StartContainerHost(ctx, host.ContainerHostStartOptions{containerName}); err != nil {
+	if err := service.repo.StartContainerHost(ctx, host.ContainerHostStartOptions{ContainerName: containerName}); err != nil {
 		return fmt.Errorf("error starting host: %w", err)
 	}
+	rollback.Add("start host", func(ctx context.Context) error {
+		return service.repo.StopContainerHost(ctx, host.ContainerHostStopOptions{ContainerName: containerName})
+	})
 
 	ip, err := service.repo.GetContainerHostIP(ctx, name)
 	if err != nil {
@@ -63,7 +164,8 @@ func (service *ContainerHostService) CreateHost(ctx context.Context, name string
 		return fmt.Errorf("error creating TLS certs: %w", err)
 	}
 
-	if err := service.repo.PushAuthCerts(ctx, host.ContainerPushCertsOptions{containerName}, pems.ClientCAPEM, pems.ServerKeyPEM, pems.ServerCertPEM); err != nil {
+	// the certs pushed to the host and the nginx restart go away with the host itself
+	if err := service.repo.PushAuthCerts(ctx, host.ContainerPushCertsOptions{ContainerName: containerName}, pems.ClientCAPEM, pems.ServerKeyPEM, pems.ServerCertPEM); err != nil {
 		return fmt.Errorf("error pushing TLS certs to host: %w", err)
 	}
 
@@ -71,39 +173,661 @@ func (service *ContainerHostService) CreateHost(ctx context.Context, name string
 		return fmt.Errorf("error restarting nginx: %w", err)
 	}
 
-	service.repo.UseCerts(pems.ClientKeyPEM, pems.ClientCertPEM, pems.ClientCAPEM)
-
 	if err := service.tlsStorageRepo.PushAuthCerts(ctx, containerName.Name, pems.ServerCAPEM, pems.ClientCAPEM, pems.ServerKeyPEM, pems.ServerCertPEM, pems.ClientKeyPEM, pems.ClientCertPEM); err != nil {
 		return fmt.Errorf("error pushing TLS certs to storage: %w", err)
 	}
+	rollback.Add("store TLS certs", func(ctx context.Context) error {
+		return service.tlsStorageRepo.DeleteAuthCerts(ctx, name)
+	})
+
+	// registering can fail half way through, so its undo is added up front
+	rollback.Add("register project", func(ctx context.Context) error {
+		return service.consul.DeregisterProject(name)
+	})
+	if err := service.registerProject(name, ip); err != nil {
+		return fmt.Errorf("error registering project and/or health check: %w", err)
+	}
 
-	err = service.consul.RegisterProject(containerName.Name, ip, func(ip string) (string, bool) {
+	return nil
+}
+
+// RegisterProjects registers the projects in this worker's Consul KV with Consul again, as their
+// services and health checks don't outlive the worker. A project that fails to register doesn't
+// keep the others from being registered.
+func (service *ContainerHostService) RegisterProjects() error {
+	metas, err := service.consul.GetProjectMetas()
+	if err != nil {
+		return err
+	}
+
+	var errs *multierror.Error
+	for _, meta := range metas {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		ip, err := service.repo.GetContainerHostIP(ctx, meta.ID)
+		cancel()
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to get container IP for host %s: %w", meta.ID, err))
+			continue
+		}
+
+		if err := service.registerProject(meta.ID, ip); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to register project %s: %w", meta.ID, err))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// registerProject registers the project with Consul, with a health check that pings the host's Docker daemon
+func (service *ContainerHostService) registerProject(name, ip string) error {
+	return service.consul.RegisterProject(name, ip, func(ip string) (string, bool) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 		defer cancel()
-		err := service.repo.Ping(ctx)
+		err := service.repo.Ping(ctx, name)
 		if err != nil {
 			return err.Error(), false
 		}
 		return "Remote Docker daemon reachable", true
 	})
+}
+
+// adoptHost brings up a container host that was created elsewhere with existing TLS material,
+// such as one imported from an export archive. If the host's IP no longer matches its server
+// cert, a new server cert is issued from the project's root and pushed to the host.
+// The TLS material is then stored and the project registered with this worker.
+func (service *ContainerHostService) adoptHost(ctx context.Context, name string, pems tlsstorage.PEMContainer) (string, error) {
+	containerName := host.ContainerName{Name: name}
+
+	running, err := service.repo.IsContainerHostRunning(ctx, name)
 	if err != nil {
-		return fmt.Errorf("error registering project and/or health check: %w", err)
+		return "", fmt.Errorf("error getting host state: %w", err)
+	}
+
+	if !running {
+		if err := service.repo.StartContainerHost(ctx, host.ContainerHostStartOptions{ContainerName: containerName}); err != nil {
+			return "", fmt.Errorf("error starting host: %w", err)
+		}
+	}
+
+	ip, err := service.repo.GetContainerHostIP(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("error getting host IP: %w", err)
+	}
+
+	certIP, err := service.tlsService.ServerCertIP(pems.ServerCertPEM)
+	if err != nil {
+		return "", fmt.Errorf("error reading server cert: %w", err)
+	}
+
+	if certIP != ip {
+		log.WithFields(log.Fields{
+			"containerHost": name,
+			"oldIP":         certIP,
+			"newIP":         ip,
+		}).Info("host IP changed, re-issuing server cert")
+
+		pems.ServerKeyPEM, pems.ServerCertPEM, err = service.tlsService.ReissueServerPEMs(ip, pems.ServerCAPEM, pems.ClientCAPEM)
+		if err != nil {
+			return "", fmt.Errorf("error re-issuing server cert: %w", err)
+		}
+
+		if err := service.repo.PushAuthCerts(ctx, host.ContainerPushCertsOptions{ContainerName: containerName}, pems.ClientCAPEM, pems.ServerKeyPEM, pems.ServerCertPEM); err != nil {
+			return "", fmt.Errorf("error pushing TLS certs to host: %w", err)
+		}
+
+		if err := service.repo.RestartNGINX(ctx, name); err != nil {
+			return "", fmt.Errorf("error restarting nginx: %w", err)
+		}
+	}
+
+	if err := service.tlsStorageRepo.PushAuthCerts(ctx, name, pems.ServerCAPEM, pems.ClientCAPEM, pems.ServerKeyPEM, pems.ServerCertPEM, pems.ClientKeyPEM, pems.ClientCertPEM); err != nil {
+		return "", fmt.Errorf("error pushing TLS certs to storage: %w", err)
+	}
+
+	if err := service.registerProject(name, ip); err != nil {
+		return "", fmt.Errorf("error registering project and/or health check: %w", err)
 	}
 
+	return ip, nil
+}
+
+// rekeyHost issues new TLS material for a host whose certs have been lost, pushes it to the
+// host and storage and re-registers the project. Clients holding the old certs are locked out.
+func (service *ContainerHostService) rekeyHost(ctx context.Context, name string) error {
+	containerName := host.ContainerName{Name: name}
+
+	ip, err := service.repo.GetContainerHostIP(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error getting host IP: %w", err)
+	}
+
+	pems, err := service.tlsService.CreatePEMs(ip)
+	if err != nil {
+		return fmt.Errorf("error creating TLS certs: %w", err)
+	}
+
+	if err := service.repo.PushAuthCerts(ctx, host.ContainerPushCertsOptions{ContainerName: containerName}, pems.ClientCAPEM, pems.ServerKeyPEM, pems.ServerCertPEM); err != nil {
+		return fmt.Errorf("error pushing TLS certs to host: %w", err)
+	}
+
+	if err := service.repo.RestartNGINX(ctx, name); err != nil {
+		return fmt.Errorf("error restarting nginx: %w", err)
+	}
+
+	if err := service.tlsStorageRepo.PushAuthCerts(ctx, name, pems.ServerCAPEM, pems.ClientCAPEM, pems.ServerKeyPEM, pems.ServerCertPEM, pems.ClientKeyPEM, pems.ClientCertPEM); err != nil {
+		return fmt.Errorf("error pushing TLS certs to storage: %w", err)
+	}
+
+	return service.registerProject(name, ip)
+}
+
+// reregisterHost registers a project whose host and certs exist but whose Consul service is missing
+func (service *ContainerHostService) reregisterHost(ctx context.Context, name string) error {
+	ip, err := service.repo.GetContainerHostIP(ctx, name)
+	if err != nil {
+		return fmt.Errorf("error getting host IP: %w", err)
+	}
+
+	return service.registerProject(name, ip)
+}
+
+// discardHost stops and deletes a container host that this worker no longer owns
+func (service *ContainerHostService) discardHost(ctx context.Context, name string) error {
+	containerName := host.ContainerName{Name: name}
+
+	running, err := service.repo.IsContainerHostRunning(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if running {
+		if err := service.repo.StopContainerHost(ctx, host.ContainerHostStopOptions{ContainerName: containerName}); err != nil {
+			return fmt.Errorf("error stopping host: %w", err)
+		}
+	}
+
+	return service.repo.DeleteContainerHost(ctx, host.ContainerHostDeleteOptions{ContainerName: containerName})
+}
+
+// DeleteProject deletes a project on this worker: its container host and volumes, its certs,
+// its snapshot policy and its registration with Consul. Snapshot schedules already loaded by
+// workers are skipped when they fire, as the host wont be found
+func (service *ContainerHostService) DeleteProject(ctx context.Context, name string) error {
+	meta, err := service.consul.GetProjectMeta(name)
+	if err != nil {
+		return fmt.Errorf("error getting project metadata: %w", err)
+	}
+	if meta == nil {
+		return host.ErrHostNotFound
+	}
+
+	log.WithFields(log.Fields{
+		"containerHost": name,
+	}).Info("deleting project")
+
+	// deregistered first so that the stopped host doesnt fail its health check
+	if err := service.consul.DeregisterProject(name); err != nil {
+		return fmt.Errorf("error deregistering project: %w", err)
+	}
+
+	running, err := service.repo.IsContainerHostRunning(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	containerName := host.ContainerName{Name: name}
+	if running {
+		if err := service.repo.StopContainerHost(ctx, host.ContainerHostStopOptions{ContainerName: containerName}); err != nil {
+			return fmt.Errorf("error stopping host: %w", err)
+		}
+	}
+
+	if err := service.repo.DeleteContainerHost(ctx, host.ContainerHostDeleteOptions{
+		ContainerName: containerName,
+		DeleteVolumes: true,
+	}); err != nil {
+		return fmt.Errorf("error deleting host: %w", err)
+	}
+
+	if err := service.tlsStorageRepo.DeleteAuthCerts(ctx, name); err != nil {
+		return fmt.Errorf("error deleting TLS certs from storage: %w", err)
+	}
+
+	rules, err := service.consul.GetIngressRules(name)
+	if err != nil {
+		return fmt.Errorf("error getting ingress rules: %w", err)
+	}
+	if err := service.releaseHostnames(ctx, name, rules.Hostnames()); err != nil {
+		return fmt.Errorf("error releasing ingress hostnames: %w", err)
+	}
+	if err := service.consul.DeleteIngressRules(name); err != nil {
+		return fmt.Errorf("error deleting ingress rules: %w", err)
+	}
+
+	return service.consul.DeleteSnapshotPolicy(name)
+}
+
+// releaseHostnames gives up a project's claims on ingress hostnames and deletes its certificates
+// for them
+func (service *ContainerHostService) releaseHostnames(ctx context.Context, name string, hostnames []string) error {
+	for _, hostname := range hostnames {
+		if err := service.consul.ReleaseHostname(hostname, name); err != nil {
+			return err
+		}
+		if err := service.tlsStorageRepo.DeleteCertificate(ctx, name, hostname); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (service *ContainerHostService) ListRemotes(ctx context.Context) ([]host.Remote, error) {
+	return service.repo.ListRemotes(ctx)
+}
+
+var errDependencyFailed = errors.New("dependency failed to start")
+
+// ContainerErrors are the containers CreateServices failed to create, by name
+type ContainerErrors map[string]error
+
+func (e ContainerErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	msgs := make([]string, 0, len(e))
+	for _, name := range names {
+		msgs = append(msgs, fmt.Sprintf("container %s: %v", name, e[name]))
+	}
+	return fmt.Sprintf("%d containers failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// MarshalJSON renders the error of each container as its message
+func (e ContainerErrors) MarshalJSON() ([]byte, error) {
+	msgs := make(map[string]string, len(e))
+	for name, err := range e {
+		msgs[name] = err.Error()
+	}
+	return json.Marshal(msgs)
+}
+
+// CreateServices creates any of the project's volumes that dont exist yet, then its containers
+// on the project network, where each is reachable by its name. Containers are created in parallel,
+// up to `docker.createConcurrency` at a time, except that a container is only created once each
+// container it depends on is running, or healthy if it has a healthcheck. Containers whose
+// dependencies failed are skipped. Any failures are returned as ContainerErrors.
 func (service *ContainerHostService) CreateServices(ctx context.Context, name string, data project.Project) error {
-	/* pems, err := service.tlsStorageRepo.GetAuthCerts(ctx, name)
+	ordered, err := data.Containers.StartOrder()
+	if err != nil {
+		return err
+	}
+
+	for _, vol := range data.Volumes {
+		if err := service.repo.EnsureVolume(ctx, host.VolumeOptions{
+			ContainerName: host.ContainerName{Name: name},
+			Volume:        vol,
+		}); err != nil {
+			return fmt.Errorf("volume %s: %w", vol.Name, err)
+		}
+	}
+
+	if err := service.repo.EnsureProjectNetwork(ctx, name); err != nil {
+		return err
+	}
+
+	concurrency := viper.GetInt("docker.createConcurrency")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	creation := &serviceCreation{
+		service: service,
+		name:    name,
+		data:    data,
+		slots:   make(chan struct{}, concurrency),
+		done:    make(map[string]chan struct{}, len(ordered)),
+		ready:   make(map[string]*onceResult, len(ordered)),
+		pulls:   make(map[string]*onceResult),
+		mu:      new(sync.Mutex),
+		errs:    make(ContainerErrors),
+	}
+	for _, ctr := range ordered {
+		creation.done[ctr.Name] = make(chan struct{})
+		creation.ready[ctr.Name] = new(onceResult)
+	}
+
+	var wg sync.WaitGroup
+	for _, ctr := range ordered {
+		wg.Add(1)
+		go func(ctr container.Container) {
+			defer wg.Done()
+			defer close(creation.done[ctr.Name])
+
+			if err := creation.create(ctx, ctr); err != nil {
+				creation.fail(ctr.Name, err)
+			}
+		}(ctr)
+	}
+	wg.Wait()
+
+	if len(creation.errs) > 0 {
+		return creation.errs
+	}
+	return nil
+}
+
+// serviceCreation is a single run of CreateServices
+type serviceCreation struct {
+	service *ContainerHostService
+	name    string
+	data    project.Project
+
+	// bounds how many containers are pulled and created at once
+	slots chan struct{}
+	// closed once a container has been created or has failed
+	done map[string]chan struct{}
+	// waits on containers other containers depend on, by container name
+	ready map[string]*onceResult
+	// image pulls shared by containers using the same image, by fully qualified reference
+	pulls map[string]*onceResult
+
+	mu   *sync.Mutex
+	errs ContainerErrors
+}
+
+// onceResult runs something once and hands its error to everyone who asks for it
+type onceResult struct {
+	once sync.Once
+	err  error
+}
+
+func (r *onceResult) do(f func() error) error {
+	r.once.Do(func() {
+		r.err = f()
+	})
+	return r.err
+}
+
+func (c *serviceCreation) fail(ctrName string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.errs[ctrName]; !ok {
+		c.errs[ctrName] = err
+	}
+}
+
+func (c *serviceCreation) failed(ctrName string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.errs[ctrName]
+	return ok
+}
+
+func (c *serviceCreation) create(ctx context.Context, ctr container.Container) error {
+	for _, dep := range ctr.DependsOn {
+		select {
+		case <-c.done[dep]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if c.failed(dep) {
+			return fmt.Errorf("%w: %s", errDependencyFailed, dep)
+		}
+
+		// containers that arent started can depend on others that arent either, which never get ready
+		if !ctr.StartOnCreate() {
+			continue
+		}
+
+		if err := c.waitReady(ctx, dep); err != nil {
+			c.fail(dep, fmt.Errorf("not ready: %w", err))
+			return fmt.Errorf("%w: %s", errDependencyFailed, dep)
+		}
+	}
+
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-c.slots }()
+
+	if err := c.pull(ctx, ctr.Image); err != nil {
+		return err
+	}
+
+	return c.service.repo.CreateContainer(ctx, host.ContainerCreateOptions{
+		ContainerName: host.ContainerName{Name: c.name},
+		Container:     ctr,
+		Volumes:       c.data.Volumes,
+	})
+}
+
+// waitReady waits for a container to be running, or healthy if it has a healthcheck. Each
+// container is only waited on once however many containers depend on it
+func (c *serviceCreation) waitReady(ctx context.Context, dep string) error {
+	return c.ready[dep].do(func() error {
+		fields := log.Fields{
+			"containerHost": c.name,
+			"container":     dep,
+		}
+		log.WithFields(fields).Debug("waiting for dependency")
+
+		waitCtx, cancel := context.WithTimeout(ctx, viper.GetDuration("docker.dependencyTimeout"))
+		defer cancel()
+
+		err := c.service.repo.WaitForContainer(waitCtx, host.ContainerWaitOptions{
+			ContainerName: host.ContainerName{Name: c.name},
+			Container:     dep,
+		})
+		if err != nil {
+			log.WithError(err).WithFields(fields).Error("dependency not ready")
+		}
+		return err
+	})
+}
+
+// pull pulls an image, once however many containers use it however they spell it
+func (c *serviceCreation) pull(ctx context.Context, image string) error {
+	ref, err := container.ParseImageReference(image)
 	if err != nil {
 		return err
-	} */
+	}
+	key := ref.String()
+
+	c.mu.Lock()
+	pull, ok := c.pulls[key]
+	if !ok {
+		pull = new(onceResult)
+		c.pulls[key] = pull
+	}
+	c.mu.Unlock()
+
+	return pull.do(func() error {
+		auth, err := c.service.registryAuth(ctx, c.data.Namespace, image)
+		if err != nil {
+			return err
+		}
+
+		return c.service.repo.PullImage(ctx, host.ImagePullOptions{
+			ContainerName: host.ContainerName{Name: c.name},
+			Image:         image,
+			RegistryAuth:  auth,
+		})
+	})
+}
+
+// DeployProject creates the project's container host and containers, or if the project is
+// already registered on this worker, replaces its containers. created reports which was
+// attempted, even if it failed.
+func (service *ContainerHostService) DeployProject(ctx context.Context, proj project.Project) (created bool, err error) {
+	name := proj.HostName()
+
+	meta, err := service.consul.GetProjectMeta(name)
+	if err != nil {
+		return false, fmt.Errorf("error getting project metadata: %w", err)
+	}
+
+	if meta != nil {
+		return false, service.UpdateServices(ctx, name, proj)
+	}
 
-	var err *multierror.Error
+	if err := service.CreateHost(ctx, proj); err != nil {
+		return true, err
+	}
+	return true, service.CreateServices(ctx, name, proj)
+}
+
+// suffix of the containers set aside while UpdateServices replaces them
+const updateOldSuffix = "-old"
 
-	for _, container := range data.Containers {
-		multierror.Append(err, service.repo.CreateContainer(ctx, container))
+// UpdateServices replaces a project's containers with those in data. The old containers are stopped
+// and set aside rather than removed, and if any new container fails to be created the new ones are
+// removed and the old ones put back as they were. The old containers are only removed once every
+// new one has been created, and their anonymous volumes are kept.
+func (service *ContainerHostService) UpdateServices(ctx context.Context, name string, data project.Project) (err error) {
+	containerName := host.ContainerName{Name: name}
+
+	existing, err := service.repo.ListContainers(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// containers created before they were labelled are only found by name
+	replace := make(map[string]bool, len(existing)+len(data.Containers))
+	for _, ctr := range existing {
+		replace[ctr.Name] = true
+	}
+	for _, ctr := range data.Containers {
+		replace[ctr.Name] = true
 	}
 
-	return err.ErrorOrNil()
+	rollback := helpers.NewRollback(log.Fields{
+		"containerHost": name,
+	})
+	defer func() {
+		if err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"containerHost": name,
+			}).Warn("failed to update containers, restoring the old ones")
+			if rollbackErr := rollback.Run(); rollbackErr != nil {
+				err = fmt.Errorf("%w (restoring the old containers failed: %v)", err, rollbackErr)
+			}
+		}
+	}()
+
+	setAside := make(map[string]bool, len(replace))
+	for ctrName := range replace {
+		old := ctrName + updateOldSuffix
+
+		if err := service.recoverSetAside(ctx, name, ctrName); err != nil {
+			return fmt.Errorf("container %s: %w", ctrName, err)
+		}
+
+		current, err := service.repo.InspectContainer(ctx, host.ContainerInspectOptions{ContainerName: containerName, Container: ctrName})
+		if errors.Is(err, host.ErrContainerNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("container %s: %w", ctrName, err)
+		}
+
+		log.WithFields(log.Fields{
+			"containerHost": name,
+			"container":     ctrName,
+		}).Debug("setting aside container")
+
+		if err := service.repo.StopContainer(ctx, host.ContainerStopOptions{ContainerName: containerName, Container: ctrName}); err != nil {
+			return fmt.Errorf("container %s: %w", ctrName, err)
+		}
+		wasRunning := current.State == "running"
+		ctrName := ctrName
+		rollback.Add("stop "+ctrName, func(ctx context.Context) error {
+			if !wasRunning {
+				return nil
+			}
+			return service.repo.StartContainer(ctx, host.ContainerStartOptions{ContainerName: containerName, Container: ctrName})
+		})
+
+		if err := service.repo.RenameContainer(ctx, host.ContainerRenameOptions{ContainerName: containerName, Container: ctrName, NewName: old}); err != nil {
+			return fmt.Errorf("container %s: %w", ctrName, err)
+		}
+		rollback.Add("set aside "+ctrName, func(ctx context.Context) error {
+			if err := service.repo.RemoveContainer(ctx, host.ContainerRemoveOptions{ContainerName: containerName, Container: ctrName}); err != nil {
+				return err
+			}
+			return service.repo.RenameContainer(ctx, host.ContainerRenameOptions{ContainerName: containerName, Container: old, NewName: ctrName})
+		})
+
+		setAside[ctrName] = true
+	}
+
+	// removes whatever was created, including containers that replace nothing
+	rollback.Add("create containers", func(ctx context.Context) error {
+		for _, ctr := range data.Containers {
+			// those are removed when the old container is put back
+			if setAside[ctr.Name] {
+				continue
+			}
+			if err := service.repo.RemoveContainer(ctx, host.ContainerRemoveOptions{ContainerName: containerName, Container: ctr.Name}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err := service.CreateServices(ctx, name, data); err != nil {
+		return err
+	}
+
+	for ctrName := range setAside {
+		old := ctrName + updateOldSuffix
+		if err := service.repo.RemoveContainer(ctx, host.ContainerRemoveOptions{ContainerName: containerName, Container: old, KeepVolumes: true}); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"containerHost": name,
+				"container":     old,
+			}).Warn("failed to remove replaced container")
+		}
+	}
+	return nil
+}
+
+// recoverSetAside deals with a container left set aside by an earlier UpdateServices that was
+// interrupted. If it was never replaced it is still the only copy and is put back, otherwise it
+// is removed
+func (service *ContainerHostService) recoverSetAside(ctx context.Context, name, ctrName string) error {
+	containerName := host.ContainerName{Name: name}
+	old := ctrName + updateOldSuffix
+
+	if _, err := service.repo.InspectContainer(ctx, host.ContainerInspectOptions{ContainerName: containerName, Container: old}); err != nil {
+		if errors.Is(err, host.ErrContainerNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	_, err := service.repo.InspectContainer(ctx, host.ContainerInspectOptions{ContainerName: containerName, Container: ctrName})
+	if errors.Is(err, host.ErrContainerNotFound) {
+		return service.repo.RenameContainer(ctx, host.ContainerRenameOptions{ContainerName: containerName, Container: old, NewName: ctrName})
+	}
+	if err != nil {
+		return err
+	}
+	return service.repo.RemoveContainer(ctx, host.ContainerRemoveOptions{ContainerName: containerName, Container: old, KeepVolumes: true})
+}
+
+// registryAuth returns the namespace's credentials for the registry an image is pulled from,
+// or nil if it has none
+func (service *ContainerHostService) registryAuth(ctx context.Context, namespace, image string) (*registry.Credential, error) {
+	ref, err := container.ParseImageReference(image)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := service.registryRepo.GetCredential(ctx, namespace, ref.Registry)
+	if err != nil {
+		return nil, fmt.Errorf("error getting credentials for registry %s: %w", ref.Registry, err)
+	}
+	return cred, nil
 }
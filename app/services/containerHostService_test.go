@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Strum355/log"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/registry"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	registryauth "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/registryAuth"
+)
+
+func TestMain(m *testing.M) {
+	log.InitSimpleLogger(&log.Config{})
+	os.Exit(m.Run())
+}
+
+// fakeHostRepo records the containers created and waited on. Containers that arent started are
+// never ready, so waiting on one blocks until the wait is cancelled
+type fakeHostRepo struct {
+	host.ContainerHostRepository
+
+	stopped map[string]bool
+
+	mu      *sync.Mutex
+	created []string
+	waited  []string
+}
+
+func (r *fakeHostRepo) EnsureProjectNetwork(ctx context.Context, name string) error {
+	return nil
+}
+
+func (r *fakeHostRepo) PullImage(ctx context.Context, opts host.ImagePullOptions) error {
+	return nil
+}
+
+func (r *fakeHostRepo) CreateContainer(ctx context.Context, opts host.ContainerCreateOptions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.created = append(r.created, opts.Container.Name)
+	return nil
+}
+
+func (r *fakeHostRepo) WaitForContainer(ctx context.Context, opts host.ContainerWaitOptions) error {
+	r.mu.Lock()
+	r.waited = append(r.waited, opts.Container)
+	r.mu.Unlock()
+
+	if r.stopped[opts.Container] {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+type fakeRegistryRepo struct {
+	registryauth.RegistryAuthRepo
+}
+
+func (fakeRegistryRepo) GetCredential(ctx context.Context, namespace, registryHost string) (*registry.Credential, error) {
+	return nil, nil
+}
+
+func TestCreateServicesWaitsForDependencies(t *testing.T) {
+	no := false
+	ctr := func(name string, started bool, deps ...string) container.Container {
+		c := container.Container{Name: name, Image: "nginx", DependsOn: deps}
+		if !started {
+			c.Started = &no
+		}
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		containers container.Containers
+		wantWaited []string
+	}{
+		{
+			name:       "started dependency",
+			containers: container.Containers{ctr("web", true, "db"), ctr("db", true)},
+			wantWaited: []string{"db"},
+		},
+		{
+			name:       "stopped container on stopped dependency",
+			containers: container.Containers{ctr("job", false, "db"), ctr("db", false)},
+			wantWaited: []string{},
+		},
+		{
+			name:       "stopped container on started dependency",
+			containers: container.Containers{ctr("job", false, "db"), ctr("db", true)},
+			wantWaited: []string{},
+		},
+		{
+			name:       "shared dependency waited on once",
+			containers: container.Containers{ctr("web", true, "db"), ctr("worker", true, "db"), ctr("db", true)},
+			wantWaited: []string{"db"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeHostRepo{stopped: make(map[string]bool), mu: new(sync.Mutex), waited: []string{}}
+			for _, c := range tt.containers {
+				repo.stopped[c.Name] = !c.StartOnCreate()
+			}
+			service := &ContainerHostService{repo: repo, registryRepo: fakeRegistryRepo{}}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			err := service.CreateServices(ctx, "netsoc-test", project.Project{Namespace: "netsoc", Containers: tt.containers})
+			if err != nil {
+				t.Fatalf("CreateServices() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(repo.waited, tt.wantWaited) {
+				t.Errorf("waited on %v, want %v", repo.waited, tt.wantWaited)
+			}
+			sort.Strings(repo.created)
+			want := make([]string, 0, len(tt.containers))
+			for _, c := range tt.containers {
+				want = append(want, c.Name)
+			}
+			sort.Strings(want)
+			if !reflect.DeepEqual(repo.created, want) {
+				t.Errorf("created %v, want %v", repo.created, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/event"
+)
+
+// EventFilter selects events from the buffer. Zero fields match every event
+type EventFilter struct {
+	Host string
+	Type event.Type
+	// Only events with a greater ID, to poll for new events
+	After uint64
+}
+
+// EventService watches the LXD event stream of every remote and the Docker event stream of every
+// project on this worker, logging the events that matter and keeping the last
+// `events.bufferSize` of them in memory
+type EventService struct {
+	hostService *ContainerHostService
+
+	mu     *sync.Mutex
+	buffer []event.Event
+	next   int
+	seq    uint64
+	// Docker event watchers by container host, only for projects on this worker
+	watchers map[string]*eventWatcher
+
+	subscribers []func(event.Event)
+}
+
+type eventWatcher struct {
+	cancel context.CancelFunc
+}
+
+func NewEventService(hostService *ContainerHostService) *EventService {
+	return &EventService{
+		hostService: hostService,
+		mu:          new(sync.Mutex),
+		buffer:      make([]event.Event, 0, viper.GetInt("events.bufferSize")),
+		watchers:    make(map[string]*eventWatcher),
+	}
+}
+
+// Start watches the LXD remotes and starts a Docker event watcher for each project, resyncing
+// the set of watchers with the project metadata every `events.resyncInterval`. Watchers
+// whose stream drops are restarted by the next resync
+func (service *EventService) Start() {
+	go service.watchHosts()
+
+	go func() {
+		for {
+			service.resync()
+			time.Sleep(viper.GetDuration("events.resyncInterval"))
+		}
+	}()
+}
+
+// Events returns the buffered events matching filter, oldest first
+func (service *EventService) Events(filter EventFilter) []event.Event {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	events := make([]event.Event, 0)
+	for i := range service.buffer {
+		// once the buffer is full, next is the oldest event
+		ev := service.buffer[(service.next+i)%len(service.buffer)]
+		if ev.ID <= filter.After ||
+			(filter.Host != "" && ev.Host != filter.Host) ||
+			(filter.Type != "" && ev.Type != filter.Type) {
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+// Subscribe calls f with every event as it is recorded. f must not block
+func (service *EventService) Subscribe(f func(event.Event)) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	service.subscribers = append(service.subscribers, f)
+}
+
+func (service *EventService) record(ev event.Event) {
+	service.mu.Lock()
+	service.seq++
+	ev.ID = service.seq
+	if len(service.buffer) < cap(service.buffer) {
+		service.buffer = append(service.buffer, ev)
+	} else if len(service.buffer) > 0 {
+		service.buffer[service.next] = ev
+		service.next = (service.next + 1) % len(service.buffer)
+	}
+	subscribers := service.subscribers
+	service.mu.Unlock()
+
+	for _, f := range subscribers {
+		f(ev)
+	}
+
+	fields := log.Fields{
+		"event":         ev.Type,
+		"containerHost": ev.Host,
+	}
+	if ev.Container != "" {
+		fields["container"] = ev.Container
+	}
+	if ev.ExitCode != nil {
+		fields["exitCode"] = *ev.ExitCode
+	}
+
+	if ev.Abnormal() {
+		log.WithFields(fields).Warn(ev.Message)
+	} else {
+		log.WithFields(fields).Info(ev.Message)
+	}
+}
+
+// watchHosts records the lifecycle events of this worker's container hosts, reconnecting to
+// LXD if the stream drops. A host starting gets its Docker event watcher started straight away
+func (service *EventService) watchHosts() {
+	for {
+		err := service.hostService.repo.WatchContainerHostEvents(context.Background(), func(ev event.Event) {
+			service.mu.Lock()
+			_, owned := service.watchers[ev.Host]
+			service.mu.Unlock()
+
+			// LXD remotes may be shared, so only hosts with metadata on this worker are recorded
+			if !owned && !service.isProject(ev.Host) {
+				return
+			}
+
+			service.record(ev)
+			if ev.Type == event.HostStarted {
+				go service.watch(ev.Host)
+			}
+		})
+		log.WithError(err).Warn("lost LXD event stream, reconnecting")
+		time.Sleep(viper.GetDuration("events.retryInterval"))
+	}
+}
+
+func (service *EventService) isProject(name string) bool {
+	metas, err := service.hostService.consul.GetProjectMetas()
+	if err != nil {
+		return false
+	}
+
+	for _, meta := range metas {
+		if meta.ID == name {
+			return true
+		}
+	}
+	return false
+}
+
+// resync starts watchers for projects without one and stops those of deleted projects
+func (service *EventService) resync() {
+	metas, err := service.hostService.consul.GetProjectMetas()
+	if err != nil {
+		log.WithError(err).Error("failed to get project metadata for event watchers")
+		return
+	}
+
+	projects := make(map[string]bool, len(metas))
+	for _, meta := range metas {
+		projects[meta.ID] = true
+		go service.watch(meta.ID)
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	for name, watcher := range service.watchers {
+		if !projects[name] {
+			watcher.cancel()
+			delete(service.watchers, name)
+		}
+	}
+}
+
+// watch records the Docker events of a container host until its stream drops or the project is
+// deleted. It does nothing if the host already has a watcher or isnt running
+func (service *EventService) watch(name string) {
+	repo := service.hostService.repo
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := &eventWatcher{cancel: cancel}
+
+	service.mu.Lock()
+	if _, ok := service.watchers[name]; ok {
+		service.mu.Unlock()
+		return
+	}
+	service.watchers[name] = watcher
+	service.mu.Unlock()
+
+	defer func() {
+		service.mu.Lock()
+		defer service.mu.Unlock()
+		if service.watchers[name] == watcher {
+			delete(service.watchers, name)
+		}
+	}()
+
+	if running, err := repo.IsContainerHostRunning(ctx, name); err != nil || !running {
+		return
+	}
+
+	if err := repo.WatchContainerEvents(ctx, name, service.record); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": name}).Debug("lost Docker event stream")
+	}
+}
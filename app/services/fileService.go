@@ -0,0 +1,69 @@
+package services
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path"
+	"time"
+
+	"github.com/Strum355/log"
+
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+)
+
+// FileService copies files into and out of project container hosts and their Docker containers,
+// as tar archives
+type FileService struct {
+	hostService *ContainerHostService
+}
+
+func NewFileService(hostService *ContainerHostService) *FileService {
+	return &FileService{
+		hostService: hostService,
+	}
+}
+
+// Push extracts the archive of opts into the directory at opts.Path
+func (service *FileService) Push(ctx context.Context, opts host.FilePushOptions) error {
+	log.WithFields(log.Fields{
+		"containerHost": opts.Name,
+		"container":     opts.Container,
+		"path":          opts.Path,
+	}).Info("pushing files")
+
+	return service.hostService.repo.PushFiles(ctx, opts)
+}
+
+// PushFile writes size bytes of content to the file at opts.Path, creating it as root with mode
+// 0644 unless opts overrides them
+func (service *FileService) PushFile(ctx context.Context, opts host.FilePushOptions, content io.Reader, size int64) error {
+	r, w := io.Pipe()
+	go func() {
+		archive := tar.NewWriter(w)
+		err := archive.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Base(opts.Path),
+			Size:     size,
+			Mode:     0644,
+			ModTime:  time.Now(),
+		})
+		if err == nil {
+			_, err = io.CopyN(archive, content, size)
+		}
+		if err == nil {
+			err = archive.Close()
+		}
+		w.CloseWithError(err)
+	}()
+	defer r.Close()
+
+	opts.Archive = r
+	opts.Path = path.Dir(opts.Path)
+	return service.Push(ctx, opts)
+}
+
+// Pull writes a tar archive of the file or directory at opts.Path to w
+func (service *FileService) Pull(ctx context.Context, opts host.FilePullOptions, w io.Writer) error {
+	return service.hostService.repo.PullFiles(ctx, opts, w)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+	cron "gopkg.in/robfig/cron.v2"
+
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+)
+
+// ImageService keeps the base image container hosts are created from up to date
+type ImageService struct {
+	repo host.ContainerHostRepository
+	cron *cron.Cron
+}
+
+func NewImageService(hostService *ContainerHostService) *ImageService {
+	return &ImageService{
+		repo: hostService.repo,
+		cron: cron.New(),
+	}
+}
+
+// StartRefresh schedules base image refreshes according to `lxd.image.refreshSchedule`
+func (service *ImageService) StartRefresh() error {
+	schedule := viper.GetString("lxd.image.refreshSchedule")
+	if schedule == "" {
+		return nil
+	}
+
+	_, err := service.cron.AddFunc(schedule, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("lxd.image.timeout"))
+		defer cancel()
+
+		if err := service.Refresh(ctx); err != nil {
+			log.WithError(err).Error("scheduled base image refresh failed")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	service.cron.Start()
+	return nil
+}
+
+func (service *ImageService) Refresh(ctx context.Context) error {
+	log.Info("refreshing base image")
+	return service.repo.RefreshBaseImage(ctx)
+}
+
+func (service *ImageService) ListBaseImages(ctx context.Context) ([]host.BaseImage, error) {
+	return service.repo.ListBaseImages(ctx)
+}
+
+func (service *ImageService) ListHostImages(ctx context.Context) ([]host.HostImage, error) {
+	return service.repo.ListHostImages(ctx)
+}
@@ -0,0 +1,416 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+	cron "gopkg.in/robfig/cron.v2"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/event"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/ingress"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+)
+
+var ErrHostnameClaimed = errors.New("ingress hostname is used by another project")
+
+// IngressService routes HTTP requests to project containers through the nginx in each container
+// host, generating its config from the project's ingress rules. Containers are proxied to by their
+// address on the project network, so the config is regenerated whenever containers are replaced
+// and whenever a container or container host starts, as either can change the addresses.
+// Hostnames with TLS set get ACME certificates, renewed every `acme.schedule` once they're within
+// `acme.renewBefore` of expiring. A hostname belongs to the first project to set a rule for it until
+// that project drops it, so that no other project can route it or get its certificate
+type IngressService struct {
+	hostService *ContainerHostService
+	acmeService *ACMEService
+	cron        *cron.Cron
+	// applies are serialised so that the config kept when nginx rejects a new one is the last good one
+	mu *sync.Mutex
+
+	pendingMu *sync.Mutex
+	// container hosts with an apply queued by an event, so that a burst of containers starting
+	// only queues one
+	pending map[string]bool
+}
+
+func NewIngressService(hostService *ContainerHostService, acmeService *ACMEService, eventService *EventService) *IngressService {
+	service := &IngressService{
+		hostService: hostService,
+		acmeService: acmeService,
+		cron:        cron.New(),
+		mu:          new(sync.Mutex),
+		pendingMu:   new(sync.Mutex),
+		pending:     make(map[string]bool),
+	}
+
+	eventService.Subscribe(service.onEvent)
+	return service
+}
+
+// onEvent regenerates the nginx config of a project when one of its containers or its container
+// host starts, as Docker hands out addresses afresh when a container starts
+func (service *IngressService) onEvent(ev event.Event) {
+	if ev.Type != event.ContainerStarted && ev.Type != event.HostStarted {
+		return
+	}
+
+	service.pendingMu.Lock()
+	if service.pending[ev.Host] {
+		service.pendingMu.Unlock()
+		return
+	}
+	service.pending[ev.Host] = true
+	service.pendingMu.Unlock()
+
+	go func() {
+		// cleared before applying so that a container starting during the apply queues another
+		service.pendingMu.Lock()
+		delete(service.pending, ev.Host)
+		service.pendingMu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		if err := service.Apply(ctx, ev.Host); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"containerHost": ev.Host,
+				"event":         ev.Type,
+			}).Warn("failed to apply ingress rules after start")
+		}
+	}()
+}
+
+// StartRenewal schedules issuing and renewing the certificates of every project according to
+// `acme.schedule`
+func (service *IngressService) StartRenewal() error {
+	schedule := viper.GetString("acme.schedule")
+	if schedule == "" {
+		return nil
+	}
+
+	_, err := service.cron.AddFunc(schedule, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("acme.timeout"))
+		defer cancel()
+
+		if err := service.Renew(ctx); err != nil {
+			log.WithError(err).Error("failed to renew ingress certificates")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	service.cron.Start()
+	return nil
+}
+
+// Rules returns the ingress rules of a project
+func (service *IngressService) Rules(ctx context.Context, name string) (ingress.Rules, error) {
+	rules, err := service.hostService.consul.GetIngressRules(name)
+	if err != nil {
+		return nil, err
+	}
+	if rules == nil {
+		rules = ingress.Rules{}
+	}
+	return rules, nil
+}
+
+// CheckHostnames returns ErrHostnameClaimed if another project owns any of the hostnames in the
+// rules, so that creating a project with them can be refused before its container host is created
+func (service *IngressService) CheckHostnames(name string, rules ingress.Rules) error {
+	for _, hostname := range rules.Hostnames() {
+		owner, err := service.hostService.consul.GetHostnameOwner(hostname)
+		if err != nil {
+			return err
+		}
+		if owner != "" && owner != name {
+			return fmt.Errorf("%w: %s", ErrHostnameClaimed, hostname)
+		}
+	}
+	return nil
+}
+
+// ClaimExisting claims the hostnames of every project's saved rules, for rules saved before
+// hostnames were claimed
+func (service *IngressService) ClaimExisting() error {
+	all, err := service.hostService.consul.GetAllIngressRules()
+	if err != nil {
+		return err
+	}
+
+	for name, rules := range all {
+		for _, hostname := range rules.Hostnames() {
+			owner, err := service.hostService.consul.ClaimHostname(hostname, name)
+			if err != nil {
+				return err
+			}
+			if owner != name {
+				log.WithFields(log.Fields{
+					"containerHost": name,
+					"hostname":      hostname,
+					"owner":         owner,
+				}).Warn("ingress hostname is claimed by another project")
+			}
+		}
+	}
+	return nil
+}
+
+// SetRules replaces the ingress rules of a project. The rules are only saved once nginx has
+// accepted and reloaded the config generated from them. Hostnames claimed by another project are
+// refused with ErrHostnameClaimed, and hostnames the project no longer routes are released
+func (service *IngressService) SetRules(ctx context.Context, name string, rules ingress.Rules) error {
+	previous, err := service.hostService.consul.GetIngressRules(name)
+	if err != nil {
+		return err
+	}
+	// projects that never had rules are left with nginx as it is
+	if len(rules) == 0 && previous == nil {
+		return nil
+	}
+
+	added := difference(rules.Hostnames(), previous.Hostnames())
+	for _, hostname := range rules.Hostnames() {
+		owner, err := service.hostService.consul.ClaimHostname(hostname, name)
+		if err == nil && owner != name {
+			err = fmt.Errorf("%w: %s", ErrHostnameClaimed, hostname)
+		}
+		if err != nil {
+			service.release(ctx, name, added)
+			return err
+		}
+	}
+
+	if err := service.apply(ctx, name, rules); err != nil {
+		service.release(ctx, name, added)
+		return err
+	}
+	if err := service.hostService.consul.SaveIngressRules(name, rules); err != nil {
+		service.release(ctx, name, added)
+		return err
+	}
+	service.release(ctx, name, difference(previous.Hostnames(), rules.Hostnames()))
+
+	if len(rules.TLSHostnames()) > 0 {
+		// issuing can take a while, HTTPS is switched on by another apply once it's done
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("acme.timeout"))
+			defer cancel()
+
+			if err := service.issue(ctx, name, rules); err != nil {
+				log.WithError(err).WithFields(log.Fields{"containerHost": name}).Error("failed to issue ingress certificates")
+			}
+		}()
+	}
+	return nil
+}
+
+// release gives up the project's claims on hostnames it doesnt route. A claim left behind only
+// keeps other projects from the hostname, so failing to release one isnt returned
+func (service *IngressService) release(ctx context.Context, name string, hostnames []string) {
+	if err := service.hostService.releaseHostnames(ctx, name, hostnames); err != nil {
+		log.WithError(err).WithFields(log.Fields{"containerHost": name}).Warn("failed to release ingress hostnames")
+	}
+}
+
+// difference returns the hostnames in a that arent in b
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+
+	out := []string{}
+	for _, s := range a {
+		if !in[s] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Renew issues certificates for the TLS hostnames of every project that are missing one or whose
+// certificate is within `acme.renewBefore` of expiring
+func (service *IngressService) Renew(ctx context.Context) error {
+	metas, err := service.hostService.consul.GetProjectMetas()
+	if err != nil {
+		return err
+	}
+
+	for _, meta := range metas {
+		rules, err := service.hostService.consul.GetIngressRules(meta.ID)
+		if err != nil {
+			return err
+		}
+		if len(rules.TLSHostnames()) == 0 {
+			continue
+		}
+
+		if err := service.issue(ctx, meta.ID, rules); err != nil {
+			// one hostname that doesnt point here shouldn't stop every other project renewing
+			log.WithError(err).WithFields(log.Fields{"containerHost": meta.ID}).Warn("failed to issue ingress certificates")
+		}
+	}
+	return nil
+}
+
+// issue obtains certificates for the project's TLS hostnames that need one, then applies the
+// rules again so nginx serves them
+func (service *IngressService) issue(ctx context.Context, name string, rules ingress.Rules) error {
+	tlsStorage := service.hostService.tlsStorageRepo
+	solver := hostChallengeSolver{repo: service.hostService.repo, name: name}
+
+	var issued int
+	for _, hostname := range rules.TLSHostnames() {
+		cert, err := tlsStorage.GetCertificate(ctx, name, hostname)
+		if err != nil {
+			return err
+		}
+		if cert != nil {
+			expiry, err := CertificateExpiry(cert.CertPEM)
+			if err == nil && time.Until(expiry) > viper.GetDuration("acme.renewBefore") {
+				continue
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"containerHost": name,
+			"hostname":      hostname,
+		}).Info("issuing ingress certificate")
+
+		cert, err = service.acmeService.Obtain(ctx, hostname, solver)
+		if err != nil {
+			return fmt.Errorf("error issuing certificate for %s: %w", hostname, err)
+		}
+		if err := tlsStorage.PutCertificate(ctx, name, hostname, *cert); err != nil {
+			return err
+		}
+		issued++
+	}
+
+	if issued == 0 {
+		return nil
+	}
+	return service.Apply(ctx, name)
+}
+
+// Apply regenerates the nginx config of a project from its saved ingress rules, to pick up the
+// addresses of replaced containers
+func (service *IngressService) Apply(ctx context.Context, name string) error {
+	return service.ApplyReplacing(ctx, name, nil)
+}
+
+// ApplyReplacing is Apply with the rules of some containers proxied to other containers, by
+// container name, such as to a replacement before it takes over the container's name
+func (service *IngressService) ApplyReplacing(ctx context.Context, name string, replacements map[string]string) error {
+	rules, err := service.hostService.consul.GetIngressRules(name)
+	if err != nil || rules == nil {
+		return err
+	}
+	return service.applyReplacing(ctx, name, rules, replacements)
+}
+
+func (service *IngressService) apply(ctx context.Context, name string, rules ingress.Rules) error {
+	return service.applyReplacing(ctx, name, rules, nil)
+}
+
+func (service *IngressService) applyReplacing(ctx context.Context, name string, rules ingress.Rules, replacements map[string]string) error {
+	repo := service.hostService.repo
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	addrs := make(map[string]string)
+	for _, rule := range rules {
+		if _, ok := addrs[rule.Container]; ok {
+			continue
+		}
+
+		target := rule.Container
+		if replacement, ok := replacements[rule.Container]; ok {
+			target = replacement
+		}
+
+		ctr, err := repo.InspectContainer(ctx, host.ContainerInspectOptions{
+			ContainerName: host.ContainerName{Name: name},
+			Container:     target,
+		})
+		if err != nil {
+			return fmt.Errorf("ingress rule %s%s: %w", rule.Hostname, rule.PathOrDefault(), err)
+		}
+		if ctr.IPAddress == "" {
+			return fmt.Errorf("ingress rule %s%s: %w: %s", rule.Hostname, rule.PathOrDefault(), host.ErrContainerStopped, rule.Container)
+		}
+		addrs[rule.Container] = ctr.IPAddress
+	}
+
+	certs := make(map[string]bool)
+	for _, hostname := range rules.TLSHostnames() {
+		cert, err := service.hostService.tlsStorageRepo.GetCertificate(ctx, name, hostname)
+		if err != nil {
+			return err
+		}
+		if cert == nil {
+			continue
+		}
+		if expiry, err := CertificateExpiry(cert.CertPEM); err != nil || time.Now().After(expiry) {
+			continue
+		}
+
+		err = repo.PushIngressCert(ctx, host.IngressCertOptions{
+			ContainerName: host.ContainerName{Name: name},
+			Hostname:      hostname,
+			CertPEM:       cert.CertPEM,
+			KeyPEM:        cert.KeyPEM,
+		})
+		if err != nil {
+			return err
+		}
+		certs[hostname] = true
+	}
+
+	config, err := rules.Config(addrs, certs, ingress.HostPaths{
+		ChallengeDir: viper.GetString("nginx.challengeDir"),
+		CertDir:      viper.GetString("nginx.certDir"),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"containerHost": name,
+		"rules":         len(rules),
+	}).Info("applying ingress rules")
+
+	return repo.ApplyNginxConfig(ctx, host.NginxConfigOptions{
+		ContainerName: host.ContainerName{Name: name},
+		Config:        config,
+	})
+}
+
+// hostChallengeSolver answers ACME challenges through the nginx in a project's container host
+type hostChallengeSolver struct {
+	repo host.ContainerHostRepository
+	name string
+}
+
+func (s hostChallengeSolver) Present(ctx context.Context, token, keyAuth string) error {
+	return s.repo.PutACMEChallenge(ctx, host.ACMEChallengeOptions{
+		ContainerName: host.ContainerName{Name: s.name},
+		Token:         token,
+		KeyAuth:       keyAuth,
+	})
+}
+
+func (s hostChallengeSolver) CleanUp(ctx context.Context, token string) error {
+	return s.repo.DeleteACMEChallenge(ctx, host.ACMEChallengeOptions{
+		ContainerName: host.ContainerName{Name: s.name},
+		Token:         token,
+	})
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/migration"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
+)
+
+var (
+	ErrSameWorker = errors.New("project is already on the target worker")
+)
+
+// MigrationService moves project container hosts between workers using LXD's migration API.
+// The source worker sets up the migration and hands it to the target worker, which pulls the
+// host, re-issues its server cert for the new IP and registers the project. The source then
+// deregisters the project and deletes its copy of the host.
+type MigrationService struct {
+	hostService     *ContainerHostService
+	snapshotService *SnapshotService
+	client          *http.Client
+}
+
+func NewMigrationService(hostService *ContainerHostService, snapshotService *SnapshotService) *MigrationService {
+	return &MigrationService{
+		hostService:     hostService,
+		snapshotService: snapshotService,
+		client:          new(http.Client),
+	}
+}
+
+// Migrate moves a project's container host from this worker to the worker in req
+func (service *MigrationService) Migrate(ctx context.Context, name string, req migration.Request) (*providers.ProjectMeta, error) {
+	if req.Worker == viper.GetString("http.hostname") {
+		return nil, ErrSameWorker
+	}
+
+	meta, err := service.hostService.consul.GetProjectMeta(name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting project metadata: %w", err)
+	}
+	if meta == nil {
+		return nil, ErrProjectNotRegistered
+	}
+
+	target, err := service.hostService.consul.GetWorkerAddress(req.Worker)
+	if err != nil {
+		return nil, fmt.Errorf("error finding worker %s: %w", req.Worker, err)
+	}
+
+	fields := log.Fields{
+		"containerHost": name,
+		"worker":        req.Worker,
+		"live":          req.Live,
+	}
+	log.WithFields(fields).Info("migrating container host")
+
+	defer service.hostService.ops.begin(name)()
+
+	var moved providers.ProjectMeta
+	err = service.hostService.repo.MigrateContainerHost(ctx, host.ContainerHostMigrateOptions{
+		ContainerName: host.ContainerName{Name: name},
+		Live:          req.Live,
+	}, func(source migration.Source) error {
+		return service.sendToWorker(ctx, target, migration.Incoming{
+			Host:      name,
+			Placement: req.Placement,
+			Source:    source,
+		}, &moved)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error migrating host: %w", err)
+	}
+
+	log.WithFields(fields).Info("container host migrated, cleaning up")
+
+	// the project now lives on the target worker, failures from here on only leave clutter behind
+	if err := service.hostService.consul.DeregisterProject(name); err != nil {
+		log.WithError(err).WithFields(fields).Error("failed to deregister migrated project")
+	}
+	service.snapshotService.unschedule(name)
+
+	if err := service.hostService.discardHost(ctx, name); err != nil {
+		log.WithError(err).WithFields(fields).Error("failed to delete migrated container host")
+	}
+
+	return &moved, nil
+}
+
+// sendToWorker asks the target worker to pull the host from the migration source
+func (service *MigrationService) sendToWorker(ctx context.Context, target string, incoming migration.Incoming, meta *providers.ProjectMeta) error {
+	body, err := json.Marshal(incoming)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target+"/v1/migrations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Auth-Token", viper.GetString("windlass.secret"))
+
+	resp, err := service.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error contacting target worker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Content json.RawMessage `json:"content"`
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		var msg string
+		if json.NewDecoder(resp.Body).Decode(&result) != nil || json.Unmarshal(result.Content, &msg) != nil {
+			msg = resp.Status
+		}
+		return fmt.Errorf("target worker failed to receive host: %s", msg)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error decoding target worker response: %w", err)
+	}
+
+	return json.Unmarshal(result.Content, meta)
+}
+
+// Receive pulls a container host from a migration source on another worker and adopts it,
+// taking over its TLS material from Vault and registering the project with this worker.
+// If the host cant be adopted it is deleted again, leaving the source to restore its copy.
+func (service *MigrationService) Receive(ctx context.Context, incoming migration.Incoming) (*providers.ProjectMeta, error) {
+	name := incoming.Host
+
+	exists, err := service.hostService.repo.HostExists(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, host.ErrHostExists
+	}
+
+	pems, err := service.hostService.tlsStorageRepo.GetAuthCerts(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting TLS certs from storage: %w", err)
+	}
+
+	fields := log.Fields{
+		"containerHost": name,
+	}
+	log.WithFields(fields).Info("receiving migrated container host")
+
+	defer service.hostService.ops.begin(name)()
+
+	if err := service.hostService.repo.ReceiveContainerHost(ctx, host.ContainerHostReceiveOptions{
+		ContainerName: host.ContainerName{Name: name},
+		Remote:        incoming.Placement.Remote,
+		Target:        incoming.Placement.Target,
+		Source:        incoming.Source,
+	}); err != nil {
+		return nil, err
+	}
+
+	ip, err := service.hostService.adoptHost(ctx, name, pems)
+	if err != nil {
+		log.WithError(err).WithFields(fields).Error("failed to adopt migrated container host, deleting it")
+
+		if err := service.hostService.consul.DeregisterProject(name); err != nil {
+			log.WithError(err).WithFields(fields).Error("failed to deregister project")
+		}
+		// the request may have timed out, which is likely why adopting failed
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := service.hostService.discardHost(ctx, name); err != nil {
+			log.WithError(err).WithFields(fields).Error("failed to delete container host")
+		}
+		return nil, err
+	}
+
+	// snapshot policies follow the project, but are only scheduled by the worker it is registered to
+	if err := service.snapshotService.SyncSchedules(); err != nil {
+		log.WithError(err).WithFields(fields).Error("failed to sync snapshot policies")
+	}
+
+	return &providers.ProjectMeta{ID: name, IP: ip}, nil
+}
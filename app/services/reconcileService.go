@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/viper"
+	cron "gopkg.in/robfig/cron.v2"
+)
+
+// Kinds of drift between LXD, Consul and Vault
+const (
+	// A windlass container host with no project metadata on any worker
+	DriftHostWithoutMetadata = "host_without_metadata"
+	// Project metadata on this worker with no container host
+	DriftMetadataWithoutHost = "metadata_without_host"
+	// A project on this worker with no TLS certs in storage
+	DriftMissingCerts = "missing_certs"
+	// A project on this worker with no Consul service
+	DriftMissingService = "missing_service"
+	// A Consul service registered by this worker with no project metadata
+	DriftServiceWithoutMetadata = "service_without_metadata"
+)
+
+var driftKinds = []string{
+	DriftHostWithoutMetadata, DriftMetadataWithoutHost, DriftMissingCerts, DriftMissingService, DriftServiceWithoutMetadata,
+}
+
+var (
+	errNoCerts  = errors.New("no TLS certs in storage to adopt the host with")
+	errHostBusy = errors.New("host has a create, import or migration in progress")
+)
+
+var (
+	driftGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "windlass_drift",
+		Help: "Drift between LXD, Consul and Vault found by the last reconcile",
+	}, []string{"kind"})
+	driftFixed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "windlass_drift_fixed_total",
+		Help: "Drift fixed by the reconciler",
+	}, []string{"kind"})
+	reconcileLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "windlass_reconcile_last_run_timestamp_seconds",
+		Help: "When the reconciler last ran successfully",
+	})
+)
+
+// Drift is a single inconsistency between LXD, Consul and Vault
+type Drift struct {
+	Kind  string `json:"kind"`
+	Host  string `json:"host"`
+	Fixed bool   `json:"fixed"`
+	Error string `json:"error,omitempty"`
+}
+
+// DriftReport is the result of a reconcile
+type DriftReport struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Drift     []Drift   `json:"drift"`
+}
+
+// ReconcileService compares the container hosts in LXD with the project metadata and services in
+// Consul and the certs in Vault, reporting drift and, if `reconcile.autoFix` is set, fixing it
+type ReconcileService struct {
+	hostService *ContainerHostService
+	cron        *cron.Cron
+
+	// held for a whole reconcile, so that runs dont overlap
+	mu *sync.Mutex
+
+	lastMu *sync.Mutex
+	last   *DriftReport
+}
+
+func NewReconcileService(hostService *ContainerHostService) *ReconcileService {
+	return &ReconcileService{
+		hostService: hostService,
+		cron:        cron.New(),
+		mu:          new(sync.Mutex),
+		lastMu:      new(sync.Mutex),
+	}
+}
+
+// StartSchedule schedules reconciles according to `reconcile.schedule`
+func (service *ReconcileService) StartSchedule() error {
+	schedule := viper.GetString("reconcile.schedule")
+	if schedule == "" {
+		return nil
+	}
+
+	_, err := service.cron.AddFunc(schedule, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("reconcile.timeout"))
+		defer cancel()
+
+		if _, err := service.Reconcile(ctx, viper.GetBool("reconcile.autoFix")); err != nil {
+			log.WithError(err).Error("scheduled reconcile failed")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	service.cron.Start()
+	return nil
+}
+
+// LastReport returns the report of the last reconcile, or nil if none has run yet
+func (service *ReconcileService) LastReport() *DriftReport {
+	service.lastMu.Lock()
+	defer service.lastMu.Unlock()
+	return service.last
+}
+
+// Reconcile looks for drift and fixes it if fix is set. Only one reconcile runs at a time.
+func (service *ReconcileService) Reconcile(ctx context.Context, fix bool) (*DriftReport, error) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	drift, err := service.findDrift(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if fix {
+		for i := range drift {
+			if err := service.fix(ctx, drift[i]); err != nil {
+				drift[i].Error = err.Error()
+				continue
+			}
+			drift[i].Fixed = true
+			driftFixed.WithLabelValues(drift[i].Kind).Inc()
+		}
+	}
+
+	counts := make(map[string]int, len(driftKinds))
+	for _, d := range drift {
+		if !d.Fixed {
+			counts[d.Kind]++
+		}
+
+		log.WithFields(log.Fields{
+			"kind":          d.Kind,
+			"containerHost": d.Host,
+			"fixed":         d.Fixed,
+			"fixError":      d.Error,
+		}).Warn("drift found")
+	}
+	for _, kind := range driftKinds {
+		driftGauge.WithLabelValues(kind).Set(float64(counts[kind]))
+	}
+
+	report := &DriftReport{
+		CheckedAt: time.Now(),
+		Drift:     drift,
+	}
+	service.lastMu.Lock()
+	service.last = report
+	service.lastMu.Unlock()
+	reconcileLastRun.SetToCurrentTime()
+
+	return report, nil
+}
+
+func (service *ReconcileService) findDrift(ctx context.Context) ([]Drift, error) {
+	consul := service.hostService.consul
+
+	hostList, err := service.hostService.repo.ListContainerHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metaList, err := consul.GetProjectMetas()
+	if err != nil {
+		return nil, err
+	}
+
+	owners, err := consul.GetProjectOwners()
+	if err != nil {
+		return nil, err
+	}
+
+	serviceList, err := consul.GetProjectServices()
+	if err != nil {
+		return nil, err
+	}
+
+	certList, err := service.hostService.tlsStorageRepo.ListAuthCerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, services, certs := toSet(hostList), toSet(serviceList), toSet(certList)
+	metas := make(map[string]bool, len(metaList))
+	for _, meta := range metaList {
+		metas[meta.ID] = true
+	}
+
+	drift := make([]Drift, 0)
+
+	for _, name := range hostList {
+		if !metas[name] {
+			// LXD remotes may be shared between workers, the host could be another worker's
+			if _, ok := owners[name]; !ok {
+				drift = append(drift, Drift{Kind: DriftHostWithoutMetadata, Host: name})
+			}
+			continue
+		}
+
+		if !certs[name] {
+			drift = append(drift, Drift{Kind: DriftMissingCerts, Host: name})
+		}
+		if !services[name] {
+			drift = append(drift, Drift{Kind: DriftMissingService, Host: name})
+		}
+	}
+
+	for _, meta := range metaList {
+		if !hosts[meta.ID] {
+			drift = append(drift, Drift{Kind: DriftMetadataWithoutHost, Host: meta.ID})
+		}
+	}
+
+	for _, name := range serviceList {
+		if !metas[name] {
+			drift = append(drift, Drift{Kind: DriftServiceWithoutMetadata, Host: name})
+		}
+	}
+
+	return drift, nil
+}
+
+// fix resolves a single drift. Hosts are never deleted: a host without metadata is adopted if
+// its certs are still stored, and lost certs are replaced by re-keying the host.
+func (service *ReconcileService) fix(ctx context.Context, drift Drift) error {
+	hostService := service.hostService
+
+	// drift on a host that is still being set up is likely just the setup not having finished
+	done, ok := hostService.ops.tryBegin(drift.Host)
+	if !ok {
+		return errHostBusy
+	}
+	defer done()
+
+	switch drift.Kind {
+	case DriftHostWithoutMetadata:
+		pems, err := hostService.tlsStorageRepo.GetAuthCerts(ctx, drift.Host)
+		if err != nil {
+			return errNoCerts
+		}
+		_, err = hostService.adoptHost(ctx, drift.Host, pems)
+		return err
+	case DriftMissingCerts:
+		return hostService.rekeyHost(ctx, drift.Host)
+	case DriftMissingService:
+		return hostService.reregisterHost(ctx, drift.Host)
+	case DriftMetadataWithoutHost, DriftServiceWithoutMetadata:
+		return hostService.consul.DeregisterProject(drift.Host)
+	}
+	return nil
+}
+
+func toSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, item := range list {
+		set[item] = true
+	}
+	return set
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/registry"
+	registryauth "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/registryAuth"
+)
+
+// RegistryService manages the private registry credentials of namespaces
+type RegistryService struct {
+	repo registryauth.RegistryAuthRepo
+}
+
+func NewRegistryService() *RegistryService {
+	return &RegistryService{
+		repo: registryauth.NewRegistryAuthRepo(),
+	}
+}
+
+func (service *RegistryService) ListRegistries(ctx context.Context, namespace string) ([]string, error) {
+	return service.repo.ListRegistries(ctx, namespace)
+}
+
+func (service *RegistryService) SetCredential(ctx context.Context, namespace string, cred registry.Credential) error {
+	cred.Registry = container.NormalizeRegistry(cred.Registry)
+	return service.repo.PutCredential(ctx, namespace, cred)
+}
+
+func (service *RegistryService) DeleteCredential(ctx context.Context, namespace, registryHost string) error {
+	return service.repo.DeleteCredential(ctx, namespace, container.NormalizeRegistry(registryHost))
+}
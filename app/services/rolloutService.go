@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/helpers"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/container"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+)
+
+var (
+	ErrRolloutFailed     = errors.New("replacement container never became ready, rolled back")
+	ErrRolloutInProgress = errors.New("container already has a rollout in progress")
+	// the new container is serving under the container's name, but nginx may not be proxying to it
+	ErrRolloutIngress = errors.New("rolled out, but failed to point ingress at the new container")
+)
+
+// Suffixes of the temporary containers of a rollout
+const (
+	rolloutNextSuffix = "-next"
+	rolloutPrevSuffix = "-prev"
+)
+
+// RolloutService moves containers to new images without taking them down for longer than it
+// takes to swap their host ports over
+type RolloutService struct {
+	hostService    *ContainerHostService
+	ingressService *IngressService
+
+	mu *sync.Mutex
+	// containers with a rollout in progress, by container host and container name
+	active map[string]bool
+}
+
+func NewRolloutService(hostService *ContainerHostService, ingressService *IngressService) *RolloutService {
+	return &RolloutService{
+		hostService:    hostService,
+		ingressService: ingressService,
+		mu:             new(sync.Mutex),
+		active:         make(map[string]bool),
+	}
+}
+
+// begin marks a container as having a rollout in progress until the returned func is called, as
+// two rollouts of a container would trip over each other's temporary containers
+func (service *RolloutService) begin(name, ctrName string) (func(), error) {
+	key := name + "/" + ctrName
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if service.active[key] {
+		return nil, ErrRolloutInProgress
+	}
+	service.active[key] = true
+
+	return func() {
+		service.mu.Lock()
+		defer service.mu.Unlock()
+		delete(service.active, key)
+	}, nil
+}
+
+// Rollout moves a container to a new image. A replacement is started next to the container
+// without its host ports and must become healthy, or accept TCP connections on its first port if it
+// has no healthcheck. The replacement is then given the container's network alias. A container
+// without host ports is then removed and the replacement takes its name. One with host ports is
+// recreated from the new image with its ports, started once the old one has stopped and gated on
+// readiness again, while other containers are served by the replacement. Any failure before the
+// new container is serving under the container's name restores the original container. If nginx
+// then cant be pointed at the new container ErrRolloutIngress is returned, as ingress is stale.
+func (service *RolloutService) Rollout(ctx context.Context, proj project.Project, ctrName string, req container.RolloutRequest) (err error) {
+	repo := service.hostService.repo
+	name := proj.HostName()
+	containerName := host.ContainerName{Name: name}
+	next, prev := ctrName+rolloutNextSuffix, ctrName+rolloutPrevSuffix
+
+	end, err := service.begin(name, ctrName)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	if err := service.recoverPrev(ctx, name, ctrName); err != nil {
+		return err
+	}
+
+	current, err := repo.InspectContainer(ctx, host.ContainerInspectOptions{ContainerName: containerName, Container: ctrName})
+	if err != nil {
+		return err
+	}
+
+	image, err := req.Resolve(current.Image)
+	if err != nil {
+		return err
+	}
+
+	fields := log.Fields{
+		"containerHost": name,
+		"container":     ctrName,
+		"image":         image,
+	}
+	log.WithFields(fields).Info("rolling out new image")
+
+	rollback := helpers.NewRollback(fields)
+	defer func() {
+		if err != nil && !errors.Is(err, ErrRolloutIngress) {
+			log.WithError(err).WithFields(fields).Warn("rollout failed, rolling back")
+			if rollbackErr := rollback.Run(); rollbackErr != nil {
+				err = fmt.Errorf("%w (restoring the original container failed: %v)", err, rollbackErr)
+			}
+		}
+	}()
+
+	auth, err := service.hostService.registryAuth(ctx, proj.Namespace, image)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.PullImage(ctx, host.ImagePullOptions{ContainerName: containerName, Image: image, RegistryAuth: auth}); err != nil {
+		return err
+	}
+
+	// left over from an earlier rollout that was interrupted
+	for _, leftover := range []string{next, prev} {
+		if err := repo.RemoveContainer(ctx, host.ContainerRemoveOptions{ContainerName: containerName, Container: leftover}); err != nil {
+			return err
+		}
+	}
+
+	if err := repo.CloneContainer(ctx, host.ContainerCloneOptions{
+		ContainerName: containerName,
+		Container:     ctrName,
+		As:            next,
+		Image:         image,
+		Unpublished:   true,
+	}); err != nil {
+		return err
+	}
+	rollback.Add("start replacement", func(ctx context.Context) error {
+		return repo.RemoveContainer(ctx, host.ContainerRemoveOptions{ContainerName: containerName, Container: next})
+	})
+
+	var probePort uint16
+	if !current.Healthcheck {
+		for _, port := range current.Ports {
+			if port.Proto() == "tcp" {
+				probePort = port.ContainerPort
+				break
+			}
+		}
+	}
+
+	if err := service.waitReady(ctx, name, next, probePort); err != nil {
+		return err
+	}
+
+	// nginx proxies to containers by address, so it is pointed at the replacement before the
+	// original goes anywhere, and back at the original if the rollout is rolled back
+	if ingressErr := service.ingressService.ApplyReplacing(ctx, name, map[string]string{ctrName: next}); ingressErr != nil {
+		log.WithError(ingressErr).WithFields(fields).Error("failed to point ingress at replacement")
+	}
+	rollback.Add("point ingress at replacement", func(ctx context.Context) error {
+		return service.ingressService.Apply(ctx, name)
+	})
+
+	// other containers reach the container by its alias, which the replacement now shares
+	if err := repo.SetContainerAlias(ctx, host.ContainerAliasOptions{ContainerName: containerName, Container: next, Alias: ctrName}); err != nil {
+		return err
+	}
+
+	if err := repo.RenameContainer(ctx, host.ContainerRenameOptions{ContainerName: containerName, Container: ctrName, NewName: prev}); err != nil {
+		return err
+	}
+	rollback.Add("rename old container", func(ctx context.Context) error {
+		return repo.RenameContainer(ctx, host.ContainerRenameOptions{ContainerName: containerName, Container: prev, NewName: ctrName})
+	})
+
+	if len(current.Ports) == 0 {
+		if err := repo.RenameContainer(ctx, host.ContainerRenameOptions{ContainerName: containerName, Container: next, NewName: ctrName}); err != nil {
+			return err
+		}
+
+		// the replacement is serving under the container's name, so nothing is rolled back from here.
+		// nginx is pointed at it again in case a start event re-applied the rules in the meantime
+		if ingressErr := service.ingressService.Apply(ctx, name); ingressErr != nil {
+			// nginx may still be proxying to the old container, so it is left for the next rollout
+			log.WithError(ingressErr).WithFields(fields).Error("failed to point ingress at new container, keeping the old container running")
+			return fmt.Errorf("%w: %v", ErrRolloutIngress, ingressErr)
+		}
+		service.removeOld(ctx, name, fields, prev)
+		return nil
+	}
+
+	// created up front so that the container is only down between the old one stopping and it starting
+	err = repo.CloneContainer(ctx, host.ContainerCloneOptions{
+		ContainerName: containerName,
+		Container:     prev,
+		As:            ctrName,
+		Image:         image,
+		Alias:         ctrName,
+		CreateOnly:    true,
+	})
+	// registered even if the clone failed, as it may have been created
+	rollback.Add("create new container", func(ctx context.Context) error {
+		return repo.RemoveContainer(ctx, host.ContainerRemoveOptions{ContainerName: containerName, Container: ctrName})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := repo.StopContainer(ctx, host.ContainerStopOptions{ContainerName: containerName, Container: prev}); err != nil {
+		return err
+	}
+	rollback.Add("stop old container", func(ctx context.Context) error {
+		return repo.StartContainer(ctx, host.ContainerStartOptions{ContainerName: containerName, Container: prev})
+	})
+
+	if err := repo.StartContainer(ctx, host.ContainerStartOptions{ContainerName: containerName, Container: ctrName}); err != nil {
+		return err
+	}
+
+	if err := service.waitReady(ctx, name, ctrName, probePort); err != nil {
+		return err
+	}
+
+	// the replacement keeps serving ingress until nginx has been pointed at the new container
+	if ingressErr := service.ingressService.Apply(ctx, name); ingressErr != nil {
+		log.WithError(ingressErr).WithFields(fields).Error("failed to point ingress at new container, keeping the replacement running")
+		service.removeOld(ctx, name, fields, prev)
+		return fmt.Errorf("%w: %v", ErrRolloutIngress, ingressErr)
+	}
+
+	service.removeOld(ctx, name, fields, prev, next)
+	return nil
+}
+
+// recoverPrev puts back a container left renamed by an earlier rollout that was interrupted
+// before its replacement took the container's name
+func (service *RolloutService) recoverPrev(ctx context.Context, name, ctrName string) error {
+	repo := service.hostService.repo
+	containerName := host.ContainerName{Name: name}
+	prev := ctrName + rolloutPrevSuffix
+
+	_, err := repo.InspectContainer(ctx, host.ContainerInspectOptions{ContainerName: containerName, Container: ctrName})
+	if !errors.Is(err, host.ErrContainerNotFound) {
+		return nil
+	}
+	if _, err := repo.InspectContainer(ctx, host.ContainerInspectOptions{ContainerName: containerName, Container: prev}); err != nil {
+		return nil
+	}
+	return repo.RenameContainer(ctx, host.ContainerRenameOptions{ContainerName: containerName, Container: prev, NewName: ctrName})
+}
+
+// removeOld removes the containers a rollout has finished with. Failing to only leaves them behind
+// until the next rollout of the container
+func (service *RolloutService) removeOld(ctx context.Context, name string, fields log.Fields, containers ...string) {
+	for _, old := range containers {
+		if err := service.hostService.repo.RemoveContainer(ctx, host.ContainerRemoveOptions{ContainerName: host.ContainerName{Name: name}, Container: old}); err != nil {
+			log.WithError(err).WithFields(fields).WithFields(log.Fields{"oldContainer": old}).Warn("failed to remove old container")
+		}
+	}
+}
+
+func (service *RolloutService) waitReady(ctx context.Context, name, ctrName string, probePort uint16) error {
+	waitCtx, cancel := context.WithTimeout(ctx, viper.GetDuration("docker.rolloutTimeout"))
+	defer cancel()
+
+	if err := service.hostService.repo.WaitForContainer(waitCtx, host.ContainerWaitOptions{
+		ContainerName: host.ContainerName{Name: name},
+		Container:     ctrName,
+		ProbePort:     probePort,
+	}); err != nil {
+		return fmt.Errorf("%w: %v", ErrRolloutFailed, err)
+	}
+	return nil
+}
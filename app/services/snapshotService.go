@@ -0,0 +1,240 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/spf13/viper"
+	cron "gopkg.in/robfig/cron.v2"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/snapshot"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
+)
+
+// SnapshotService manages snapshots of project container hosts and runs each
+// project's scheduled snapshot policy
+type SnapshotService struct {
+	repo   host.ContainerHostRepository
+	consul *providers.ConsulProvider
+	cron   *cron.Cron
+
+	mu        *sync.Mutex
+	schedules map[string]cron.EntryID
+}
+
+func NewSnapshotService(hostService *ContainerHostService) *SnapshotService {
+	return &SnapshotService{
+		repo:      hostService.repo,
+		consul:    hostService.consul,
+		cron:      cron.New(),
+		mu:        new(sync.Mutex),
+		schedules: make(map[string]cron.EntryID),
+	}
+}
+
+func (service *SnapshotService) CreateSnapshot(ctx context.Context, name string, req snapshot.CreateRequest) error {
+	return service.repo.CreateSnapshot(ctx, host.SnapshotCreateOptions{
+		SnapshotOptions: host.SnapshotOptions{ContainerName: host.ContainerName{Name: name}, Snapshot: req.Name},
+		Stateful:        req.Stateful,
+	})
+}
+
+func (service *SnapshotService) ListSnapshots(ctx context.Context, name string) ([]snapshot.Snapshot, error) {
+	return service.repo.ListSnapshots(ctx, name)
+}
+
+func (service *SnapshotService) DeleteSnapshot(ctx context.Context, name, snapshotName string) error {
+	return service.repo.DeleteSnapshot(ctx, host.SnapshotOptions{ContainerName: host.ContainerName{Name: name}, Snapshot: snapshotName})
+}
+
+func (service *SnapshotService) RestoreSnapshot(ctx context.Context, name, snapshotName string, req snapshot.RestoreRequest) error {
+	log.WithFields(log.Fields{
+		"containerHost": name,
+		"snapshot":      snapshotName,
+	}).Info("restoring container host snapshot")
+
+	return service.repo.RestoreSnapshot(ctx, host.SnapshotRestoreOptions{
+		SnapshotOptions: host.SnapshotOptions{ContainerName: host.ContainerName{Name: name}, Snapshot: snapshotName},
+		Stateful:        req.Stateful,
+	})
+}
+
+// GetPolicy returns the snapshot policy for a project, or nil if it has none
+func (service *SnapshotService) GetPolicy(name string) (*snapshot.Policy, error) {
+	return service.consul.GetSnapshotPolicy(name)
+}
+
+// SetPolicy stores the snapshot policy for a project on this worker and (re)schedules it
+func (service *SnapshotService) SetPolicy(name string, policy snapshot.Policy) error {
+	meta, err := service.consul.GetProjectMeta(name)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return host.ErrHostNotFound
+	}
+
+	if err := service.consul.SaveSnapshotPolicy(name, policy); err != nil {
+		return err
+	}
+	return service.schedule(name, policy)
+}
+
+func (service *SnapshotService) DeletePolicy(name string) error {
+	service.unschedule(name)
+	return service.consul.DeleteSnapshotPolicy(name)
+}
+
+// StartSchedules schedules the snapshot policies of the projects on this worker. Policies are
+// stored per project so that they follow it to whichever worker it is moved to, but only the
+// worker it is registered to takes its snapshots
+func (service *SnapshotService) StartSchedules() error {
+	if err := service.SyncSchedules(); err != nil {
+		return err
+	}
+
+	service.cron.Start()
+	return nil
+}
+
+// SyncSchedules reloads the snapshot policies of the projects on this worker from Consul, and
+// unschedules those of projects that have left it
+func (service *SnapshotService) SyncSchedules() error {
+	policies, err := service.consul.GetSnapshotPolicies()
+	if err != nil {
+		return err
+	}
+
+	metas, err := service.consul.GetProjectMetas()
+	if err != nil {
+		return err
+	}
+	owned := make(map[string]bool, len(metas))
+	for _, meta := range metas {
+		owned[meta.ID] = true
+	}
+
+	service.mu.Lock()
+	var gone []string
+	for name := range service.schedules {
+		if _, ok := policies[name]; !ok || !owned[name] {
+			gone = append(gone, name)
+		}
+	}
+	service.mu.Unlock()
+	for _, name := range gone {
+		service.unschedule(name)
+	}
+
+	for name, policy := range policies {
+		if !owned[name] {
+			continue
+		}
+		if err := service.schedule(name, policy); err != nil {
+			log.WithError(err).WithFields(log.Fields{
+				"containerHost": name,
+			}).Error("failed to schedule snapshot policy")
+		}
+	}
+	return nil
+}
+
+func (service *SnapshotService) schedule(name string, policy snapshot.Policy) error {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if id, ok := service.schedules[name]; ok {
+		service.cron.Remove(id)
+	}
+
+	id, err := service.cron.AddFunc(policy.Schedule, func() {
+		service.runPolicy(name, policy)
+	})
+	if err != nil {
+		return err
+	}
+
+	service.schedules[name] = id
+	return nil
+}
+
+func (service *SnapshotService) unschedule(name string) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+
+	if id, ok := service.schedules[name]; ok {
+		service.cron.Remove(id)
+		delete(service.schedules, name)
+	}
+}
+
+// runPolicy takes a scheduled snapshot and then prunes scheduled snapshots beyond the retention count
+func (service *SnapshotService) runPolicy(name string, policy snapshot.Policy) {
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("lxd.snapshot.timeout"))
+	defer cancel()
+
+	fields := log.Fields{
+		"containerHost": name,
+	}
+
+	// the project may have moved to another worker since it was scheduled
+	meta, err := service.consul.GetProjectMeta(name)
+	if err != nil {
+		log.WithError(err).WithFields(fields).Error("failed to check project owner for scheduled snapshot")
+		return
+	}
+	if meta == nil {
+		log.WithFields(fields).Debug("skipping scheduled snapshot for project not on this worker")
+		service.unschedule(name)
+		return
+	}
+
+	snapName := snapshot.ScheduledPrefix + time.Now().UTC().Format("20060102-150405")
+	err = service.repo.CreateSnapshot(ctx, host.SnapshotCreateOptions{
+		SnapshotOptions: host.SnapshotOptions{ContainerName: host.ContainerName{Name: name}, Snapshot: snapName},
+		Stateful:        policy.Stateful,
+	})
+	if err == host.ErrHostNotFound {
+		log.WithFields(fields).Debug("skipping scheduled snapshot for host not on this worker")
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithFields(fields).Error("scheduled snapshot failed")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"containerHost": name,
+		"snapshot":      snapName,
+	}).Info("took scheduled snapshot")
+
+	snapshots, err := service.repo.ListSnapshots(ctx, name)
+	if err != nil {
+		log.WithError(err).WithFields(fields).Error("failed to list snapshots for pruning")
+		return
+	}
+
+	var scheduled []snapshot.Snapshot
+	for _, snap := range snapshots {
+		if strings.HasPrefix(snap.Name, snapshot.ScheduledPrefix) {
+			scheduled = append(scheduled, snap)
+		}
+	}
+
+	sort.Slice(scheduled, func(i, j int) bool {
+		return scheduled[i].CreatedAt.After(scheduled[j].CreatedAt)
+	})
+
+	for i := policy.Retain; i < len(scheduled); i++ {
+		if err := service.DeleteSnapshot(ctx, name, scheduled[i].Name); err != nil {
+			log.WithError(err).WithFields(fields).WithFields(log.Fields{
+				"snapshot": scheduled[i].Name,
+			}).Error("failed to prune scheduled snapshot")
+		}
+	}
+}
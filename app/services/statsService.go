@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Strum355/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	cron "gopkg.in/robfig/cron.v2"
+
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+)
+
+var (
+	hostLabels      = []string{"namespace", "project"}
+	hostIfaceLabels = []string{"namespace", "project", "interface"}
+	containerLabels = []string{"namespace", "project", "container"}
+)
+
+func statsDesc(name, help string, labels []string) *prometheus.Desc {
+	return prometheus.NewDesc(name, help, labels, nil)
+}
+
+// Usage that only grows while a host or container runs, such as CPU time and bytes transferred,
+// is exported as counters, the rest as gauges
+var (
+	hostCPUSeconds  = statsDesc("windlass_host_cpu_seconds_total", "CPU time used by a container host since it started", hostLabels)
+	hostMemoryBytes = statsDesc("windlass_host_memory_bytes", "Memory used by a container host", hostLabels)
+	hostSwapBytes   = statsDesc("windlass_host_swap_bytes", "Swap used by a container host", hostLabels)
+	hostDiskBytes   = statsDesc("windlass_host_disk_bytes", "Disk used by a container host across its disk devices", hostLabels)
+	hostProcesses   = statsDesc("windlass_host_processes", "Processes running in a container host", hostLabels)
+	hostRxBytes     = statsDesc("windlass_host_network_receive_bytes_total", "Bytes received by a container host since it started", hostIfaceLabels)
+	hostTxBytes     = statsDesc("windlass_host_network_transmit_bytes_total", "Bytes sent by a container host since it started", hostIfaceLabels)
+
+	containerCPUPercent       = statsDesc("windlass_container_cpu_percent", "CPU usage of a container, 100 per fully used core", containerLabels)
+	containerCPUSeconds       = statsDesc("windlass_container_cpu_seconds_total", "CPU time used by a container since it started", containerLabels)
+	containerMemoryBytes      = statsDesc("windlass_container_memory_bytes", "Memory used by a container, excluding the page cache", containerLabels)
+	containerMemoryLimitBytes = statsDesc("windlass_container_memory_limit_bytes", "Memory limit of a container", containerLabels)
+	containerBlockReadBytes   = statsDesc("windlass_container_block_read_bytes_total", "Bytes read from block devices by a container since it started", containerLabels)
+	containerBlockWriteBytes  = statsDesc("windlass_container_block_write_bytes_total", "Bytes written to block devices by a container since it started", containerLabels)
+	containerPIDs             = statsDesc("windlass_container_pids", "Processes running in a container", containerLabels)
+	containerRxBytes          = statsDesc("windlass_container_network_receive_bytes_total", "Bytes received by a container since it started", containerLabels)
+	containerTxBytes          = statsDesc("windlass_container_network_transmit_bytes_total", "Bytes sent by a container since it started", containerLabels)
+
+	statsDescs = []*prometheus.Desc{
+		hostCPUSeconds, hostMemoryBytes, hostSwapBytes, hostDiskBytes, hostProcesses, hostRxBytes, hostTxBytes,
+		containerCPUPercent, containerCPUSeconds, containerMemoryBytes, containerMemoryLimitBytes,
+		containerBlockReadBytes, containerBlockWriteBytes, containerPIDs, containerRxBytes, containerTxBytes,
+	}
+
+	exportedStats = newStatsCollector()
+)
+
+// statsCollector exports the stats collected by the last Export. Only the projects and containers
+// in it are exported, so deleted ones stop being exported
+type statsCollector struct {
+	mu    *sync.Mutex
+	stats []*ProjectStats
+}
+
+func newStatsCollector() *statsCollector {
+	collector := &statsCollector{mu: new(sync.Mutex)}
+	prometheus.MustRegister(collector)
+	return collector
+}
+
+func (c *statsCollector) set(stats []*ProjectStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats = stats
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range statsDescs {
+		ch <- desc
+	}
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counter := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, labels...)
+	}
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	for _, stats := range c.stats {
+		ns, proj := stats.Host.Namespace, stats.Host.Project
+
+		counter(hostCPUSeconds, stats.Host.CPUSeconds, ns, proj)
+		gauge(hostMemoryBytes, float64(stats.Host.MemoryBytes), ns, proj)
+		gauge(hostSwapBytes, float64(stats.Host.SwapBytes), ns, proj)
+		gauge(hostProcesses, float64(stats.Host.Processes), ns, proj)
+
+		var disk int64
+		for _, usage := range stats.Host.DiskBytes {
+			disk += usage
+		}
+		gauge(hostDiskBytes, float64(disk), ns, proj)
+
+		for iface, counters := range stats.Host.Network {
+			counter(hostRxBytes, float64(counters.RxBytes), ns, proj, iface)
+			counter(hostTxBytes, float64(counters.TxBytes), ns, proj, iface)
+		}
+
+		for _, ctr := range stats.Containers {
+			gauge(containerCPUPercent, ctr.CPUPercent, ns, proj, ctr.Name)
+			counter(containerCPUSeconds, ctr.CPUSeconds, ns, proj, ctr.Name)
+			gauge(containerMemoryBytes, float64(ctr.MemoryBytes), ns, proj, ctr.Name)
+			gauge(containerMemoryLimitBytes, float64(ctr.MemoryLimitBytes), ns, proj, ctr.Name)
+			counter(containerBlockReadBytes, float64(ctr.BlockReadBytes), ns, proj, ctr.Name)
+			counter(containerBlockWriteBytes, float64(ctr.BlockWriteBytes), ns, proj, ctr.Name)
+			gauge(containerPIDs, float64(ctr.PIDs), ns, proj, ctr.Name)
+			counter(containerRxBytes, float64(ctr.Network.RxBytes), ns, proj, ctr.Name)
+			counter(containerTxBytes, float64(ctr.Network.TxBytes), ns, proj, ctr.Name)
+		}
+	}
+}
+
+// ProjectStats is the resource usage of a project's container host and its containers
+type ProjectStats struct {
+	Host       *host.HostStats       `json:"host"`
+	Containers []host.ContainerStats `json:"containers"`
+}
+
+// StatsService reports the resource usage of projects, and exports it for every project on this
+// worker to Prometheus every `stats.schedule`
+type StatsService struct {
+	hostService *ContainerHostService
+	cron        *cron.Cron
+}
+
+func NewStatsService(hostService *ContainerHostService) *StatsService {
+	return &StatsService{
+		hostService: hostService,
+		cron:        cron.New(),
+	}
+}
+
+// StartSchedule schedules exporting stats according to `stats.schedule`
+func (service *StatsService) StartSchedule() error {
+	schedule := viper.GetString("stats.schedule")
+	if schedule == "" {
+		return nil
+	}
+
+	_, err := service.cron.AddFunc(schedule, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("stats.timeout"))
+		defer cancel()
+
+		if err := service.Export(ctx); err != nil {
+			log.WithError(err).Error("failed to export stats")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	service.cron.Start()
+	return nil
+}
+
+// ProjectStats returns the resource usage of a project. Containers are only reported while the
+// container host is running
+func (service *StatsService) ProjectStats(ctx context.Context, name string) (*ProjectStats, error) {
+	repo := service.hostService.repo
+
+	hostStats, err := repo.GetContainerHostStats(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ProjectStats{
+		Host:       hostStats,
+		Containers: []host.ContainerStats{},
+	}
+
+	if hostStats.Status != "Running" {
+		return stats, nil
+	}
+
+	stats.Containers, err = repo.GetContainerStats(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Export collects the stats of every project on this worker and replaces the exported metrics
+// with them
+func (service *StatsService) Export(ctx context.Context) error {
+	metas, err := service.hostService.consul.GetProjectMetas()
+	if err != nil {
+		return err
+	}
+
+	concurrency := viper.GetInt("stats.concurrency")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, concurrency)
+		all   = make([]*ProjectStats, len(metas))
+	)
+	for i, meta := range metas {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			stats, err := service.ProjectStats(ctx, name)
+			if err != nil {
+				// one unreachable project shouldn't hide every other project's usage
+				log.WithError(err).WithFields(log.Fields{"containerHost": name}).Warn("failed to get project stats")
+				return
+			}
+			all[i] = stats
+		}(i, meta.ID)
+	}
+	wg.Wait()
+
+	exported := make([]*ProjectStats, 0, len(all))
+	for _, stats := range all {
+		if stats != nil {
+			exported = append(exported, stats)
+		}
+	}
+	exportedStats.set(exported)
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"crypto/rand"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"net"
 	"time"
@@ -25,7 +26,6 @@ type PEMContainer struct {
 }
 
 type TLSCertService struct {
-	serverIP           string
 	clientCertTemplate *x509.Certificate
 	serverCertTemplate *x509.Certificate
 }
@@ -34,7 +34,7 @@ func NewTLSCertService() *TLSCertService {
 	return &TLSCertService{}
 }
 
-func (t *TLSCertService) certificateTemplate() *x509.Certificate {
+func (t *TLSCertService) certificateTemplate(serverIP string) *x509.Certificate {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, _ := rand.Int(rand.Reader, serialNumberLimit)
 
@@ -44,7 +44,7 @@ func (t *TLSCertService) certificateTemplate() *x509.Certificate {
 		NotBefore:             time.Now(),
 		NotAfter:              time.Now().Add(tenYears),
 		BasicConstraintsValid: true,
-		IPAddresses:           []net.IP{net.ParseIP(t.serverIP)},
+		IPAddresses:           []net.IP{net.ParseIP(serverIP)},
 	}
 }
 
@@ -81,7 +81,7 @@ func (t *TLSCertService) generateRootParts() (rootKeyPEM []byte, rootCertPEM []b
 	return rootKeyBytes, rootCertBytes, rootKey, rootTemplate, err
 }
 
-func (t *TLSCertService) generateServerParts(rootTemplate *x509.Certificate, rootKey *ecdsa.PrivateKey) (serverKeyPEM []byte, serverCertPEM []byte, err error) {
+func (t *TLSCertService) generateServerParts(serverIP string, rootTemplate *x509.Certificate, rootKey *ecdsa.PrivateKey) (serverKeyPEM []byte, serverCertPEM []byte, err error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, _ := rand.Int(rand.Reader, serialNumberLimit)
 
@@ -103,7 +103,7 @@ func (t *TLSCertService) generateServerParts(rootTemplate *x509.Certificate, roo
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 		IsCA:                  false,
-		IPAddresses:           []net.IP{net.ParseIP(t.serverIP)},
+		IPAddresses:           []net.IP{net.ParseIP(serverIP)},
 	}
 
 	serverCertBytes, err := x509.CreateCertificate(rand.Reader, &serverTemplate, rootTemplate, &serverKey.PublicKey, rootKey)
@@ -157,13 +157,12 @@ func (t *TLSCertService) encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
 }
 
 func (t *TLSCertService) CreatePEMs(serverIP string) (*PEMContainer, error) {
-	t.serverIP = serverIP
 	rootKeyPEM, rootCertPEM, rootKey, rootTemplate, err := t.generateRootParts()
 	if err != nil {
 		return nil, err
 	}
 
-	serverKeyPEM, serverCertPEM, err := t.generateServerParts(rootTemplate, rootKey)
+	serverKeyPEM, serverCertPEM, err := t.generateServerParts(serverIP, rootTemplate, rootKey)
 	if err != nil {
 		return nil, err
 	}
@@ -182,3 +181,47 @@ func (t *TLSCertService) CreatePEMs(serverIP string) (*PEMContainer, error) {
 		ClientCertPEM: clientCertPEM,
 	}, nil
 }
+
+// ReissueServerPEMs issues a new server key and cert for serverIP, signed by an existing root.
+// The root key and cert are the ServerCAPEM and ClientCAPEM of the original PEMContainer.
+func (t *TLSCertService) ReissueServerPEMs(serverIP string, rootKeyPEM, rootCertPEM []byte) (serverKeyPEM []byte, serverCertPEM []byte, err error) {
+	keyBlock, _ := pem.Decode(rootKeyPEM)
+	if keyBlock == nil {
+		return nil, nil, errors.New("failed to decode root key PEM")
+	}
+
+	rootKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(rootCertPEM)
+	if certBlock == nil {
+		return nil, nil, errors.New("failed to decode root cert PEM")
+	}
+
+	rootTemplate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return t.generateServerParts(serverIP, rootTemplate, rootKey)
+}
+
+// ServerCertIP returns the IP address a server cert was issued for
+func (t *TLSCertService) ServerCertIP(serverCertPEM []byte) (string, error) {
+	block, _ := pem.Decode(serverCertPEM)
+	if block == nil {
+		return "", errors.New("failed to decode server cert PEM")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+
+	if len(cert.IPAddresses) == 0 {
+		return "", errors.New("server cert has no IP addresses")
+	}
+	return cert.IPAddresses[0].String(), nil
+}
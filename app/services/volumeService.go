@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Strum355/log"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/volume"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+)
+
+// VolumeService manages the named volumes of projects. Volumes are created when the project's
+// containers are, and kept until deleted here
+type VolumeService struct {
+	hostService *ContainerHostService
+}
+
+func NewVolumeService(hostService *ContainerHostService) *VolumeService {
+	return &VolumeService{
+		hostService: hostService,
+	}
+}
+
+func (service *VolumeService) ListVolumes(ctx context.Context, name string) ([]volume.Volume, error) {
+	return service.hostService.repo.ListVolumes(ctx, name)
+}
+
+func (service *VolumeService) DeleteVolume(ctx context.Context, name, volumeName string) error {
+	log.WithFields(log.Fields{
+		"containerHost": name,
+		"volume":        volumeName,
+	}).Info("deleting volume")
+
+	return service.hostService.repo.DeleteVolume(ctx, host.VolumeDeleteOptions{
+		ContainerName: host.ContainerName{Name: name},
+		Volume:        volumeName,
+	})
+}
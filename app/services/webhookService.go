@@ -0,0 +1,602 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Strum355/log"
+	"github.com/cenkalti/backoff"
+	"github.com/spf13/viper"
+
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/event"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/project"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/models/webhook"
+	host "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/containerHost"
+	"github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/providers"
+	webhooksecret "github.com/UCCNetworkingSociety/Windlass-worker/app/repositories/webhookSecret"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	ErrNotDeadLetter    = errors.New("only failed deliveries can be redelivered")
+	ErrWebhookTarget    = errors.New("webhook url must resolve to public addresses only")
+)
+
+// Networks webhooks may not be sent to, so that they can't be used to reach the worker itself,
+// the container hosts or anything else on its private networks
+var forbiddenTargets = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",      // this network
+		"10.0.0.0/8",     // private
+		"100.64.0.0/10",  // carrier grade NAT
+		"127.0.0.0/8",    // loopback
+		"169.254.0.0/16", // link local
+		"172.16.0.0/12",  // private
+		"192.0.0.0/24",   // IETF protocol assignments
+		"192.168.0.0/16", // private
+		"198.18.0.0/15",  // benchmarking
+		"224.0.0.0/4",    // multicast
+		"240.0.0.0/4",    // reserved and broadcast
+		"::/128",         // unspecified
+		"::1/128",        // loopback
+		"64:ff9b::/96",   // NAT64
+		"fc00::/7",       // unique local
+		"fe80::/10",      // link local
+		"ff00::/8",       // multicast
+	}
+
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}()
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of the timestamp, a
+// dot and the body, keyed with the webhook's secret
+const (
+	signatureHeader = "X-Windlass-Signature"
+	timestampHeader = "X-Windlass-Timestamp"
+	eventHeader     = "X-Windlass-Event"
+	deliveryHeader  = "X-Windlass-Delivery"
+)
+
+// WebhookService sends signed project and container events to registered webhooks. Failed
+// deliveries are retried with exponential backoff and every delivery is recorded in Consul,
+// those that never succeeded being kept as dead letters
+type WebhookService struct {
+	consul  *providers.ConsulProvider
+	secrets webhooksecret.WebhookSecretRepo
+	client  *http.Client
+}
+
+func NewWebhookService(hostService *ContainerHostService, eventService *EventService) *WebhookService {
+	// every address dialed is checked, including after redirects and however the hostname resolves
+	dialer := &net.Dialer{
+		Timeout: viper.GetDuration("webhooks.timeout"),
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicIP(net.ParseIP(host)) {
+				return fmt.Errorf("%w: %s", ErrWebhookTarget, host)
+			}
+			return nil
+		},
+	}
+
+	service := &WebhookService{
+		consul:  hostService.consul,
+		secrets: webhooksecret.NewWebhookSecretRepo(),
+		client: &http.Client{
+			Timeout: viper.GetDuration("webhooks.timeout"),
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: viper.GetDuration("webhooks.timeout"),
+			},
+		},
+	}
+
+	eventService.Subscribe(service.onEvent)
+	return service
+}
+
+// Start resumes the deliveries this worker was sending when it stopped
+func (service *WebhookService) Start() error {
+	hooks, err := service.consul.GetWebhooks()
+	if err != nil {
+		return err
+	}
+
+	worker := viper.GetString("http.hostname")
+	for _, hook := range hooks {
+		// webhooks registered before secrets were kept in Vault have theirs in Consul
+		if hook.Secret != "" {
+			if err := service.moveSecret(hook); err != nil {
+				return err
+			}
+		}
+
+		deliveries, err := service.consul.GetDeliveries(hook.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			if delivery.Status == webhook.StatusPending && delivery.Worker == worker {
+				go service.deliver(hook, delivery)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateWebhook registers a webhook, generating its ID and, if one wasnt given, its secret. The
+// secret is kept in Vault and the rest of the webhook in Consul
+func (service *WebhookService) CreateWebhook(ctx context.Context, hook webhook.Webhook) (*webhook.Webhook, error) {
+	if err := checkTarget(ctx, hook.URL); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if hook.ID, err = randomHex(8); err != nil {
+		return nil, err
+	}
+	secret := hook.Secret
+	if secret == "" {
+		if secret, err = randomHex(32); err != nil {
+			return nil, err
+		}
+	}
+	hook.CreatedAt = time.Now()
+
+	if err := service.secrets.PutSecret(ctx, hook.ID, secret); err != nil {
+		return nil, err
+	}
+
+	hook.Secret = ""
+	if err := service.consul.SaveWebhook(hook); err != nil {
+		if deleteErr := service.secrets.DeleteSecret(ctx, hook.ID); deleteErr != nil {
+			log.WithError(deleteErr).WithFields(log.Fields{"webhook": hook.ID}).Warn("failed to delete secret of unsaved webhook")
+		}
+		return nil, err
+	}
+	hook.Secret = secret
+
+	log.WithFields(log.Fields{
+		"webhook":   hook.ID,
+		"url":       hook.URL,
+		"namespace": hook.Namespace,
+	}).Info("registered webhook")
+
+	return &hook, nil
+}
+
+// ListWebhooks returns the webhooks of a namespace, or every webhook if namespace is empty.
+// Secrets are left out
+func (service *WebhookService) ListWebhooks(namespace string) ([]webhook.Webhook, error) {
+	hooks, err := service.consul.GetWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]webhook.Webhook, 0, len(hooks))
+	for _, hook := range hooks {
+		if namespace != "" && hook.Namespace != namespace {
+			continue
+		}
+		hook.Secret = ""
+		list = append(list, hook)
+	}
+	return list, nil
+}
+
+func (service *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	if _, err := service.getWebhook(id); err != nil {
+		return err
+	}
+	if err := service.consul.DeleteWebhook(id); err != nil {
+		return err
+	}
+	return service.secrets.DeleteSecret(ctx, id)
+}
+
+// moveSecret moves a webhook's secret from Consul to Vault
+func (service *WebhookService) moveSecret(hook webhook.Webhook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if err := service.secrets.PutSecret(ctx, hook.ID, hook.Secret); err != nil {
+		return fmt.Errorf("error moving secret of webhook %s to Vault: %w", hook.ID, err)
+	}
+	hook.Secret = ""
+	return service.consul.SaveWebhook(hook)
+}
+
+// checkTarget resolves a webhook URL's host and checks that every address it resolves to is public
+func checkTarget(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return webhook.ErrInvalidURL
+	}
+
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicIP(ip) {
+			return ErrWebhookTarget
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: %s doesn't resolve", ErrWebhookTarget, host)
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrWebhookTarget
+		}
+	}
+	return nil
+}
+
+// publicIP reports whether ip is outside every network webhooks may not be sent to
+func publicIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range forbiddenTargets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ListDeliveries returns the delivery history of a webhook, newest first, optionally only those
+// with the given status
+func (service *WebhookService) ListDeliveries(id, status string) ([]webhook.Delivery, error) {
+	if _, err := service.getWebhook(id); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := service.consul.GetDeliveries(id)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]webhook.Delivery, 0, len(deliveries))
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		if status == "" || deliveries[i].Status == status {
+			list = append(list, deliveries[i])
+		}
+	}
+	return list, nil
+}
+
+// Redeliver sends a dead letter again, with a fresh set of attempts
+func (service *WebhookService) Redeliver(id, deliveryID string) error {
+	hook, err := service.getWebhook(id)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := service.consul.GetDeliveries(id)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		if delivery.ID != deliveryID {
+			continue
+		}
+		if delivery.Status != webhook.StatusFailed {
+			return ErrNotDeadLetter
+		}
+
+		delivery.Status = webhook.StatusPending
+		delivery.Worker = viper.GetString("http.hostname")
+		if err := service.consul.SaveDelivery(delivery); err != nil {
+			return err
+		}
+		go service.deliver(*hook, delivery)
+		return nil
+	}
+	return ErrDeliveryNotFound
+}
+
+func (service *WebhookService) getWebhook(id string) (*webhook.Webhook, error) {
+	hook, err := service.consul.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	if hook == nil {
+		return nil, ErrWebhookNotFound
+	}
+	return hook, nil
+}
+
+// ProjectCreated notifies webhooks of a project being created, or failing to be if err is set.
+// Nothing is sent for conflicts, as the project already existed and wasn't created by the request
+func (service *WebhookService) ProjectCreated(proj project.Project, err error) {
+	var hostErr host.Error
+	if errors.As(err, &hostErr) && hostErr.StatusCode == http.StatusConflict {
+		return
+	}
+
+	payload := webhook.Payload{
+		Event:     webhook.ProjectCreated,
+		Time:      time.Now(),
+		Namespace: proj.Namespace,
+		Project:   proj.Name,
+	}
+
+	if err != nil {
+		payload.Event = webhook.ProjectCreationFailed
+		payload.Data = map[string]interface{}{"error": err.Error()}
+	}
+
+	go service.Notify(payload)
+}
+
+func (service *WebhookService) ProjectDeleted(proj project.Project) {
+	go service.Notify(webhook.Payload{
+		Event:     webhook.ProjectDeleted,
+		Time:      time.Now(),
+		Namespace: proj.Namespace,
+		Project:   proj.Name,
+	})
+}
+
+// onEvent notifies webhooks of containers crashing or changing health
+func (service *WebhookService) onEvent(ev event.Event) {
+	payload := webhook.Payload{
+		Time:      ev.Time,
+		Namespace: ev.Namespace,
+		Project:   ev.Project,
+		Container: ev.Container,
+	}
+
+	switch ev.Type {
+	case event.ContainerDied:
+		if !ev.Abnormal() {
+			return
+		}
+		payload.Event = webhook.ContainerCrashed
+		payload.Data = map[string]interface{}{"reason": "exited"}
+		if ev.ExitCode != nil {
+			payload.Data["exitCode"] = *ev.ExitCode
+		}
+	case event.ContainerOOMKilled:
+		payload.Event = webhook.ContainerCrashed
+		payload.Data = map[string]interface{}{"reason": "oom_killed"}
+	case event.ContainerUnhealthy:
+		payload.Event = webhook.ContainerHealthChanged
+		payload.Data = map[string]interface{}{"health": "unhealthy"}
+	case event.ContainerHealthy:
+		payload.Event = webhook.ContainerHealthChanged
+		payload.Data = map[string]interface{}{"health": "healthy"}
+	default:
+		return
+	}
+
+	// without its project the event cant be matched against namespaced webhooks
+	if ev.Namespace == "" {
+		return
+	}
+
+	go service.Notify(payload)
+}
+
+// Notify starts a delivery of payload to every webhook that wants it
+func (service *WebhookService) Notify(payload webhook.Payload) {
+	hooks, err := service.consul.GetWebhooks()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"event": payload.Event}).Error("failed to get webhooks")
+		return
+	}
+
+	for _, hook := range hooks {
+		if !hook.Wants(payload) {
+			continue
+		}
+
+		id, err := randomHex(4)
+		if err != nil {
+			log.WithError(err).Error("failed to generate delivery ID")
+			return
+		}
+
+		delivery := webhook.Delivery{
+			// zero padded so that deliveries sort by time in Consul
+			ID:        fmt.Sprintf("%019d-%s", time.Now().UnixNano(), id),
+			Webhook:   hook.ID,
+			Worker:    viper.GetString("http.hostname"),
+			Payload:   payload,
+			Status:    webhook.StatusPending,
+			Attempts:  []webhook.Attempt{},
+			CreatedAt: time.Now(),
+		}
+
+		if err := service.consul.SaveDelivery(delivery); err != nil {
+			log.WithError(err).WithFields(log.Fields{"webhook": hook.ID}).Error("failed to save delivery")
+			continue
+		}
+		go service.deliver(hook, delivery)
+	}
+}
+
+// deliver sends a delivery until it succeeds or `webhooks.maxAttempts` attempts have failed,
+// recording each attempt
+func (service *WebhookService) deliver(hook webhook.Webhook, delivery webhook.Delivery) {
+	body, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"webhook": hook.ID}).Error("failed to encode payload")
+		return
+	}
+
+	retry := backoff.NewExponentialBackOff()
+	retry.InitialInterval = viper.GetDuration("webhooks.backoff")
+	retry.MaxInterval = viper.GetDuration("webhooks.maxBackoff")
+	retry.MaxElapsedTime = 0
+
+	// without its secret the delivery cant be signed, so it is dead lettered straight away
+	secret, err := service.getSecret(hook.ID)
+	if err == nil && secret == "" {
+		err = errors.New("webhook has no secret")
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"webhook": hook.ID}).Error("failed to get webhook secret")
+
+		delivery.Attempts = append(delivery.Attempts, webhook.Attempt{Time: time.Now(), Error: err.Error()})
+		delivery.Status = webhook.StatusFailed
+		if err := service.consul.SaveDelivery(delivery); err != nil {
+			log.WithError(err).WithFields(log.Fields{"webhook": hook.ID}).Error("failed to save delivery")
+		}
+		return
+	}
+
+	maxAttempts := viper.GetInt("webhooks.maxAttempts")
+	for attempts := 0; attempts < maxAttempts; attempts++ {
+		if attempts > 0 {
+			time.Sleep(retry.NextBackOff())
+		}
+
+		attempt := service.send(hook, delivery, body, secret)
+		delivery.Attempts = append(delivery.Attempts, attempt)
+
+		switch {
+		case attempt.Error == "":
+			delivery.Status = webhook.StatusDelivered
+		case attempts == maxAttempts-1:
+			delivery.Status = webhook.StatusFailed
+		}
+
+		if err := service.consul.SaveDelivery(delivery); err != nil {
+			log.WithError(err).WithFields(log.Fields{"webhook": hook.ID}).Error("failed to save delivery")
+		}
+
+		if delivery.Status == webhook.StatusDelivered {
+			break
+		}
+
+		log.WithFields(log.Fields{
+			"webhook":  hook.ID,
+			"delivery": delivery.ID,
+			"attempt":  len(delivery.Attempts),
+			"error":    attempt.Error,
+		}).Warn("webhook delivery failed")
+	}
+
+	if delivery.Status == webhook.StatusFailed {
+		log.WithFields(log.Fields{
+			"webhook":  hook.ID,
+			"delivery": delivery.ID,
+			"event":    delivery.Payload.Event,
+		}).Error("webhook delivery dead lettered")
+	}
+
+	service.prune(hook.ID)
+}
+
+func (service *WebhookService) getSecret(id string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return service.secrets.GetSecret(ctx, id)
+}
+
+// signature returns the value of the signature header for a delivery
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// send makes a single signed request to a webhook. Any response other than a 2xx is a failure
+func (service *WebhookService) send(hook webhook.Webhook, delivery webhook.Delivery, body []byte, secret string) webhook.Attempt {
+	attempt := webhook.Attempt{Time: time.Now()}
+
+	timestamp := strconv.FormatInt(attempt.Time.Unix(), 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("webhooks.timeout"))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(signatureHeader, signature(secret, timestamp, body))
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(eventHeader, string(delivery.Payload.Event))
+	req.Header.Set(deliveryHeader, delivery.ID)
+
+	resp, err := service.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %s", resp.Status)
+	}
+	return attempt
+}
+
+// prune deletes the oldest delivered deliveries of a webhook beyond `webhooks.history`. Dead
+// letters and pending deliveries are kept
+func (service *WebhookService) prune(id string) {
+	deliveries, err := service.consul.GetDeliveries(id)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{"webhook": id}).Warn("failed to prune deliveries")
+		return
+	}
+
+	delivered := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		if delivery.Status == webhook.StatusDelivered {
+			delivered = append(delivered, delivery.ID)
+		}
+	}
+	sort.Strings(delivered)
+
+	for len(delivered) > viper.GetInt("webhooks.history") {
+		if err := service.consul.DeleteDelivery(id, delivered[0]); err != nil {
+			log.WithError(err).WithFields(log.Fields{"webhook": id}).Warn("failed to prune deliveries")
+			return
+		}
+		delivered = delivered[1:]
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,43 @@
+package services
+
+import "testing"
+
+func TestSignature(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{
+			name:      "delivery",
+			secret:    "secret",
+			timestamp: "1600000000",
+			body:      `{"event":"project.created"}`,
+			want:      "sha256=63dce85c3954d9534125b1fa01339589cfcd400febaca8d451a61a1b4fb2a12d",
+		},
+		{
+			name:      "other secret",
+			secret:    "other",
+			timestamp: "1600000000",
+			body:      `{"event":"project.created"}`,
+			want:      "sha256=fc0bd13afdbdfc7463e9fb93fd6a7288728a06a0b3707a4ed783b1922f83b56c",
+		},
+		{
+			name:      "empty",
+			secret:    "",
+			timestamp: "0",
+			body:      "",
+			want:      "sha256=b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signature(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("signature() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var ErrNoKey = errors.New("no encryption key set")
+
+// version prefixed to ciphertexts whose key is derived with argon2id. Ciphertexts without it
+// predate key derivation and were sealed with sha256(passphrase) as the key
+var header = []byte("wlenc1")
+
+const saltSize = 16
+
+// argon2id parameters, the RFC 9106 second recommended option
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+)
+
+func aead(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, 32)
+}
+
+// Seal encrypts plaintext with AES-256-GCM using a key derived from passphrase with argon2id.
+// The returned ciphertext is prefixed with a version header, the random salt and the random nonce
+func Seal(passphrase string, plaintext []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrNoKey
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := aead(deriveKey(passphrase, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(append(append([]byte{}, header...), salt...), nonce...)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+// Open decrypts ciphertext produced by Seal, including ciphertexts sealed before keys were
+// derived with argon2id
+func Open(passphrase string, ciphertext []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrNoKey
+	}
+
+	var key []byte
+	if bytes.HasPrefix(ciphertext, header) && len(ciphertext) >= len(header)+saltSize {
+		salt := ciphertext[len(header) : len(header)+saltSize]
+		key = deriveKey(passphrase, salt)
+		ciphertext = ciphertext[len(header)+saltSize:]
+	} else {
+		sum := sha256.Sum256([]byte(passphrase))
+		key = sum[:]
+	}
+
+	gcm, err := aead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}